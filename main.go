@@ -2,19 +2,43 @@
 package main
 
 import (
+	"archive/tar"
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"hash/fnv"
 	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"modernc.org/sqlite"
 )
 
 // DockerStat represents a single Docker container statistics entry
@@ -28,6 +52,12 @@ type DockerStat struct {
 	Name      string `json:"Name"`
 	NetIO     string `json:"NetIO"`
 	PIDs      string `json:"PIDs"`
+	// Source is the stats file a container line came from when files with
+	// the same timestamp were merged
+	Source string `json:"Source,omitempty"`
+	// Labels holds the container labels in the "key=value,key=value" form of
+	// docker ps, for collectors that add them to the stats lines
+	Labels string `json:"Labels,omitempty"`
 }
 
 // StatsFile represents a stats file with its data
@@ -35,11 +65,87 @@ type StatsFile struct {
 	Name      string
 	Timestamp time.Time
 	Stats     []DockerStat
+	// ModTime is when the file was written, zero if unknown
+	ModTime time.Time
+	// Path is the file the stats were read from, so they can be read again
+	// when loaded without them under -low-memory
+	Path string
 }
 
-// ServerData holds all parsed stats files
+// ServerData holds all parsed stats files. Refreshes replace its fields
+// while handlers read them, so both sides go through mu.
 type ServerData struct {
+	mu    sync.RWMutex
 	Files []StatsFile
+	// RefreshEmpty is set when the last refresh found no stats files
+	RefreshEmpty bool
+	// LoadErrors lists the files skipped by the last load
+	LoadErrors []LoadError
+	// LoadFailed holds the error of the last refresh if it was rejected
+	// because of malformed files under -strict-files
+	LoadFailed string
+	// Version is incremented whenever Files is replaced, so derived data
+	// such as rendered sparklines can be cached per version
+	Version int
+	// ClockWarnings lists the files whose timestamp went backwards
+	// compared to the file written before them
+	ClockWarnings []ClockWarning
+	// Query indexes Files for /api/query; it is only built with -query-api
+	Query *QueryIndex
+	// RefreshTimeouts counts the consecutive runs of run.sh killed after
+	// -refresh-timeout
+	RefreshTimeouts int
+	// LastRefresh is when Files was last loaded, at startup or by a refresh
+	LastRefresh time.Time
+}
+
+// Snapshot returns the currently loaded stats files. A refresh replaces the
+// slice rather than modifying it, so the result stays valid after a refresh.
+func (d *ServerData) Snapshot() []StatsFile {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.Files
+}
+
+// CurrentVersion returns the version of the currently loaded stats files
+func (d *ServerData) CurrentVersion() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.Version
+}
+
+// maxRefreshTimeouts is the number of consecutive refresh timeouts after
+// which /healthz reports the collection as failing
+const maxRefreshTimeouts = 3
+
+// errCommandTimeout is returned by runCommand for a command it killed
+var errCommandTimeout = errors.New("timed out")
+
+// runCommand runs a command with extra environment variables and returns
+// its combined output. A command still running after timeout (0 means no
+// limit) is killed and errCommandTimeout returned, so a hung collector
+// cannot block later refreshes.
+func runCommand(timeout time.Duration, env []string, name string, args ...string) ([]byte, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	// Run the command in its own process group and kill the whole group,
+	// so a hung child such as docker stats does not outlive the script
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return output, errCommandTimeout
+	}
+	return output, err
 }
 
 // ContainerComparison holds historical data for a container
@@ -47,6 +153,16 @@ type ContainerComparison struct {
 	ContainerID   string               `json:"container_id"`
 	ContainerName string               `json:"container_name"`
 	Data          []ContainerDataPoint `json:"data"`
+	Gaps          []SamplingGap        `json:"gaps"`
+	// CPUMovingMax is the trailing maximum CPU at each data point
+	CPUMovingMax []float64 `json:"cpu_moving_max,omitempty"`
+}
+
+// SamplingGap marks an unusually long interval between two data points
+type SamplingGap struct {
+	Index    int     `json:"index"`
+	Seconds  float64 `json:"seconds"`
+	Expected float64 `json:"expected_seconds"`
 }
 
 // ContainerComparisonWithStats extends ContainerComparison with calculated statistics
@@ -58,862 +174,5005 @@ type ContainerComparisonWithStats struct {
 	AvgMem float64
 	MaxMem float64
 	MinMem float64
+	// Memory in use in bytes, which unlike the percentages doesn't shift
+	// when the container's limit changes
+	AvgMemBytes int64
+	MaxMemBytes int64
+	MinMemBytes int64
+	// AnomalyCount is the number of data points marked as CPU anomalies
+	AnomalyCount int
+	Stats        StatsOptions
+	Thresholds   Thresholds
+	Columns      ColumnSet
+	// ObservedInterval is the median time between data points, and
+	// IrregularInterval is set when many intervals stray far from it
+	ObservedInterval  time.Duration
+	IrregularInterval bool
+	// StatusLine compares the container's current CPU with its history, and
+	// StatusClass colors it (see statusLine)
+	StatusLine  string
+	StatusClass string
+	// Bytes moved over the container's history
+	NetInTotal      int64
+	NetOutTotal     int64
+	BlockReadTotal  int64
+	BlockWriteTotal int64
+}
+
+// statusLine describes the container's CPU in the newest stats file against
+// its average and peak, e.g. "Currently 12.00% CPU (below its 45.00%
+// average, peak 90.00%)", with the metric class to color it: high above the
+// average, low at or below it. A container missing from the newest file is
+// reported as not currently running, without a class.
+func statusLine(comparison ContainerComparisonWithStats, newest time.Time) (string, string) {
+	if len(comparison.Data) == 0 {
+		return "", ""
+	}
+	latest := comparison.Data[len(comparison.Data)-1]
+	if !latest.Time.Equal(newest) {
+		return fmt.Sprintf("Not currently running (last seen %s, %.2f%% average CPU, peak %.2f%%)",
+			latest.Timestamp, comparison.AvgCPU, comparison.MaxCPU), ""
+	}
+
+	relation, class := "at", "metric-low"
+	if latest.CPUPerc > comparison.AvgCPU {
+		relation, class = "above", "metric-high"
+	} else if latest.CPUPerc < comparison.AvgCPU {
+		relation = "below"
+	}
+	return fmt.Sprintf("Currently %.2f%% CPU (%s its %.2f%% average, peak %.2f%%)",
+		latest.CPUPerc, relation, comparison.AvgCPU, comparison.MaxCPU), class
 }
 
 // ContainerSummary holds aggregated statistics for a container across all files
 type ContainerSummary struct {
-	ContainerID   string  `json:"container_id"`
-	ContainerName string  `json:"container_name"`
-	DataPoints    int     `json:"data_points"`
-	AvgCPU        float64 `json:"avg_cpu"`
-	MaxCPU        float64 `json:"max_cpu"`
-	MinCPU        float64 `json:"min_cpu"`
-	AvgMem        float64 `json:"avg_mem"`
-	MaxMem        float64 `json:"max_mem"`
-	MinMem        float64 `json:"min_mem"`
-	FirstSeen     string  `json:"first_seen"`
-	LastSeen      string  `json:"last_seen"`
+	ContainerID   string    `json:"container_id"`
+	ContainerName string    `json:"container_name"`
+	DataPoints    int       `json:"data_points"`
+	AvgCPU        float64   `json:"avg_cpu"`
+	MaxCPU        float64   `json:"max_cpu"`
+	MinCPU        float64   `json:"min_cpu"`
+	AvgMem        float64   `json:"avg_mem"`
+	MaxMem        float64   `json:"max_mem"`
+	MinMem        float64   `json:"min_mem"`
+	FirstSeen     string    `json:"first_seen"`
+	LastSeen      string    `json:"last_seen"`
+	FirstSeenTime time.Time `json:"-"`
+	LastSeenTime  time.Time `json:"-"`
+	LastSeenClass string    `json:"-"`
+	AlwaysBusy    bool      `json:"always_busy"`
+	AboveBaseline bool      `json:"above_baseline"`
+	CPUTrend      Trend     `json:"cpu_trend"`
+	MemTrend      Trend     `json:"mem_trend"`
+	// Bytes moved over the container's history and the average rate in
+	// bytes per second, computed from the cumulative NetIO and BlockIO
+	// counters
+	NetInTotal      int64   `json:"net_in_total"`
+	NetOutTotal     int64   `json:"net_out_total"`
+	BlockReadTotal  int64   `json:"block_read_total"`
+	BlockWriteTotal int64   `json:"block_write_total"`
+	NetInRate       float64 `json:"net_in_rate"`
+	NetOutRate      float64 `json:"net_out_rate"`
+	BlockReadRate   float64 `json:"block_read_rate"`
+	BlockWriteRate  float64 `json:"block_write_rate"`
+	// AvgMemLimitUtil is the average share of the memory limit in use, from
+	// the parsed MemUsage bytes, and EfficiencyScore the weighted mean of it
+	// and the average CPU (see markEfficiency)
+	AvgMemLimitUtil float64 `json:"avg_mem_limit_util"`
+	EfficiencyScore float64 `json:"efficiency_score"`
+	// AvgMemUsedBytes is the average memory in use in bytes, so containers
+	// can be compared by absolute memory rather than percentage
+	AvgMemUsedBytes int64 `json:"avg_mem_used_bytes"`
+	// ObservedInterval is the median time between data points in seconds;
+	// IrregularInterval flags a collection schedule that varies widely
+	ObservedInterval  float64 `json:"observed_interval_seconds"`
+	IrregularInterval bool    `json:"irregular_interval"`
+	// Restarts counts the likely restarts found by detectRestarts
+	Restarts int `json:"restarts"`
+	// Percentiles of CPU and memory, interpolated linearly between ranks
+	P50CPU float64 `json:"p50_cpu"`
+	P90CPU float64 `json:"p90_cpu"`
+	P95CPU float64 `json:"p95_cpu"`
+	P99CPU float64 `json:"p99_cpu"`
+	P50Mem float64 `json:"p50_mem"`
+	P90Mem float64 `json:"p90_mem"`
+	P95Mem float64 `json:"p95_mem"`
+	P99Mem float64 `json:"p99_mem"`
+	// Data points above -cpu-spike and -mem-spike (see detectSpikes)
+	CPUSpikeCount int `json:"cpu_spike_count"`
+	MemSpikeCount int `json:"mem_spike_count"`
+	// Averages with exponentially decaying weights (see recencyWeightedAvg)
+	RecentAvgCPU float64 `json:"recent_avg_cpu"`
+	RecentAvgMem float64 `json:"recent_avg_mem"`
+	// CPUSparkline draws the CPU history in the summary table
+	CPUSparkline template.HTML `json:"-"`
+	// Project is the docker-compose project parsed from the container name,
+	// empty if the name does not look like a compose container
+	Project string `json:"project,omitempty"`
 }
 
+// Trend describes whether a metric rose or fell over a container's history
+type Trend string
+
+const (
+	TrendUp   Trend = "up"
+	TrendDown Trend = "down"
+	TrendFlat Trend = "flat"
+)
+
+// trendTolerance is the change in percentage points between the first and
+// second half averages below which a trend counts as flat
+const trendTolerance = 1.0
+
 // ContainerDataPoint represents a single data point for a container
 type ContainerDataPoint struct {
-	Timestamp string  `json:"timestamp"`
-	CPUPerc   float64 `json:"cpu_perc"`
-	MemPerc   float64 `json:"mem_perc"`
-	MemUsage  string  `json:"mem_usage"`
-	NetIO     string  `json:"net_io"`
-	BlockIO   string  `json:"block_io"`
-	PIDs      string  `json:"pids"`
+	Timestamp string    `json:"timestamp"`
+	Time      time.Time `json:"-"`
+	CPUPerc   float64   `json:"cpu_perc"`
+	MemPerc   float64   `json:"mem_perc"`
+	MemUsage  string    `json:"mem_usage"`
+	NetIO     string    `json:"net_io"`
+	BlockIO   string    `json:"block_io"`
+	PIDs      string    `json:"pids"`
+	GapBefore bool      `json:"gap_before,omitempty"`
+	// MemUsage parsed into bytes, zero if it could not be parsed
+	MemUsedBytes  int64 `json:"mem_used_bytes"`
+	MemLimitBytes int64 `json:"mem_limit_bytes"`
+	// NetIO and BlockIO parsed into cumulative byte counters. NetIOValid
+	// and BlockIOValid are false if the value could not be parsed; its
+	// counters are then zero and left out of rates, totals and restarts.
+	NetInBytes      int64 `json:"net_in_bytes"`
+	NetOutBytes     int64 `json:"net_out_bytes"`
+	NetIOValid      bool  `json:"net_io_valid"`
+	BlockReadBytes  int64 `json:"block_read_bytes"`
+	BlockWriteBytes int64 `json:"block_write_bytes"`
+	BlockIOValid    bool  `json:"block_io_valid"`
+	// Bytes moved since the previous data point with valid counters, set
+	// by markIODeltas for the container page where HasNetDelta and
+	// HasBlockDelta are set
+	NetInDelta      int64 `json:"-"`
+	NetOutDelta     int64 `json:"-"`
+	HasNetDelta     bool  `json:"-"`
+	BlockReadDelta  int64 `json:"-"`
+	BlockWriteDelta int64 `json:"-"`
+	HasBlockDelta   bool  `json:"-"`
+	// Anomaly marks a CPU value far from its trailing window, set from
+	// detectAnomalies for the container page
+	Anomaly bool `json:"-"`
+	// Original docker stats strings, only included in API responses on
+	// request with ?raw=true
+	CPUPercRaw string `json:"cpu_perc_raw,omitempty"`
+	MemPercRaw string `json:"mem_perc_raw,omitempty"`
 }
 
-// parseStatsFile parses a single stats JSON file
-func parseStatsFile(filePath string) (StatsFile, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return StatsFile{}, fmt.Errorf("error opening file %s: %v", filePath, err)
-	}
-	defer file.Close()
+// Overview holds the key numbers of the newest stats file for status widgets
+type Overview struct {
+	TotalContainers int               `json:"total_containers"`
+	TotalCPU        float64           `json:"total_cpu"`
+	TotalMem        float64           `json:"total_mem"`
+	WarnCount       int               `json:"warn_count"`
+	CritCount       int               `json:"crit_count"`
+	NewestTimestamp string            `json:"newest_timestamp"`
+	Hottest         *HottestContainer `json:"hottest_container"`
+}
 
-	var dockerStats []DockerStat
-	scanner := bufio.NewScanner(file)
-	lineNum := 0
+// HottestContainer identifies the container with the highest CPU usage
+type HottestContainer struct {
+	ContainerID   string  `json:"container_id"`
+	ContainerName string  `json:"container_name"`
+	CPUPerc       float64 `json:"cpu_perc"`
+	MemPerc       float64 `json:"mem_perc"`
+}
 
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
+// MetricThresholds holds the warn and crit levels of one metric in percent
+type MetricThresholds struct {
+	Warn float64 `json:"warn"`
+	Crit float64 `json:"crit"`
+}
 
-		if line == "" {
-			continue
-		}
+// Thresholds holds the usage levels used for highlighting, per metric
+type Thresholds struct {
+	CPU MetricThresholds `json:"cpu"`
+	Mem MetricThresholds `json:"mem"`
+}
 
-		var stat DockerStat
-		if err := json.Unmarshal([]byte(line), &stat); err != nil {
-			return StatsFile{}, fmt.Errorf("error parsing line %d in %s: %v", lineNum, filePath, err)
-		}
+// defaultThresholds are used when no thresholds are configured
+var defaultThresholds = Thresholds{
+	CPU: MetricThresholds{Warn: 50, Crit: 80},
+	Mem: MetricThresholds{Warn: 50, Crit: 80},
+}
 
-		dockerStats = append(dockerStats, stat)
-	}
+// ExportRecord is a single container stat line of the NDJSON export
+type ExportRecord struct {
+	Timestamp string `json:"timestamp"`
+	File      string `json:"file"`
+	DockerStat
+}
 
-	if err := scanner.Err(); err != nil {
-		return StatsFile{}, fmt.Errorf("error reading file %s: %v", filePath, err)
-	}
+// ExportFilter restricts which records the export emits
+type ExportFilter struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
 
-	// Extract timestamp from filename
-	basename := filepath.Base(filePath)
-	timestamp := time.Now() // fallback
-	if strings.Contains(basename, "_") {
-		parts := strings.Split(basename, "_")
-		if len(parts) >= 3 {
-			dateStr := parts[0] + "_" + parts[1]
-			if t, err := time.Parse("2006-01-02_15-04-05", dateStr); err == nil {
-				timestamp = t
-			}
-		}
+// matchesFile reports whether a file's timestamp lies within the filter range
+func (f ExportFilter) matchesFile(statsFile StatsFile) bool {
+	if !f.From.IsZero() && statsFile.Timestamp.Before(f.From) {
+		return false
 	}
+	if !f.To.IsZero() && statsFile.Timestamp.After(f.To) {
+		return false
+	}
+	return true
+}
 
-	return StatsFile{
-		Name:      basename,
-		Timestamp: timestamp,
-		Stats:     dockerStats,
-	}, nil
+// matchesStat reports whether a container stat matches the name filter
+func (f ExportFilter) matchesStat(stat DockerStat) bool {
+	return f.Name == "" || strings.Contains(strings.ToLower(stat.Name), strings.ToLower(f.Name))
 }
 
-// loadAllStatsFiles loads and parses all JSON files from the stats directory
-func loadAllStatsFiles(dir string) ([]StatsFile, error) {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, fmt.Errorf("error reading directory %s: %v", dir, err)
-	}
+// humanTimeLayout is the timestamp layout of the pages and of ?ts=human,
+// with the zone abbreviation of -tz
+const humanTimeLayout = "2006-01-02 15:04:05 MST"
 
-	var statsFiles []StatsFile
-	for _, file := range files {
-		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
-			continue
-		}
+// humanTime formats t for the pages in the -tz zone
+func humanTime(t time.Time) string {
+	return t.In(displayLocation).Format(humanTimeLayout)
+}
 
-		filePath := filepath.Join(dir, file.Name())
-		statsFile, err := parseStatsFile(filePath)
-		if err != nil {
-			log.Printf("Warning: failed to parse %s: %v", filePath, err)
-			continue
-		}
+// displayLocation is the time zone timestamps are shown in, set from -tz,
+// and fileLocation the one file name timestamps are written in, set from
+// -file-tz
+var (
+	displayLocation = time.UTC
+	fileLocation    = time.UTC
+)
 
-		statsFiles = append(statsFiles, statsFile)
+// parseTimeParam parses a query parameter in RFC3339 or "2006-01-02
+// 15:04:05" format, the latter optionally followed by the zone abbreviation
+// of the pages and otherwise taken to be in the -tz zone
+func parseTimeParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", humanTimeLayout} {
+		if t, err := time.ParseInLocation(layout, value, displayLocation); err == nil {
+			return t, nil
+		}
 	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC3339 or 2006-01-02 15:04:05", value)
+}
 
-	// Sort by timestamp (newest first)
-	sort.Slice(statsFiles, func(i, j int) bool {
-		return statsFiles[i].Timestamp.After(statsFiles[j].Timestamp)
-	})
+// parseExportFilter reads the name, from and to query parameters
+func parseExportFilter(r *http.Request) (ExportFilter, error) {
+	query := r.URL.Query()
+	filter := ExportFilter{Name: query.Get("name")}
 
-	return statsFiles, nil
+	if from := query.Get("from"); from != "" {
+		t, err := parseTimeParam(from)
+		if err != nil {
+			return ExportFilter{}, fmt.Errorf("from: %v", err)
+		}
+		filter.From = t
+	}
+	if to := query.Get("to"); to != "" {
+		t, err := parseTimeParam(to)
+		if err != nil {
+			return ExportFilter{}, fmt.Errorf("to: %v", err)
+		}
+		filter.To = t
+	}
+	return filter, nil
 }
 
-// getContainerComparison returns historical data for a specific container
-func getContainerComparison(statsFiles []StatsFile, containerID string) ContainerComparison {
-	var dataPoints []ContainerDataPoint
-	var containerName string
+// ExportTruncation is the last line of an export cut short by the size limit
+type ExportTruncation struct {
+	Truncated bool  `json:"truncated"`
+	MaxBytes  int64 `json:"max_bytes"`
+}
 
-	for _, statsFile := range statsFiles {
+// writeExport streams the matching stats as NDJSON, oldest file first,
+// encoding one record at a time so memory stays flat; under -low-memory each
+// matching file is read from disk just before it is written. With a positive
+// maxBytes it stops before the record that would exceed the limit, writes
+// an ExportTruncation marker line and reports the truncation.
+func writeExport(w io.Writer, statsFiles []StatsFile, opts LoadOptions, filter ExportFilter, timeLayout string, maxBytes int64) (bool, error) {
+	var written int64
+	// Files are sorted newest first
+	for i := len(statsFiles) - 1; i >= 0; i-- {
+		if !filter.matchesFile(statsFiles[i]) {
+			continue
+		}
+		statsFile, ok := fileWithStats(statsFiles[i], opts)
+		if !ok {
+			continue
+		}
+		timestamp := statsFile.Timestamp.Format(timeLayout)
 		for _, stat := range statsFile.Stats {
-			if stat.ID == containerID {
-				// Parse CPU percentage
-				cpuStr := strings.TrimSuffix(stat.CPUPerc, "%")
-				cpuPerc, _ := strconv.ParseFloat(cpuStr, 64)
-
-				// Parse Memory percentage
-				memStr := strings.TrimSuffix(stat.MemPerc, "%")
-				memPerc, _ := strconv.ParseFloat(memStr, 64)
-
-				dataPoint := ContainerDataPoint{
-					Timestamp: statsFile.Timestamp.Format("2006-01-02 15:04:05"),
-					CPUPerc:   cpuPerc,
-					MemPerc:   memPerc,
-					MemUsage:  stat.MemUsage,
-					NetIO:     stat.NetIO,
-					BlockIO:   stat.BlockIO,
-					PIDs:      stat.PIDs,
-				}
-				dataPoints = append(dataPoints, dataPoint)
+			if !filter.matchesStat(stat) {
+				continue
+			}
+			line, err := json.Marshal(ExportRecord{
+				Timestamp:  timestamp,
+				File:       statsFile.Name,
+				DockerStat: stat,
+			})
+			if err != nil {
+				return false, err
+			}
+			line = append(line, '\n')
 
-				if containerName == "" {
-					containerName = stat.Name
-				}
+			if maxBytes > 0 && written+int64(len(line)) > maxBytes {
+				marker, _ := json.Marshal(ExportTruncation{Truncated: true, MaxBytes: maxBytes})
+				_, err := w.Write(append(marker, '\n'))
+				return true, err
+			}
+			n, err := w.Write(line)
+			written += int64(n)
+			if err != nil {
+				return false, err
 			}
 		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
 	}
+	return false, nil
+}
 
-	// Sort data points by timestamp (oldest first for proper timeline)
-	sort.Slice(dataPoints, func(i, j int) bool {
-		t1, _ := time.Parse("2006-01-02 15:04:05", dataPoints[i].Timestamp)
-		t2, _ := time.Parse("2006-01-02 15:04:05", dataPoints[j].Timestamp)
-		return t1.Before(t2)
-	})
+// Config holds the server settings. Every field is set by the command-line
+// flag registered for it in registerFlags, or by the same key in a -config
+// file.
+type Config struct {
+	Load       LoadOptions
+	Stats      StatsOptions
+	Thresholds Thresholds
 
-	return ContainerComparison{
-		ContainerID:   containerID,
-		ContainerName: containerName,
-		Data:          dataPoints,
-	}
+	// Loading
+	Dir               string
+	ExcludeContainers string
+	HideSystem        bool
+	OnEmpty           string
+	Refresh           time.Duration
+	RefreshTimeout    time.Duration
+	PrecomputeWorkers int
+
+	// Analysis
+	StaleAfter          time.Duration
+	OldAfter            time.Duration
+	BaselineFactor      float64
+	EfficiencyCPUWeight float64
+	EfficiencyMemWeight float64
+	BusyFloor           float64
+	RateGapAfter        time.Duration
+	GapFactor           float64
+
+	// QueryAPI enables the /api/query aggregations
+	QueryAPI bool
+
+	// Presentation
+	TemplatesDir    string
+	Columns         string
+	SparklinePoints int
+	DefaultRange    time.Duration
+	FocusHottest    bool
+	ShortIDMode     string
+	MaxExportBytes  int64
+	Locale          string
+	TZ              string
+	FileTZ          string
+
+	// Admin endpoints
+	APIKey   string
+	ReadOnly bool
+
+	Port string
 }
 
-// getContainerComparisonWithStats returns historical data with calculated statistics
-func getContainerComparisonWithStats(statsFiles []StatsFile, containerID string) ContainerComparisonWithStats {
-	comparison := getContainerComparison(statsFiles, containerID)
+// registerFlags defines a flag for every configuration field on fs, with the
+// field's default value
+func (c *Config) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Dir, "dir", "stats/", "directory to load stats files from, also passed to run.sh as STATS_DIR")
+	fs.StringVar(&c.Port, "port", "8080", "port to listen on")
+	fs.BoolVar(&c.Load.MergeSameTimestamp, "merge-same-timestamp", false, "merge stats files with identical timestamps into a single snapshot")
+	fs.StringVar(&c.Load.Archive, "archive", "", "load stats files from this tar.gz archive instead of the -dir directory")
+	fs.BoolVar(&c.Load.StrictFiles, "strict-files", false, "fail the load instead of skipping stats files that fail to parse")
+	fs.BoolVar(&c.Load.LowMemory, "low-memory", false, "keep only file names and timestamps in memory and re-read the stats files for each request")
+	fs.StringVar(&c.Load.ExcludeFiles, "exclude-files", "", "glob pattern of stats file names to skip when loading, e.g. '*_test_*'")
+	fs.StringVar(&c.ExcludeContainers, "exclude-containers", "", "comma-separated glob patterns of container names to drop when loading, e.g. 'k8s_POD_*,*-sidecar'")
+	fs.BoolVar(&c.HideSystem, "hide-system", false, "also drop well-known system containers such as pause containers and log shippers when loading")
+	fs.StringVar(&c.TemplatesDir, "templates-dir", "", "directory with index.html, container.html, summary.html, compare.html and network.html overriding the built-in templates")
+	fs.DurationVar(&c.StaleAfter, "stale-after", 15*time.Minute, "age relative to the newest file after which a container's last seen time is shown as stale")
+	fs.DurationVar(&c.OldAfter, "old-after", time.Hour, "age relative to the newest file after which a container's last seen time is shown as very old")
+	fs.Float64Var(&c.BaselineFactor, "baseline-factor", 2.0, "flag containers whose average CPU or memory exceeds this multiple of the fleet average")
+	fs.Float64Var(&c.EfficiencyCPUWeight, "efficiency-cpu-weight", 1.0, "weight of average CPU in the efficiency score")
+	fs.Float64Var(&c.EfficiencyMemWeight, "efficiency-mem-weight", 1.0, "weight of average memory limit utilization in the efficiency score")
+	fs.Float64Var(&c.BusyFloor, "busy-floor", 5.0, "CPU percentage a container's minimum must stay above to be classified as always busy")
+	fs.Float64Var(&c.Thresholds.CPU.Warn, "cpu-warn", defaultThresholds.CPU.Warn, "CPU percentage above which usage is highlighted as medium")
+	fs.Float64Var(&c.Thresholds.CPU.Crit, "cpu-crit", defaultThresholds.CPU.Crit, "CPU percentage above which usage is highlighted as high")
+	fs.Float64Var(&c.Thresholds.Mem.Warn, "mem-warn", defaultThresholds.Mem.Warn, "memory percentage above which usage is highlighted as medium")
+	fs.Float64Var(&c.Thresholds.Mem.Crit, "mem-crit", defaultThresholds.Mem.Crit, "memory percentage above which usage is highlighted as high")
+	fs.DurationVar(&c.RateGapAfter, "rate-gap-after", 15*time.Minute, "flag per-interval I/O rates spanning more than this as gaps (0 disables)")
+	fs.Float64Var(&c.GapFactor, "gap-factor", 2.0, "flag intervals longer than this multiple of a container's median sampling interval as collection gaps (0 disables)")
+	fs.DurationVar(&c.Refresh, "refresh", 5*time.Minute, "interval between automatic runs of run.sh and reloads of the stats files (0 disables run.sh entirely)")
+	fs.DurationVar(&c.RefreshTimeout, "refresh-timeout", 2*time.Minute, "kill run.sh if a refresh takes longer than this, so the next refresh can proceed (0 means no limit)")
+	fs.StringVar(&c.OnEmpty, "on-empty", "keep", "what to do when a refresh finds no stats files: keep the last good data or clear it")
+	fs.Int64Var(&c.MaxExportBytes, "max-export-bytes", 0, "truncate /api/export responses after this many bytes (0 means unlimited)")
+	fs.StringVar(&c.Columns, "columns", "", "comma-separated optional table columns to show: "+strings.Join(tableColumns, ",")+" (default all)")
+	fs.Float64Var(&c.Stats.CPUSpike, "cpu-spike", 80, "CPU percentage above which a data point counts as a spike in the summary")
+	fs.Float64Var(&c.Stats.MemSpike, "mem-spike", 80, "memory percentage above which a data point counts as a spike in the summary")
+	fs.IntVar(&c.Stats.AnomalyWindow, "anomaly-window", 20, "number of preceding data points a container's CPU is compared with to detect anomalies")
+	fs.Float64Var(&c.Stats.AnomalyZ, "anomaly-z", 3, "standard deviations from the preceding data points' mean at which a CPU value counts as an anomaly")
+	fs.DurationVar(&c.Stats.HalfLife, "recency-half-life", 6*time.Hour, "age at which a data point counts half as much in the recency-weighted summary averages")
+	fs.BoolVar(&c.Stats.SkipFirst, "skip-first", false, "leave each container's earliest data point out of summary and comparison statistics")
+	fs.IntVar(&c.PrecomputeWorkers, "precompute-workers", runtime.NumCPU(), "number of goroutines rendering container sparklines after each load (0 disables precomputing)")
+	fs.StringVar(&c.Locale, "locale", "en", "number formatting of the pages: "+strings.Join(localeNames(), ", ")+" (the APIs always use plain numbers)")
+	fs.StringVar(&c.TZ, "tz", "UTC", "time zone to show timestamps in, e.g. America/New_York or Local")
+	fs.StringVar(&c.FileTZ, "file-tz", "UTC", "time zone of the timestamps in the stats file names")
+	fs.IntVar(&c.SparklinePoints, "sparkline-points", 20, "number of snapshots in the dashboard CPU history sparklines")
+	fs.DurationVar(&c.DefaultRange, "default-range", 0, "limit pages and APIs to files within this duration of the newest file unless a request passes from/to or range (0 means all files)")
+	fs.BoolVar(&c.FocusHottest, "focus-hottest", false, "scroll the dashboard to the highest-CPU container of the selected file and highlight it (overridable with ?focus=0|1)")
+	fs.StringVar(&c.ShortIDMode, "short-id", "strict", "how to resolve a container ID prefix matching several containers: strict (409 with candidates) or latest (most recently seen)")
+	fs.StringVar(&c.APIKey, "api-key", "", "key required in the X-API-Key header for admin endpoints (empty disables the check)")
+	fs.BoolVar(&c.ReadOnly, "read-only", false, "reject all admin endpoints that change server state")
+	fs.BoolVar(&c.QueryAPI, "query-api", false, "enable /api/query for predefined aggregations grouped by container or time bucket")
+}
 
-	if len(comparison.Data) == 0 {
-		return ContainerComparisonWithStats{
-			ContainerComparison: comparison,
+// resolve checks the flag values and derives the settings they imply: the
+// container patterns to exclude when loading and the package-level number
+// format of the pages
+func (c *Config) resolve() error {
+	if c.OnEmpty != "keep" && c.OnEmpty != "clear" {
+		return fmt.Errorf("invalid -on-empty value %q, expected keep or clear", c.OnEmpty)
+	}
+	if c.ShortIDMode != "strict" && c.ShortIDMode != "latest" {
+		return fmt.Errorf("invalid -short-id value %q, expected strict or latest", c.ShortIDMode)
+	}
+	if c.Refresh < 0 {
+		return fmt.Errorf("invalid -refresh %v, expected a positive duration or 0", c.Refresh)
+	}
+	if c.Stats.HalfLife <= 0 {
+		return fmt.Errorf("invalid -recency-half-life %v, expected a positive duration", c.Stats.HalfLife)
+	}
+	if c.Stats.AnomalyWindow < minAnomalyHistory || c.Stats.AnomalyZ <= 0 {
+		return fmt.Errorf("invalid -anomaly-window %d or -anomaly-z %v, expected a window of at least %d and a positive z", c.Stats.AnomalyWindow, c.Stats.AnomalyZ, minAnomalyHistory)
+	}
+	if c.Load.LowMemory && (c.Load.Archive != "" || c.Load.MergeSameTimestamp) {
+		return fmt.Errorf("-low-memory cannot be combined with -archive or -merge-same-timestamp")
+	}
+	if _, err := filepath.Match(c.Load.ExcludeFiles, ""); err != nil {
+		return fmt.Errorf("invalid -exclude-files pattern %q: %v", c.Load.ExcludeFiles, err)
+	}
+	for _, pattern := range strings.Split(c.ExcludeContainers, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid -exclude-containers pattern %q: %v", pattern, err)
 		}
+		c.Load.ExcludeContainers = append(c.Load.ExcludeContainers, pattern)
 	}
+	if c.HideSystem {
+		c.Load.ExcludeContainers = append(c.Load.ExcludeContainers, systemContainerPatterns...)
+	}
+	format, ok := numberFormats[c.Locale]
+	if !ok {
+		return fmt.Errorf("invalid -locale value %q, expected one of %s", c.Locale, strings.Join(localeNames(), ", "))
+	}
+	displayFormat = format
+	var err error
+	if displayLocation, err = time.LoadLocation(c.TZ); err != nil {
+		return fmt.Errorf("invalid -tz value %q: %v", c.TZ, err)
+	}
+	if fileLocation, err = time.LoadLocation(c.FileTZ); err != nil {
+		return fmt.Errorf("invalid -file-tz value %q: %v", c.FileTZ, err)
+	}
+	return nil
+}
 
-	// Calculate statistics
-	var cpuValues, memValues []float64
-	for _, point := range comparison.Data {
-		cpuValues = append(cpuValues, point.CPUPerc)
-		memValues = append(memValues, point.MemPerc)
+// applyConfigFile sets the flags named by the keys of a JSON object file,
+// skipping those already given on the command line so they take precedence
+// over the file. Values may be strings, numbers or booleans, written as they
+// would be on the command line, e.g. "stale-after": "30m".
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("error parsing %s: %v", path, err)
 	}
 
-	// Calculate CPU stats
-	var cpuSum float64
-	maxCPU := cpuValues[0]
-	minCPU := cpuValues[0]
-	for _, cpu := range cpuValues {
-		cpuSum += cpu
-		if cpu > maxCPU {
-			maxCPU = cpu
+	setOnCommandLine := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		setOnCommandLine[f.Name] = true
+	})
+
+	for name, value := range values {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("unknown setting %q in %s", name, path)
 		}
-		if cpu < minCPU {
-			minCPU = cpu
+		if setOnCommandLine[name] {
+			continue
 		}
-	}
-	avgCPU := cpuSum / float64(len(cpuValues))
-
-	// Calculate Memory stats
-	var memSum float64
-	maxMem := memValues[0]
-	minMem := memValues[0]
-	for _, mem := range memValues {
-		memSum += mem
-		if mem > maxMem {
-			maxMem = mem
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		case float64:
+			str = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			str = strconv.FormatBool(v)
+		default:
+			return fmt.Errorf("setting %q in %s must be a string, number or boolean", name, path)
 		}
-		if mem < minMem {
-			minMem = mem
+		if err := fs.Set(name, str); err != nil {
+			return fmt.Errorf("invalid value for %q in %s: %v", name, path, err)
 		}
 	}
-	avgMem := memSum / float64(len(memValues))
-
-	return ContainerComparisonWithStats{
-		ContainerComparison: comparison,
-		AvgCPU:              avgCPU,
-		MaxCPU:              maxCPU,
-		MinCPU:              minCPU,
-		AvgMem:              avgMem,
-		MaxMem:              maxMem,
-		MinMem:              minMem,
-	}
+	return nil
 }
 
-// getAllContainerSummaries returns aggregated statistics for all containers across all files
-func getAllContainerSummaries(statsFiles []StatsFile) []ContainerSummary {
-	containerData := make(map[string][]ContainerDataPoint)
-	containerNames := make(map[string]string)
+// secretFlags lists the flags whose values are masked in /api/config
+var secretFlags = map[string]bool{
+	"api-key": true,
+}
 
-	// Collect all data points for each container
-	for _, statsFile := range statsFiles {
-		for _, stat := range statsFile.Stats {
-			// Parse CPU percentage
-			cpuStr := strings.TrimSuffix(stat.CPUPerc, "%")
-			cpuPerc, _ := strconv.ParseFloat(cpuStr, 64)
+// effectiveConfig returns the value of every command-line flag, with
+// secrets masked when set
+func effectiveConfig(flags *flag.FlagSet) map[string]string {
+	config := make(map[string]string)
+	flags.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			value = "********"
+		}
+		config[f.Name] = value
+	})
+	return config
+}
 
-			// Parse Memory percentage
-			memStr := strings.TrimSuffix(stat.MemPerc, "%")
-			memPerc, _ := strconv.ParseFloat(memStr, 64)
+// newJSONEncoder returns the encoder for a JSON API response, indenting
+// the output when the request asks for ?pretty=true
+func newJSONEncoder(w io.Writer, r *http.Request) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder
+}
 
-			dataPoint := ContainerDataPoint{
-				Timestamp: statsFile.Timestamp.Format("2006-01-02 15:04:05"),
-				CPUPerc:   cpuPerc,
-				MemPerc:   memPerc,
-				MemUsage:  stat.MemUsage,
-				NetIO:     stat.NetIO,
-				BlockIO:   stat.BlockIO,
-				PIDs:      stat.PIDs,
-			}
+// requireAdmin rejects state-changing requests when the server is read-only
+// or the request does not carry the configured API key. It reports whether
+// the request may proceed.
+func requireAdmin(w http.ResponseWriter, r *http.Request, apiKey string, readOnly bool) bool {
+	if readOnly {
+		http.Error(w, "Server is read-only", http.StatusForbidden)
+		return false
+	}
+	return requireAPIKey(w, r, apiKey)
+}
 
-			containerData[stat.ID] = append(containerData[stat.ID], dataPoint)
-			containerNames[stat.ID] = stat.Name
-		}
+// requireAPIKey rejects requests that do not carry the configured API key,
+// if one is set. It reports whether the request may proceed.
+func requireAPIKey(w http.ResponseWriter, r *http.Request, apiKey string) bool {
+	if apiKey != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-API-Key")), []byte(apiKey)) != 1 {
+		http.Error(w, "Invalid or missing API key", http.StatusUnauthorized)
+		return false
 	}
+	return true
+}
 
-	// Calculate statistics for each container
-	var summaries []ContainerSummary
-	for containerID, dataPoints := range containerData {
-		if len(dataPoints) == 0 {
-			continue
-		}
+// validFileName reports whether name can only refer to a file directly
+// inside the stats directory
+func validFileName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && !strings.Contains(name, "..")
+}
 
-		// Sort data points by timestamp
-		sort.Slice(dataPoints, func(i, j int) bool {
-			t1, _ := time.Parse("2006-01-02 15:04:05", dataPoints[i].Timestamp)
-			t2, _ := time.Parse("2006-01-02 15:04:05", dataPoints[j].Timestamp)
-			return t1.Before(t2)
-		})
+// apiTimeLayout returns the timestamp layout requested with the ts query
+// parameter: RFC3339 by default, or the human readable format with ts=human
+func apiTimeLayout(r *http.Request) (string, error) {
+	switch r.URL.Query().Get("ts") {
+	case "", "rfc3339":
+		return time.RFC3339, nil
+	case "human":
+		return humanTimeLayout, nil
+	default:
+		return "", fmt.Errorf("invalid ts parameter %q, expected rfc3339 or human", r.URL.Query().Get("ts"))
+	}
+}
 
-		// Calculate CPU statistics
-		var cpuSum float64
-		maxCPU := dataPoints[0].CPUPerc
-		minCPU := dataPoints[0].CPUPerc
-		for _, point := range dataPoints {
-			cpuSum += point.CPUPerc
-			if point.CPUPerc > maxCPU {
-				maxCPU = point.CPUPerc
-			}
-			if point.CPUPerc < minCPU {
-				minCPU = point.CPUPerc
-			}
+// sparklineColor is the line color of rendered sparklines
+var sparklineColor = color.RGBA{R: 0x64, G: 0xb5, B: 0xf6, A: 0xff}
+
+// renderSparkline draws the values as a line on a transparent PNG of the
+// given size, scaled between the smallest and largest value
+func renderSparkline(values []float64, width, height int) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if len(values) > 0 {
+		low, high := values[0], values[0]
+		for _, value := range values {
+			low = math.Min(low, value)
+			high = math.Max(high, value)
 		}
-		avgCPU := cpuSum / float64(len(dataPoints))
 
-		// Calculate Memory statistics
-		var memSum float64
-		maxMem := dataPoints[0].MemPerc
-		minMem := dataPoints[0].MemPerc
-		for _, point := range dataPoints {
-			memSum += point.MemPerc
-			if point.MemPerc > maxMem {
-				maxMem = point.MemPerc
+		// Map each value to a pixel, with a flat series along the middle
+		y := func(value float64) int {
+			if high == low {
+				return height / 2
 			}
-			if point.MemPerc < minMem {
-				minMem = point.MemPerc
+			return int(math.Round((high - value) / (high - low) * float64(height-1)))
+		}
+		x := func(i int) int {
+			if len(values) == 1 {
+				return width / 2
 			}
+			return int(math.Round(float64(i) / float64(len(values)-1) * float64(width-1)))
 		}
-		avgMem := memSum / float64(len(dataPoints))
 
-		summary := ContainerSummary{
-			ContainerID:   containerID,
-			ContainerName: containerNames[containerID],
-			DataPoints:    len(dataPoints),
-			AvgCPU:        avgCPU,
-			MaxCPU:        maxCPU,
-			MinCPU:        minCPU,
-			AvgMem:        avgMem,
-			MaxMem:        maxMem,
-			MinMem:        minMem,
-			FirstSeen:     dataPoints[0].Timestamp,
-			LastSeen:      dataPoints[len(dataPoints)-1].Timestamp,
+		img.Set(x(0), y(values[0]), sparklineColor)
+		for i := 1; i < len(values); i++ {
+			drawLine(img, x(i-1), y(values[i-1]), x(i), y(values[i]), sparklineColor)
 		}
+	}
 
-		summaries = append(summaries, summary)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	// Sort by average CPU usage (descending)
-	sort.Slice(summaries, func(i, j int) bool {
-		return summaries[i].AvgCPU > summaries[j].AvgCPU
-	})
+// drawLine draws a line between two points using Bresenham's algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := x1-x0, -(y1 - y0)
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy > 0 {
+		dy = -dy
+	}
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			x0 += sx
+		} else {
+			err += dx
+			y0 += sy
+		}
+	}
+}
 
-	return summaries
+// SparklineCache holds rendered sparkline PNGs for one version of the data
+type SparklineCache struct {
+	mu      sync.Mutex
+	version int
+	images  map[string][]byte
 }
 
-const htmlTemplate = `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Docker Stats Viewer</title>
-    <style>
-        body {
-            font-family: Arial, sans-serif;
-            margin: 20px;
-            background-color: #121212;
-            color: #e0e0e0;
-        }
-        table {
-            border-collapse: collapse;
-            width: 100%;
-            margin-top: 20px;
-            background-color: #1e1e1e;
-            color: #e0e0e0;
-        }
-        th, td {
-            border: 1px solid #333;
-            padding: 8px;
-            text-align: left;
-        }
-        th {
-            background-color: #333;
-            cursor: pointer;
-            user-select: none;
-        }
-        th:hover {
-            background-color: #444;
-        }
-        select {
-            padding: 5px;
-            margin: 10px 0;
-            background-color: #1e1e1e;
-            color: #e0e0e0;
-            border: 1px solid #333;
-        }
-        .stats-summary {
-            background: #1e1e1e;
-            padding: 15px;
-            margin: 10px 0;
-            border-radius: 5px;
-            border: 1px solid #333;
-        }
-        .high-usage {
-            background-color: #ff5252;
-        }
-        .medium-usage {
-            background-color: #ffb74d;
-        }
-        .modal {
-            display: none;
-            position: fixed;
-            z-index: 1000;
-            left: 0;
-            top: 0;
-            width: 100%;
-            height: 100%;
-            background-color: rgba(0, 0, 0, 0.8);
-            overflow-y: auto;
-        }
-        .modal-content {
-            background-color: #1e1e1e;
-            margin: 0;
-            padding: 20px;
-            width: 100%;
-            height: 100%;
-            position: relative;
-            box-sizing: border-box;
-            color: #e0e0e0;
-        }
-        .close {
-            color: #aaa;
-            float: right;
-            font-size: 28px;
-            font-weight: bold;
-            cursor: pointer;
-            position: fixed;
-            right: 25px;
-            top: 20px;
-            background: #333;
-            border: 2px solid #555;
-            border-radius: 50%;
-            width: 40px;
-            height: 40px;
-            display: flex;
-            align-items: center;
-            justify-content: center;
-            z-index: 1001;
-        }
-        .close:hover,
-        .close:focus {
-            color: white;
-        }
-        .clickable-id {
-            color: #64b5f6;
-            cursor: pointer;
-            text-decoration: underline;
-        }
-        .clickable-id:hover {
-            color: #42a5f5;
-        }
-        .loading {
-            text-align: center;
-            padding: 20px;
-        }
-    </style>
-</head>
-<body>
-    <h1>Docker Stats Viewer</h1>
-    
-    <div style="margin-bottom: 20px; display: flex; gap: 10px; align-items: center;">
-        <a href="/summary" style="background: #64b5f6; color: white; padding: 10px 20px; text-decoration: none; border-radius: 5px;">View Summary Report</a>
-        <button id="runScriptBtn" style="background: #43a047; color: white; padding: 10px 20px; border: none; border-radius: 5px; cursor: pointer;">Run Stats Script</button>
-        <span id="runScriptStatus" style="margin-left: 10px;"></span>
-    </div>
-    
-    <div class="stats-summary">
-        <h3>File: {{.SelectedFile.Name}}</h3>
-        <p>Timestamp: {{.SelectedFile.Timestamp.Format "2006-01-02 15:04:05"}}</p>
-        <p>Total containers: {{len .SelectedFile.Stats}}</p>
-    </div>
+func newSparklineCache() *SparklineCache {
+	return &SparklineCache{images: make(map[string][]byte)}
+}
 
-    <form method="GET">
-        <label for="file">Select stats file:</label>
-        <select name="file" id="file" onchange="this.form.submit()">
-            {{range $i, $file := .Files}}
-            <option value="{{$i}}" {{if eq $i $.SelectedIndex}}selected{{end}}>
-                {{$file.Name}} ({{$file.Timestamp.Format "2006-01-02 15:04:05"}})
-            </option>
-            {{end}}
-        </select>
-    </form>
+// Get returns the cached image for the key, rendering and storing it on a
+// miss. A new data version drops all previously rendered images.
+func (c *SparklineCache) Get(version int, key string, render func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-    <div style="margin: 10px 0;">
-        <label for="searchInput">Search by container name:</label>
-        <input type="text" id="searchInput" placeholder="Enter container name..." onkeyup="filterTable()" style="padding: 5px; margin-left: 10px; width: 250px; background-color: #1e1e1e; color: #e0e0e0; border: 1px solid #333;">
-        <button onclick="clearSearch()" style="margin-left: 5px; padding: 5px 10px; background-color: #64b5f6; color: white; border: none; border-radius: 3px;">Clear</button>
-    </div>
+	if c.version != version {
+		c.version = version
+		c.images = make(map[string][]byte)
+	}
+	if img, ok := c.images[key]; ok {
+		return img, nil
+	}
+	img, err := render()
+	if err != nil {
+		return nil, err
+	}
+	c.images[key] = img
+	return img, nil
+}
 
-    <table id="statsTable">
-        <thead>
-            <tr>
-                <th onclick="sortTable(0)">Container Name</th>
-                <th onclick="sortTable(1)">ID</th>
-                <th onclick="sortTable(2)">CPU %</th>
-                <th onclick="sortTable(3)">Memory %</th>
-                <th onclick="sortTable(4)">Memory Usage</th>
-                <th onclick="sortTable(5)">Network I/O</th>
-                <th onclick="sortTable(6)">Block I/O</th>
-                <th onclick="sortTable(7)">PIDs</th>
-            </tr>
-        </thead>
-        <tbody>
-            {{range .SelectedFile.Stats}}
-            <tr class="{{if gt (parseFloat .MemPerc) 80.0}}high-usage{{else if gt (parseFloat .MemPerc) 50.0}}medium-usage{{end}}">
-                <td>{{.Name}}</td>
-                <td><a href="/container/{{.ID}}" class="clickable-id">{{.ID}}</a></td>
-                <td>{{.CPUPerc}}</td>
-                <td>{{.MemPerc}}</td>
-                <td>{{.MemUsage}}</td>
-                <td>{{.NetIO}}</td>
-                <td>{{.BlockIO}}</td>
-                <td>{{.PIDs}}</td>
-            </tr>
-            {{end}}
-        </tbody>
-    </table>
+// Fill adds images rendered ahead of time for a data version in one step, so
+// readers see either none or all of them. Images for a version older than
+// the cached one are dropped.
+func (c *SparklineCache) Fill(version int, images map[string][]byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-    <!-- Modal -->
-    <div id="comparisonModal" class="modal">
-        <div class="modal-content">
-            <span class="close" onclick="closeModal()">&times;</span>
-            <div id="modalContent">
-                <div class="loading">Loading...</div>
-            </div>
-        </div>
-    </div>
+	switch {
+	case version < c.version:
+		return
+	case version > c.version:
+		c.version = version
+		c.images = images
+		return
+	}
+	for key, img := range images {
+		if _, ok := c.images[key]; !ok {
+			c.images[key] = img
+		}
+	}
+}
 
-    <script>
-        document.addEventListener('DOMContentLoaded', function() {
-            const btn = document.getElementById('runScriptBtn');
-            const status = document.getElementById('runScriptStatus');
-            if (btn) {
-                btn.onclick = async function() {
-                    status.textContent = 'Running...';
-                    status.style.color = '#ffb74d';
-                    try {
-                        const resp = await fetch('/api/run-script', {method: 'POST'});
-                        const data = await resp.json();
-                        if (data.success) {
-                            status.textContent = 'Script ran successfully!';
-                            status.style.color = '#43a047';
-                            setTimeout(() => location.reload(), 800);
-                        } else {
-                            status.textContent = 'Error: ' + (data.error || 'Unknown error');
-                            status.style.color = '#ff5252';
-                        }
-                    } catch (e) {
-                        status.textContent = 'Request failed';
-                        status.style.color = '#ff5252';
-                    }
-                }
-            }
-        });
-        let sortDirection = {};
-        
-        function sortTable(columnIndex) {
-            const table = document.getElementById('statsTable');
-            const tbody = table.querySelector('tbody');
-            const rows = Array.from(tbody.querySelectorAll('tr')).filter(row => row.style.display !== 'none');
-            
-            const isNumeric = (str) => {
-                if (columnIndex === 2 || columnIndex === 3) { // CPU % or Memory %
-                    return !isNaN(parseFloat(str.replace('%', '')));
-                }
-                return !isNaN(parseFloat(str));
-            };
-            
-            const getValue = (row, index) => {
-                let value = row.cells[index].textContent.trim();
-                if (columnIndex === 2 || columnIndex === 3) {
-                    return parseFloat(value.replace('%', '')) || 0;
-                }
-                return isNumeric(value) ? parseFloat(value) : value.toLowerCase();
-            };
-            
-            const currentDirection = sortDirection[columnIndex] || 'asc';
-            const newDirection = currentDirection === 'asc' ? 'desc' : 'asc';
-            sortDirection[columnIndex] = newDirection;
-            
-            rows.sort((a, b) => {
-                const aVal = getValue(a, columnIndex);
-                const bVal = getValue(b, columnIndex);
-                
-                let comparison = 0;
-                if (aVal < bVal) comparison = -1;
-                else if (aVal > bVal) comparison = 1;
-                
-                return newDirection === 'asc' ? comparison : -comparison;
-            });
-            
-            // Reorder rows
-            rows.forEach(row => tbody.appendChild(row));
-        }
+// Default size of the container sparkline images
+const (
+	sparklineWidth  = 100
+	sparklineHeight = 20
+)
 
-        function filterTable() {
-            const input = document.getElementById('searchInput');
-            const filter = input.value.toLowerCase();
-            const table = document.getElementById('statsTable');
-            const tbody = table.querySelector('tbody');
-            const rows = tbody.querySelectorAll('tr');
-            
-            rows.forEach(row => {
-                const containerName = row.cells[0].textContent.toLowerCase();
-                if (containerName.includes(filter)) {
-                    row.style.display = '';
-                } else {
-                    row.style.display = 'none';
-                }
-            });
-        }
+// sparklineKey identifies a rendered sparkline in the cache. The scope holds
+// the request's time range parameters, empty for the default range.
+func sparklineKey(containerID, metric string, width, height int, scope string) string {
+	return fmt.Sprintf("%s/%s/%dx%d/%s", containerID, metric, width, height, scope)
+}
 
-        function clearSearch() {
-            document.getElementById('searchInput').value = '';
-            filterTable();
-        }
+// precomputeSparklines renders the default-size CPU sparkline of every
+// container with up to workers goroutines and fills the cache with the
+// complete set once all are done
+func precomputeSparklines(cache *SparklineCache, statsFiles []StatsFile, version, workers int) {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, statsFile := range statsFiles {
+		for _, stat := range statsFile.Stats {
+			if !seen[stat.ID] {
+				seen[stat.ID] = true
+				ids = append(ids, stat.ID)
+			}
+		}
+	}
 
-        function openModal(containerId) {
-            const modal = document.getElementById('comparisonModal');
-            const modalContent = document.getElementById('modalContent');
-            
-            modal.style.display = 'block';
-            modalContent.innerHTML = '<div class="loading">Loading comparison data...</div>';
-            
-            // Fetch comparison data
-            fetch('/api/container/' + containerId)
-                .then(response => response.json())
-                .then(data => {
-                    displayComparisonData(data);
-                })
-                .catch(error => {
-                    modalContent.innerHTML = '<div style="color: red;">Error loading data: ' + error.message + '</div>';
-                });
-        }
+	images := make(map[string][]byte, len(ids))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan string)
+	for i := 0; i < min(workers, len(ids)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				values, _ := dataPointValues(getContainerComparison(statsFiles, id).Data, "cpu")
+				img, err := renderSparkline(values, sparklineWidth, sparklineHeight)
+				if err != nil {
+					log.Printf("Sparkline error for %s: %v", id, err)
+					continue
+				}
+				mu.Lock()
+				images[sparklineKey(id, "cpu", sparklineWidth, sparklineHeight, "")] = img
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, id := range ids {
+		jobs <- id
+	}
+	close(jobs)
+	wg.Wait()
 
-        function closeModal() {
-            document.getElementById('comparisonModal').style.display = 'none';
-        }
+	cache.Fill(version, images)
+}
 
-        function displayComparisonData(data) {
-            const modalContent = document.getElementById('modalContent');
-            
-            if (!data.data || data.data.length === 0) {
-                modalContent.innerHTML = '<h3>No historical data found for container: ' + data.container_id + '</h3>';
-                return;
-            }
+// ComparedSeries is one container's CPU and memory series aligned to shared
+// timestamps. Both are nil at timestamps where the container has no data
+// point.
+type ComparedSeries struct {
+	ContainerID   string     `json:"container_id"`
+	ContainerName string     `json:"container_name"`
+	CPU           []*float64 `json:"cpu"`
+	Mem           []*float64 `json:"mem"`
+}
 
-            let html = '<h1>Container Historical Analysis</h1>';
-            html += '<div style="background: #f8f9fa; padding: 15px; border-radius: 5px; margin-bottom: 20px;">';
-            html += '<h3>Container Information</h3>';
-            html += '<p><strong>Container Name:</strong> ' + (data.container_name || 'Unknown') + '</p>';
-            html += '<p><strong>Container ID:</strong> ' + data.container_id + '</p>';
-            html += '<p><strong>Total Data Points:</strong> ' + data.data.length + '</p>';
-            html += '</div>';
+// AlignedComparison holds the series of several containers aligned on
+// the union of their timestamps, so every series has the same length
+type AlignedComparison struct {
+	Timestamps []string         `json:"timestamps"`
+	Series     []ComparedSeries `json:"series"`
+}
 
-            html += '<table class="comparison-table">';
-            html += '<thead><tr>';
-            html += '<th>Timestamp</th>';
-            html += '<th>CPU %</th>';
-            html += '<th>Memory %</th>';
-            html += '<th>Memory Usage</th>';
-            html += '<th>Network I/O</th>';
-            html += '<th>Block I/O</th>';
-            html += '<th>PIDs</th>';
-            html += '</tr></thead>';
-            html += '<tbody>';
+// alignComparisons aligns the oldest-first data points of the comparisons on
+// the union of their timestamps, leaving gaps where a container has no point
+func alignComparisons(comparisons []ContainerComparison, timeLayout string) AlignedComparison {
+	var times []time.Time
+	seen := make(map[time.Time]bool)
+	for _, comparison := range comparisons {
+		for _, point := range comparison.Data {
+			if !seen[point.Time] {
+				seen[point.Time] = true
+				times = append(times, point.Time)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
 
-            data.data.forEach(point => {
-                const cpuClass = point.cpu_perc > 80 ? 'metric-high' : point.cpu_perc > 50 ? 'metric-medium' : 'metric-low';
-                const memClass = point.mem_perc > 80 ? 'metric-high' : point.mem_perc > 50 ? 'metric-medium' : 'metric-low';
-                
-                html += '<tr>';
-                html += '<td>' + point.timestamp + '</td>';
-                html += '<td class="' + cpuClass + '">' + point.cpu_perc.toFixed(2) + '%</td>';
-                html += '<td class="' + memClass + '">' + point.mem_perc.toFixed(2) + '%</td>';
-                html += '<td>' + (point.mem_usage || 'N/A') + '</td>';
-                html += '<td>' + (point.net_io || 'N/A') + '</td>';
-                html += '<td>' + (point.block_io || 'N/A') + '</td>';
-                html += '<td>' + (point.pids || 'N/A') + '</td>';
-                html += '</tr>';
-            });
+	aligned := AlignedComparison{Timestamps: make([]string, len(times))}
+	position := make(map[time.Time]int, len(times))
+	for i, t := range times {
+		aligned.Timestamps[i] = t.Format(timeLayout)
+		position[t] = i
+	}
 
-            html += '</tbody></table>';
+	for _, comparison := range comparisons {
+		series := ComparedSeries{
+			ContainerID:   comparison.ContainerID,
+			ContainerName: comparison.ContainerName,
+			CPU:           make([]*float64, len(times)),
+			Mem:           make([]*float64, len(times)),
+		}
+		for _, point := range comparison.Data {
+			cpuPerc, memPerc := point.CPUPerc, point.MemPerc
+			series.CPU[position[point.Time]] = &cpuPerc
+			series.Mem[position[point.Time]] = &memPerc
+		}
+		aligned.Series = append(aligned.Series, series)
+	}
+	return aligned
+}
 
-            // Calculate averages
-            const avgCpu = data.data.reduce((sum, point) => sum + point.cpu_perc, 0) / data.data.length;
-            const avgMem = data.data.reduce((sum, point) => sum + point.mem_perc, 0) / data.data.length;
-            const maxCpu = Math.max(...data.data.map(point => point.cpu_perc));
-            const maxMem = Math.max(...data.data.map(point => point.mem_perc));
-            const minCpu = Math.min(...data.data.map(point => point.cpu_perc));
-            const minMem = Math.min(...data.data.map(point => point.mem_perc));
+// reverseDataPoints puts a comparison's data points newest first, keeping
+// the gap indexes and the moving max aligned with the same data points
+func reverseDataPoints(comparison *ContainerComparison) {
+	last := len(comparison.Data) - 1
+	for i := 0; i < len(comparison.Data)/2; i++ {
+		comparison.Data[i], comparison.Data[last-i] = comparison.Data[last-i], comparison.Data[i]
+	}
+	for i := range comparison.Gaps {
+		comparison.Gaps[i].Index = last - comparison.Gaps[i].Index
+	}
+	for i := 0; i < len(comparison.CPUMovingMax)/2; i++ {
+		comparison.CPUMovingMax[i], comparison.CPUMovingMax[last-i] = comparison.CPUMovingMax[last-i], comparison.CPUMovingMax[i]
+	}
+}
 
-            html += '<div style="margin-top: 30px; background: #f8f9fa; padding: 20px; border-radius: 5px;">';
-            html += '<h3>Summary Statistics</h3>';
-            html += '<div style="display: grid; grid-template-columns: repeat(2, 1fr); gap: 20px;">';
-            html += '<div>';
-            html += '<h4>CPU Usage</h4>';
-            html += '<p><strong>Average:</strong> ' + avgCpu.toFixed(2) + '%</p>';
-            html += '<p><strong>Peak:</strong> ' + maxCpu.toFixed(2) + '%</p>';
-            html += '<p><strong>Minimum:</strong> ' + minCpu.toFixed(2) + '%</p>';
-            html += '</div>';
-            html += '<div>';
-            html += '<h4>Memory Usage</h4>';
-            html += '<p><strong>Average:</strong> ' + avgMem.toFixed(2) + '%</p>';
-            html += '<p><strong>Peak:</strong> ' + maxMem.toFixed(2) + '%</p>';
-            html += '<p><strong>Minimum:</strong> ' + minMem.toFixed(2) + '%</p>';
-            html += '</div>';
-            html += '</div>';
-            html += '</div>';
+// stripRawValues drops the original docker stats strings from data points
+func stripRawValues(dataPoints []ContainerDataPoint) {
+	for i := range dataPoints {
+		dataPoints[i].CPUPercRaw = ""
+		dataPoints[i].MemPercRaw = ""
+	}
+}
 
-            modalContent.innerHTML = html;
-        }
+// formatDataPointTimestamps rewrites the display timestamps of the data
+// points using the given layout
+func formatDataPointTimestamps(dataPoints []ContainerDataPoint, timeLayout string) {
+	for i := range dataPoints {
+		dataPoints[i].Timestamp = dataPoints[i].Time.Format(timeLayout)
+	}
+}
 
-        // Close modal with Escape key
-        document.addEventListener('keydown', function(event) {
-            if (event.key === 'Escape') {
-                closeModal();
-            }
-        });
-    </script>
-</body>
-</html>
-`
+// parsePercent parses a docker percentage string such as "12.5%"
+func parsePercent(s string) float64 {
+	val, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	return val
+}
 
-const containerPageTemplate = `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Container Details - {{.ContainerName}}</title>
-    <style>
-        body { font-family: Arial, sans-serif; margin: 20px; background-color: #121212; color: #e0e0e0; }
-        .back-link { 
-            display: inline-block; 
-            margin-bottom: 20px; 
-            color: #64b5f6; 
-            text-decoration: none; 
-            padding: 8px 15px;
-            border: 1px solid #64b5f6;
-            border-radius: 4px;
-        }
-        .back-link:hover { 
-            background-color: #64b5f6; 
-            color: white; 
-        }
-        .container-info { 
-            background: #1e1e1e; 
-            padding: 20px; 
-            border-radius: 5px; 
-            margin-bottom: 30px; 
-            border: 1px solid #333;
-        }
-        .stats-grid { 
-            display: grid; 
-            grid-template-columns: repeat(2, 1fr); 
-            gap: 30px; 
-            margin-bottom: 30px; 
-        }
-        .stats-card { 
-            background: #1e1e1e; 
-            padding: 20px; 
-            border-radius: 5px; 
-            border: 1px solid #333;
-        }
-        table { 
-            border-collapse: collapse; 
-            width: 100%; 
-            margin-top: 20px; 
-            background-color: #1e1e1e;
-            color: #e0e0e0;
-        }
-        th, td { 
-            border: 1px solid #333; 
-            padding: 8px; 
-            text-align: left; 
-        }
-        th { 
-            background-color: #333; 
-            position: sticky; 
-            top: 0; 
-            z-index: 10; 
-        }
-        .metric-high { color: #dc3545; font-weight: bold; }
-        .metric-medium { color: #fd7e14; }
-        .metric-low { color: #28a745; }
-        .no-data {
-            text-align: center;
-            padding: 40px;
-            color: #6c757d;
-            background: #1e1e1e;
-            border-radius: 5px;
-        }
-    </style>
-</head>
-<body>
-    <a href="/" class="back-link"><- Back to Dashboard</a>
-    
-    <h1>Container Historical Analysis</h1>
-    
-    {{if .Data}}
-    <div class="container-info">
-        <h2>Container Information</h2>
-        <p><strong>Container Name:</strong> {{.ContainerName}}</p>
-        <p><strong>Container ID:</strong> {{.ContainerID}}</p>
-        <p><strong>Total Data Points:</strong> {{len .Data}}</p>
-        <p><strong>Data Range:</strong> {{(index .Data 0).Timestamp}} to {{(index .Data (sub (len .Data) 1)).Timestamp}}</p>
-    </div>
+// byteUnits maps the size suffixes used by docker stats to their multipliers
+var byteUnits = map[string]float64{
+	"B":   1,
+	"kB":  1e3,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
 
-    <div class="stats-grid">
-        <div class="stats-card">
-            <h3>CPU Usage Statistics</h3>
-            <p><strong>Average:</strong> {{printf "%.2f" .AvgCPU}}%</p>
-            <p><strong>Peak:</strong> {{printf "%.2f" .MaxCPU}}%</p>
-            <p><strong>Minimum:</strong> {{printf "%.2f" .MinCPU}}%</p>
-        </div>
-        <div class="stats-card">
-            <h3>Memory Usage Statistics</h3>
-            <p><strong>Average:</strong> {{printf "%.2f" .AvgMem}}%</p>
-            <p><strong>Peak:</strong> {{printf "%.2f" .MaxMem}}%</p>
-            <p><strong>Minimum:</strong> {{printf "%.2f" .MinMem}}%</p>
-        </div>
-    </div>
+// parseBytes parses a docker stats size such as "1.488MiB" or "900B"
+func parseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", s, err)
+	}
+	multiplier, ok := byteUnits[strings.TrimSpace(s[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+	return int64(value * multiplier), nil
+}
 
-    <h2>Historical Data</h2>
-    <table>
-        <thead>
-            <tr>
-                <th>Timestamp</th>
-                <th>CPU %</th>
-                <th>Memory %</th>
-                <th>Memory Usage</th>
-                <th>Network I/O</th>
-                <th>Block I/O</th>
-                <th>PIDs</th>
-            </tr>
-        </thead>
-        <tbody>
-            {{range .Data}}
-            <tr>
-                <td>{{.Timestamp}}</td>
-                <td class="{{if gt .CPUPerc 80.0}}metric-high{{else if gt .CPUPerc 50.0}}metric-medium{{else}}metric-low{{end}}">{{printf "%.2f" .CPUPerc}}%</td>
-                <td class="{{if gt .MemPerc 80.0}}metric-high{{else if gt .MemPerc 50.0}}metric-medium{{else}}metric-low{{end}}">{{printf "%.2f" .MemPerc}}%</td>
-                <td>{{.MemUsage}}</td>
-                <td>{{.NetIO}}</td>
-                <td>{{.BlockIO}}</td>
-                <td>{{.PIDs}}</td>
-            </tr>
-            {{end}}
-        </tbody>
-    </table>
-    {{else}}
-    <div class="no-data">
-        <h3>No Historical Data Found</h3>
-        <p>No data points were found for container ID: <strong>{{.ContainerID}}</strong></p>
-        <p>This could mean the container was recently created or the statistics haven't been collected yet.</p>
-    </div>
-    {{end}}
-</body>
-</html>
-`
+// parseIOPair parses an "in / out" pair of sizes such as a NetIO or
+// BlockIO value. Spaces around the slash and between a number and its unit
+// ("1.5 kB") are accepted; anything else unexpected is an error.
+func parseIOPair(s string) (in, out int64, err error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid I/O pair %q", s)
+	}
+	if in, err = parseBytes(parts[0]); err != nil {
+		return 0, 0, err
+	}
+	if out, err = parseBytes(parts[1]); err != nil {
+		return 0, 0, err
+	}
+	return in, out, nil
+}
 
-const summaryPageTemplate = `
-<!DOCTYPE html>
-<html>
-<head>
-    <title>Container Summary - All Files Analysis</title>
-    <style>
-        body { font-family: Arial, sans-serif; margin: 20px; background-color: #121212; color: #e0e0e0; }
-        .back-link { 
-            display: inline-block; 
-            margin-bottom: 20px; 
-            color: #64b5f6; 
-            text-decoration: none; 
-            padding: 8px 15px;
-            border: 1px solid #64b5f6;
-            border-radius: 4px;
-        }
-        .back-link:hover { 
-            background-color: #64b5f6; 
-            color: white; 
-        }
-        .summary-info { 
-            background: #1e1e1e; 
-            padding: 20px; 
-            border-radius: 5px; 
-            margin-bottom: 30px; 
-            border: 1px solid #333;
+// parseMemUsage parses a docker MemUsage value such as "1.2GiB / 3.8GiB"
+// into the used and limit bytes
+func parseMemUsage(s string) (usedBytes, limitBytes int64, err error) {
+	usedBytes, limitBytes, err = parseIOPair(s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid memory usage %q: %v", s, err)
+	}
+	return usedBytes, limitBytes, nil
+}
+
+// malformedValues records the MemUsage, NetIO and BlockIO values already
+// logged as malformed, so each is only warned about once rather than on
+// every request
+var malformedValues sync.Map
+
+// warnMalformed logs a parse error for a container's stat once per value
+func warnMalformed(value string, err error, stat DockerStat, statsFile StatsFile) {
+	if _, logged := malformedValues.LoadOrStore(value, true); !logged {
+		log.Printf("Warning: %v for container %s in %s", err, stat.ID, statsFile.Name)
+	}
+}
+
+// newDataPoint converts a container's stat in a stats file into a data point
+func newDataPoint(statsFile StatsFile, stat DockerStat) ContainerDataPoint {
+	// Parse CPU percentage
+	cpuStr := strings.TrimSuffix(stat.CPUPerc, "%")
+	cpuPerc, _ := strconv.ParseFloat(cpuStr, 64)
+
+	// Parse Memory percentage
+	memStr := strings.TrimSuffix(stat.MemPerc, "%")
+	memPerc, _ := strconv.ParseFloat(memStr, 64)
+
+	used, limit, err := parseMemUsage(stat.MemUsage)
+	if err != nil {
+		warnMalformed(stat.MemUsage, err, stat, statsFile)
+	}
+	netIn, netOut, netErr := parseIOPair(stat.NetIO)
+	if netErr != nil {
+		warnMalformed(stat.NetIO, netErr, stat, statsFile)
+	}
+	blockRead, blockWrite, blockErr := parseIOPair(stat.BlockIO)
+	if blockErr != nil {
+		warnMalformed(stat.BlockIO, blockErr, stat, statsFile)
+	}
+
+	return ContainerDataPoint{
+		Timestamp:       statsFile.Timestamp.Format(humanTimeLayout),
+		Time:            statsFile.Timestamp,
+		CPUPerc:         cpuPerc,
+		MemPerc:         memPerc,
+		MemUsage:        stat.MemUsage,
+		NetIO:           stat.NetIO,
+		BlockIO:         stat.BlockIO,
+		PIDs:            stat.PIDs,
+		MemUsedBytes:    used,
+		MemLimitBytes:   limit,
+		NetInBytes:      netIn,
+		NetOutBytes:     netOut,
+		NetIOValid:      netErr == nil,
+		BlockReadBytes:  blockRead,
+		BlockWriteBytes: blockWrite,
+		BlockIOValid:    blockErr == nil,
+		CPUPercRaw:      stat.CPUPerc,
+		MemPercRaw:      stat.MemPerc,
+	}
+}
+
+// counterDelta returns how far a cumulative counter moved between two
+// samples. A drop means the counter was reset, for example by a container
+// restart, so the later value counts as moved since the reset.
+func counterDelta(prev, cur int64) int64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	return cur
+}
+
+// counterTotal returns the amount a cumulative counter moved over the given
+// samples
+func counterTotal(values []int64) int64 {
+	var total int64
+	for i := 1; i < len(values); i++ {
+		total += counterDelta(values[i-1], values[i])
+	}
+	return total
+}
+
+// IntervalRate holds the I/O rates in bytes per second between two
+// consecutive data points of a container
+type IntervalRate struct {
+	From           string  `json:"from"`
+	To             string  `json:"to"`
+	Seconds        float64 `json:"seconds"`
+	NetInRate      float64 `json:"net_in_rate"`
+	NetOutRate     float64 `json:"net_out_rate"`
+	BlockReadRate  float64 `json:"block_read_rate"`
+	BlockWriteRate float64 `json:"block_write_rate"`
+	// Gap is set when the interval is longer than the rate gap threshold,
+	// so the rate is averaged over missed collection cycles
+	Gap bool `json:"gap"`
+}
+
+// intervalRates returns the I/O rates between each pair of consecutive
+// oldest-first data points. Intervals longer than gapAfter are flagged as
+// gaps, and pairs whose counters cannot be parsed are skipped.
+func intervalRates(dataPoints []ContainerDataPoint, gapAfter time.Duration, timeLayout string) []IntervalRate {
+	rates := []IntervalRate{}
+	for i := 1; i < len(dataPoints); i++ {
+		prev, cur := dataPoints[i-1], dataPoints[i]
+		interval := cur.Time.Sub(prev.Time)
+		if interval <= 0 {
+			continue
+		}
+		if !prev.NetIOValid || !prev.BlockIOValid || !cur.NetIOValid || !cur.BlockIOValid {
+			continue
+		}
+
+		seconds := interval.Seconds()
+		rates = append(rates, IntervalRate{
+			From:           prev.Time.Format(timeLayout),
+			To:             cur.Time.Format(timeLayout),
+			Seconds:        seconds,
+			NetInRate:      float64(counterDelta(prev.NetInBytes, cur.NetInBytes)) / seconds,
+			NetOutRate:     float64(counterDelta(prev.NetOutBytes, cur.NetOutBytes)) / seconds,
+			BlockReadRate:  float64(counterDelta(prev.BlockReadBytes, cur.BlockReadBytes)) / seconds,
+			BlockWriteRate: float64(counterDelta(prev.BlockWriteBytes, cur.BlockWriteBytes)) / seconds,
+			Gap:            gapAfter > 0 && interval > gapAfter,
+		})
+	}
+	return rates
+}
+
+// writeHistoryCSV writes one CSV row per oldest-first data point with the
+// container's stats as shown in the history table of the container page
+func writeHistoryCSV(w io.Writer, dataPoints []ContainerDataPoint, timeLayout string) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"timestamp", "cpu_perc", "mem_perc", "mem_usage", "net_io", "block_io", "pids"})
+	for _, point := range dataPoints {
+		cw.Write([]string{
+			point.Time.Format(timeLayout),
+			strconv.FormatFloat(point.CPUPerc, 'f', 2, 64),
+			strconv.FormatFloat(point.MemPerc, 'f', 2, 64),
+			point.MemUsage,
+			point.NetIO,
+			point.BlockIO,
+			point.PIDs,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeIOCSV writes one CSV row per oldest-first data point with the network
+// and block I/O rates in bytes per second since the previous point. The first
+// row has blank rates, as do rows whose counters cannot be parsed; a counter
+// that went backwards, e.g. after a container restart, gives a zero rate.
+// The delimiter is ',' for CSV or '\t' for TSV; fields containing it or a
+// newline are quoted.
+func writeIOCSV(w io.Writer, dataPoints []ContainerDataPoint, timeLayout string, delimiter rune) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = delimiter
+	cw.Write([]string{"timestamp", "net_rx_rate", "net_tx_rate", "block_read_rate", "block_write_rate"})
+
+	// counters returns the net in/out and block read/write bytes of a point
+	counters := func(point ContainerDataPoint) ([4]int64, bool) {
+		return [4]int64{point.NetInBytes, point.NetOutBytes, point.BlockReadBytes, point.BlockWriteBytes}, point.NetIOValid && point.BlockIOValid
+	}
+
+	for i, point := range dataPoints {
+		row := []string{point.Time.Format(timeLayout), "", "", "", ""}
+		if i > 0 {
+			prev, prevOK := counters(dataPoints[i-1])
+			cur, curOK := counters(point)
+			seconds := point.Time.Sub(dataPoints[i-1].Time).Seconds()
+			if prevOK && curOK && seconds > 0 {
+				for j := range cur {
+					rate := 0.0
+					if cur[j] >= prev[j] {
+						rate = float64(cur[j]-prev[j]) / seconds
+					}
+					row[j+1] = strconv.FormatFloat(rate, 'f', 2, 64)
+				}
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// SummaryColumn is a column of the summary CSV export. Value returns a
+// string, bool, int, int64, float64, Trend or time.Time.
+type SummaryColumn struct {
+	Name  string
+	Value func(s *ContainerSummary) interface{}
+}
+
+// summaryColumns lists the summary CSV columns in order. The names match the
+// JSON keys of ContainerSummary and must stay stable, as scripts rely on
+// them; new columns are appended.
+var summaryColumns = []SummaryColumn{
+	{"container_id", func(s *ContainerSummary) interface{} { return s.ContainerID }},
+	{"container_name", func(s *ContainerSummary) interface{} { return s.ContainerName }},
+	{"data_points", func(s *ContainerSummary) interface{} { return s.DataPoints }},
+	{"avg_cpu", func(s *ContainerSummary) interface{} { return s.AvgCPU }},
+	{"max_cpu", func(s *ContainerSummary) interface{} { return s.MaxCPU }},
+	{"min_cpu", func(s *ContainerSummary) interface{} { return s.MinCPU }},
+	{"avg_mem", func(s *ContainerSummary) interface{} { return s.AvgMem }},
+	{"max_mem", func(s *ContainerSummary) interface{} { return s.MaxMem }},
+	{"min_mem", func(s *ContainerSummary) interface{} { return s.MinMem }},
+	{"first_seen", func(s *ContainerSummary) interface{} { return s.FirstSeenTime }},
+	{"last_seen", func(s *ContainerSummary) interface{} { return s.LastSeenTime }},
+	{"always_busy", func(s *ContainerSummary) interface{} { return s.AlwaysBusy }},
+	{"above_baseline", func(s *ContainerSummary) interface{} { return s.AboveBaseline }},
+	{"cpu_trend", func(s *ContainerSummary) interface{} { return s.CPUTrend }},
+	{"mem_trend", func(s *ContainerSummary) interface{} { return s.MemTrend }},
+	{"net_in_total", func(s *ContainerSummary) interface{} { return s.NetInTotal }},
+	{"net_out_total", func(s *ContainerSummary) interface{} { return s.NetOutTotal }},
+	{"block_read_total", func(s *ContainerSummary) interface{} { return s.BlockReadTotal }},
+	{"block_write_total", func(s *ContainerSummary) interface{} { return s.BlockWriteTotal }},
+	{"net_in_rate", func(s *ContainerSummary) interface{} { return s.NetInRate }},
+	{"net_out_rate", func(s *ContainerSummary) interface{} { return s.NetOutRate }},
+	{"block_read_rate", func(s *ContainerSummary) interface{} { return s.BlockReadRate }},
+	{"block_write_rate", func(s *ContainerSummary) interface{} { return s.BlockWriteRate }},
+	{"avg_mem_limit_util", func(s *ContainerSummary) interface{} { return s.AvgMemLimitUtil }},
+	{"efficiency_score", func(s *ContainerSummary) interface{} { return s.EfficiencyScore }},
+	{"avg_mem_used_bytes", func(s *ContainerSummary) interface{} { return s.AvgMemUsedBytes }},
+	{"observed_interval_seconds", func(s *ContainerSummary) interface{} { return s.ObservedInterval }},
+	{"irregular_interval", func(s *ContainerSummary) interface{} { return s.IrregularInterval }},
+	{"restarts", func(s *ContainerSummary) interface{} { return s.Restarts }},
+	{"p50_cpu", func(s *ContainerSummary) interface{} { return s.P50CPU }},
+	{"p90_cpu", func(s *ContainerSummary) interface{} { return s.P90CPU }},
+	{"p95_cpu", func(s *ContainerSummary) interface{} { return s.P95CPU }},
+	{"p99_cpu", func(s *ContainerSummary) interface{} { return s.P99CPU }},
+	{"p50_mem", func(s *ContainerSummary) interface{} { return s.P50Mem }},
+	{"p90_mem", func(s *ContainerSummary) interface{} { return s.P90Mem }},
+	{"p95_mem", func(s *ContainerSummary) interface{} { return s.P95Mem }},
+	{"p99_mem", func(s *ContainerSummary) interface{} { return s.P99Mem }},
+	{"cpu_spike_count", func(s *ContainerSummary) interface{} { return s.CPUSpikeCount }},
+	{"mem_spike_count", func(s *ContainerSummary) interface{} { return s.MemSpikeCount }},
+	{"recent_avg_cpu", func(s *ContainerSummary) interface{} { return s.RecentAvgCPU }},
+	{"recent_avg_mem", func(s *ContainerSummary) interface{} { return s.RecentAvgMem }},
+	{"project", func(s *ContainerSummary) interface{} { return s.Project }},
+}
+
+// summaryReportColumns are the columns of /summary.csv, matching the main
+// columns of the summary page
+var summaryReportColumns = selectSummaryColumns(
+	"container_name", "container_id", "data_points",
+	"avg_cpu", "max_cpu", "min_cpu", "avg_mem", "max_mem", "min_mem",
+	"first_seen", "last_seen",
+)
+
+// selectSummaryColumns returns the named summary columns in the given order
+func selectSummaryColumns(names ...string) []SummaryColumn {
+	columns := make([]SummaryColumn, len(names))
+	for i, name := range names {
+		column, ok := lookupSummaryColumn(name)
+		if !ok {
+			panic("unknown summary column " + name)
+		}
+		columns[i] = column
+	}
+	return columns
+}
+
+// lookupSummaryColumn returns the summary CSV column with the given name
+func lookupSummaryColumn(name string) (SummaryColumn, bool) {
+	for _, column := range summaryColumns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return SummaryColumn{}, false
+}
+
+// summaryCellLess orders two values of the same summary column, with false
+// before true
+func summaryCellLess(a, b interface{}) bool {
+	switch a := a.(type) {
+	case string:
+		return a < b.(string)
+	case Trend:
+		return a < b.(Trend)
+	case bool:
+		return !a && b.(bool)
+	case int:
+		return a < b.(int)
+	case int64:
+		return a < b.(int64)
+	case float64:
+		return a < b.(float64)
+	case time.Time:
+		return a.Before(b.(time.Time))
+	}
+	return false
+}
+
+// sortSummaries stably sorts summaries by a column, descending if desc is set
+func sortSummaries(summaries []ContainerSummary, column SummaryColumn, desc bool) {
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := column.Value(&summaries[i]), column.Value(&summaries[j])
+		if desc {
+			return summaryCellLess(b, a)
+		}
+		return summaryCellLess(a, b)
+	})
+}
+
+// writeSummaryCSV writes a header of the column names and one row per
+// summary. Floats are written with up to two decimals and times with
+// timeLayout.
+func writeSummaryCSV(w io.Writer, summaries []ContainerSummary, columns []SummaryColumn, timeLayout string) error {
+	cw := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	cw.Write(header)
+
+	for i := range summaries {
+		row := make([]string, len(columns))
+		for j, column := range columns {
+			switch value := column.Value(&summaries[i]).(type) {
+			case float64:
+				row[j] = strconv.FormatFloat(value, 'f', 2, 64)
+			case time.Time:
+				row[j] = value.Format(timeLayout)
+			default:
+				row[j] = fmt.Sprint(value)
+			}
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Restart is a likely container restart, detected from cumulative I/O
+// counters dropping between two data points
+type Restart struct {
+	Timestamp string `json:"timestamp"`
+	// Counters names the counters that dropped: net_in, net_out,
+	// block_read and block_write
+	Counters []string `json:"counters"`
+}
+
+// detectRestarts returns the oldest-first data points at which any of the
+// network or block I/O counters is lower than at the previous point. The
+// counters only grow while a container runs, so equal or growing values are
+// never flagged. Points whose counters cannot be parsed are skipped.
+func detectRestarts(dataPoints []ContainerDataPoint, timeLayout string) []Restart {
+	names := []string{"net_in", "net_out", "block_read", "block_write"}
+	restarts := []Restart{}
+	var prev []int64
+	for _, point := range dataPoints {
+		if !point.NetIOValid || !point.BlockIOValid {
+			continue
+		}
+		cur := []int64{point.NetInBytes, point.NetOutBytes, point.BlockReadBytes, point.BlockWriteBytes}
+		if prev != nil {
+			var dropped []string
+			for i := range cur {
+				if cur[i] < prev[i] {
+					dropped = append(dropped, names[i])
+				}
+			}
+			if dropped != nil {
+				restarts = append(restarts, Restart{Timestamp: point.Time.Format(timeLayout), Counters: dropped})
+			}
+		}
+		prev = cur
+	}
+	return restarts
+}
+
+// ioCounterTotals returns the bytes moved over oldest-first data points for
+// each network and block I/O counter. Samples whose counters cannot be
+// parsed are skipped.
+func ioCounterTotals(dataPoints []ContainerDataPoint) (netInTotal, netOutTotal, blockReadTotal, blockWriteTotal int64) {
+	var netIn, netOut, blockRead, blockWrite []int64
+	for _, point := range dataPoints {
+		if point.NetIOValid {
+			netIn = append(netIn, point.NetInBytes)
+			netOut = append(netOut, point.NetOutBytes)
+		}
+		if point.BlockIOValid {
+			blockRead = append(blockRead, point.BlockReadBytes)
+			blockWrite = append(blockWrite, point.BlockWriteBytes)
+		}
+	}
+	return counterTotal(netIn), counterTotal(netOut), counterTotal(blockRead), counterTotal(blockWrite)
+}
+
+// markIODeltas sets the bytes each oldest-first data point's counters moved
+// since the previous point with valid counters, treating a drop as a
+// counter reset. Points with invalid counters get no delta.
+func markIODeltas(dataPoints []ContainerDataPoint) {
+	var prevNet, prevBlock *ContainerDataPoint
+	for i := range dataPoints {
+		cur := &dataPoints[i]
+		if cur.NetIOValid {
+			if prevNet != nil {
+				cur.NetInDelta = counterDelta(prevNet.NetInBytes, cur.NetInBytes)
+				cur.NetOutDelta = counterDelta(prevNet.NetOutBytes, cur.NetOutBytes)
+				cur.HasNetDelta = true
+			}
+			prevNet = cur
+		}
+		if cur.BlockIOValid {
+			if prevBlock != nil {
+				cur.BlockReadDelta = counterDelta(prevBlock.BlockReadBytes, cur.BlockReadBytes)
+				cur.BlockWriteDelta = counterDelta(prevBlock.BlockWriteBytes, cur.BlockWriteBytes)
+				cur.HasBlockDelta = true
+			}
+			prevBlock = cur
+		}
+	}
+}
+
+// ioTotals fills in the bytes moved and the average rates of a summary from
+// the container's oldest-first data points. Samples whose counters cannot be
+// parsed are skipped.
+func ioTotals(summary *ContainerSummary, dataPoints []ContainerDataPoint) {
+	summary.NetInTotal, summary.NetOutTotal, summary.BlockReadTotal, summary.BlockWriteTotal = ioCounterTotals(dataPoints)
+
+	seconds := dataPoints[len(dataPoints)-1].Time.Sub(dataPoints[0].Time).Seconds()
+	if seconds <= 0 {
+		return
+	}
+	summary.NetInRate = float64(summary.NetInTotal) / seconds
+	summary.NetOutRate = float64(summary.NetOutTotal) / seconds
+	summary.BlockReadRate = float64(summary.BlockReadTotal) / seconds
+	summary.BlockWriteRate = float64(summary.BlockWriteTotal) / seconds
+}
+
+// LineError describes a line of a stats file that failed to parse
+type LineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ValidationResult is the outcome of a dry-run parse of a stats file
+type ValidationResult struct {
+	Parsed int         `json:"parsed"`
+	Failed []LineError `json:"failed"`
+	Sample *DockerStat `json:"sample"`
+}
+
+// readStats parses JSON Lines docker stats from r, skipping blank lines.
+// Lines that fail to parse are reported with their line number rather than
+// stopping the read. Input starting with "[" is read as a single JSON array
+// of stats instead, as produced by piping the lines through jq -s.
+func readStats(r io.Reader) ([]DockerStat, []LineError, error) {
+	reader := bufio.NewReader(r)
+	if isJSONArray(reader) {
+		var dockerStats []DockerStat
+		if err := json.NewDecoder(reader).Decode(&dockerStats); err != nil {
+			return nil, nil, fmt.Errorf("error parsing JSON array: %v", err)
+		}
+		return dockerStats, nil, nil
+	}
+
+	var dockerStats []DockerStat
+	var lineErrors []LineError
+	scanner := bufio.NewScanner(reader)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			continue
+		}
+
+		var stat DockerStat
+		if err := json.Unmarshal([]byte(line), &stat); err != nil {
+			lineErrors = append(lineErrors, LineError{Line: lineNum, Error: err.Error()})
+			continue
+		}
+
+		dockerStats = append(dockerStats, stat)
+	}
+
+	return dockerStats, lineErrors, scanner.Err()
+}
+
+// isStatsFileName reports whether name is a stats file, plain or gzipped
+func isStatsFileName(name string) bool {
+	return strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".json.gz")
+}
+
+// gzipFile decompresses a gzipped file, closing both on Close
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// openStatsFile opens a stats file for reading, decompressing it on the fly
+// if its name ends in .json.gz
+func openStatsFile(filePath string) (io.ReadCloser, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(filePath, ".gz") {
+		return file, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return gzipFile{Reader: gz, file: file}, nil
+}
+
+// isJSONArray reports whether the first non-whitespace byte of r is "[",
+// leaving that byte unread
+func isJSONArray(r *bufio.Reader) bool {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return false
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		r.UnreadByte()
+		return b == '['
+	}
+}
+
+// parseStatsFile parses a single stats JSON file
+func parseStatsFile(filePath string) (StatsFile, error) {
+	file, err := openStatsFile(filePath)
+	if err != nil {
+		return StatsFile{}, fmt.Errorf("error opening file %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	statsFile, err := parseStatsReader(filePath, file)
+	if err != nil {
+		return StatsFile{}, err
+	}
+	if info, err := os.Stat(filePath); err == nil {
+		statsFile.ModTime = info.ModTime()
+	}
+	statsFile.Path = filePath
+	return statsFile, nil
+}
+
+// parseStatsReader parses a stats file read from r, taking its name and
+// timestamp from filePath
+func parseStatsReader(filePath string, r io.Reader) (StatsFile, error) {
+	dockerStats, lineErrors, err := readStats(r)
+	if err != nil {
+		return StatsFile{}, fmt.Errorf("error reading file %s: %v", filePath, err)
+	}
+	if len(lineErrors) > 0 {
+		return StatsFile{}, fmt.Errorf("error parsing line %d in %s: %s", lineErrors[0].Line, filePath, lineErrors[0].Error)
+	}
+
+	basename := filepath.Base(filePath)
+	return StatsFile{
+		Name:      basename,
+		Timestamp: fileNameTimestamp(basename),
+		Stats:     dockerStats,
+	}, nil
+}
+
+// fileNameTimestampPattern matches the timestamp run.sh puts in file names,
+// e.g. the 2025-08-05_08-57-16 in prod_2025-08-05_08-57-16_docker_stats.json
+var fileNameTimestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}`)
+
+// unnamedTimestamps records the file names already warned about for lacking
+// a timestamp, as -low-memory parses files again on every request
+var unnamedTimestamps sync.Map
+
+// fileNameTimestamp extracts the timestamp from a stats file name wherever
+// it appears in it, read in the -file-tz zone and converted to the -tz one.
+// Names without a valid timestamp fall back to the current time with a
+// warning, logged once per name.
+func fileNameTimestamp(name string) time.Time {
+	if match := fileNameTimestampPattern.FindString(name); match != "" {
+		if t, err := time.ParseInLocation("2006-01-02_15-04-05", match, fileLocation); err == nil {
+			return t.In(displayLocation)
+		}
+	}
+	if _, logged := unnamedTimestamps.LoadOrStore(name, true); !logged {
+		log.Printf("Warning: no timestamp found in file name %s, using the current time", name)
+	}
+	return time.Now().In(displayLocation)
+}
+
+// LoadOptions controls how the stats directory is loaded
+type LoadOptions struct {
+	// MergeSameTimestamp combines files sharing a timestamp, e.g. from
+	// several hosts, into a single snapshot
+	MergeSameTimestamp bool
+	// Archive is a tar.gz of stats files to load instead of the stats
+	// directory
+	Archive string
+	// ExcludeFiles is a glob pattern of file names to skip, e.g. "*_test_*"
+	ExcludeFiles string
+	// ExcludeContainers are glob patterns of container names to drop from
+	// every file, e.g. "k8s_POD_*"
+	ExcludeContainers []string
+	// StrictFiles fails the whole load if any file fails to parse, instead
+	// of skipping that file
+	StrictFiles bool
+	// LowMemory drops the stats of every file once it has been validated,
+	// keeping only its name, timestamp and path; see reloadStats
+	LowMemory bool
+}
+
+// systemContainerPatterns are the container name patterns -hide-system
+// excludes: infrastructure containers that run next to every workload and
+// clutter the views without being anyone's service.
+var systemContainerPatterns = []string{
+	"k8s_POD_*",         // Kubernetes pod sandbox (pause) containers under dockershim
+	"pause",             // standalone pause containers
+	"k8s_istio-proxy_*", // Istio sidecars
+	"k8s_linkerd-proxy_*",
+	"fluentd*", // log shippers
+	"fluent-bit*",
+	"logspout*",
+	"filebeat*",
+	"promtail*",
+}
+
+// excludedContainer reports whether name matches one of the glob patterns
+func excludedContainer(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if match, _ := filepath.Match(pattern, name); match {
+			return true
+		}
+	}
+	return false
+}
+
+// filterContainers drops the stats of containers whose name matches one of
+// the patterns and returns how many were dropped
+func filterContainers(statsFile *StatsFile, patterns []string) int {
+	if len(patterns) == 0 {
+		return 0
+	}
+	kept := statsFile.Stats[:0]
+	for _, stat := range statsFile.Stats {
+		if !excludedContainer(stat.Name, patterns) {
+			kept = append(kept, stat)
+		}
+	}
+	dropped := len(statsFile.Stats) - len(kept)
+	statsFile.Stats = kept
+	return dropped
+}
+
+// reloadStats reads the stats of a file loaded under -low-memory again,
+// dropping excluded containers as the load did
+func reloadStats(statsFile StatsFile, opts LoadOptions) (StatsFile, error) {
+	reloaded, err := parseStatsFile(statsFile.Path)
+	if err != nil {
+		return StatsFile{}, err
+	}
+	filterContainers(&reloaded, opts.ExcludeContainers)
+	statsFile.Stats = reloaded.Stats
+	return statsFile, nil
+}
+
+// fileWithStats returns the stats file with its stats, reading them from
+// disk under -low-memory. A file that can no longer be read is logged and
+// reported as not ok.
+func fileWithStats(statsFile StatsFile, opts LoadOptions) (StatsFile, bool) {
+	if !opts.LowMemory {
+		return statsFile, true
+	}
+	reloaded, err := reloadStats(statsFile, opts)
+	if err != nil {
+		log.Printf("Warning: failed to reload %s: %v", statsFile.Name, err)
+		return StatsFile{}, false
+	}
+	return reloaded, true
+}
+
+// forEachStatsFile calls fn with every stats file and its stats. Under
+// -low-memory each file is read from disk just before fn is called and can
+// be dropped afterwards, so only one file's stats are held at a time. Files
+// that can no longer be read are skipped with a warning.
+func forEachStatsFile(statsFiles []StatsFile, opts LoadOptions, fn func(StatsFile)) {
+	for _, statsFile := range statsFiles {
+		if statsFile, ok := fileWithStats(statsFile, opts); ok {
+			fn(statsFile)
+		}
+	}
+}
+
+// withStats returns the stats files with their stats, reading them from disk
+// under -low-memory
+func withStats(statsFiles []StatsFile, opts LoadOptions) []StatsFile {
+	if !opts.LowMemory {
+		return statsFiles
+	}
+	loaded := make([]StatsFile, 0, len(statsFiles))
+	forEachStatsFile(statsFiles, opts, func(statsFile StatsFile) {
+		loaded = append(loaded, statsFile)
+	})
+	return loaded
+}
+
+// withStatsWindow returns the stats files with the stats of the n files
+// from start on, reading only those from disk under -low-memory. The other
+// files keep just their name, timestamp and path, so the result lines up
+// with statsFiles; a file in the window that can no longer be read is left
+// without stats.
+func withStatsWindow(statsFiles []StatsFile, start, n int, opts LoadOptions) []StatsFile {
+	if !opts.LowMemory {
+		return statsFiles
+	}
+	window := append([]StatsFile(nil), statsFiles...)
+	for i := start; i < min(start+n, len(window)); i++ {
+		if statsFile, ok := fileWithStats(window[i], opts); ok {
+			window[i] = statsFile
+		}
+	}
+	return window
+}
+
+// mergeSameTimestamp combines stats files with identical timestamps into one
+// file with the concatenated stats, tagging each stat with its source file.
+// The input must be sorted by timestamp.
+func mergeSameTimestamp(statsFiles []StatsFile) []StatsFile {
+	var merged []StatsFile
+	for i := 0; i < len(statsFiles); {
+		// Find the run of files sharing this timestamp
+		j := i + 1
+		for j < len(statsFiles) && statsFiles[j].Timestamp.Equal(statsFiles[i].Timestamp) {
+			j++
+		}
+		if j-i == 1 {
+			merged = append(merged, statsFiles[i])
+			i = j
+			continue
+		}
+
+		combined := StatsFile{Timestamp: statsFiles[i].Timestamp}
+		var names []string
+		for _, statsFile := range statsFiles[i:j] {
+			names = append(names, statsFile.Name)
+			if statsFile.ModTime.After(combined.ModTime) {
+				combined.ModTime = statsFile.ModTime
+			}
+			for _, stat := range statsFile.Stats {
+				stat.Source = statsFile.Name
+				combined.Stats = append(combined.Stats, stat)
+			}
+		}
+		combined.Name = strings.Join(names, " + ")
+		merged = append(merged, combined)
+		i = j
+	}
+	return merged
+}
+
+// LoadError describes a stats file that was skipped because it failed to parse
+type LoadError struct {
+	File        string    `json:"file"`
+	Error       string    `json:"error"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// loadAllStatsFiles loads and parses all JSON files, plain or gzipped, from
+// the stats directory, or from the tar.gz in opts.Archive when set. Files
+// that fail to parse are skipped and reported as load errors, or with
+// opts.StrictFiles fail the load, returning the load errors with the error.
+func loadAllStatsFiles(dir string, opts LoadOptions) ([]StatsFile, []LoadError, error) {
+	var statsFiles []StatsFile
+	loadErrors := []LoadError{}
+	excluded, excludedStats := 0, 0
+
+	// add parses a single stats file unless its name is excluded
+	add := func(name string, parse func() (StatsFile, error)) {
+		if opts.ExcludeFiles != "" {
+			if match, _ := filepath.Match(opts.ExcludeFiles, name); match {
+				excluded++
+				return
+			}
+		}
+
+		statsFile, err := parse()
+		if err != nil {
+			log.Printf("Warning: failed to parse %s: %v", name, err)
+			loadErrors = append(loadErrors, LoadError{File: name, Error: err.Error(), AttemptedAt: time.Now()})
+			return
+		}
+
+		excludedStats += filterContainers(&statsFile, opts.ExcludeContainers)
+		if opts.LowMemory {
+			statsFile.Stats = nil
+		}
+
+		statsFiles = append(statsFiles, statsFile)
+	}
+
+	if opts.Archive != "" {
+		if err := readStatsArchive(opts.Archive, add); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading directory %s: %v", dir, err)
+		}
+		for _, file := range files {
+			if file.IsDir() || !isStatsFileName(file.Name()) {
+				continue
+			}
+			filePath := filepath.Join(dir, file.Name())
+			add(file.Name(), func() (StatsFile, error) {
+				return parseStatsFile(filePath)
+			})
+		}
+	}
+
+	if excluded > 0 {
+		log.Printf("Excluded %d stats files matching %q", excluded, opts.ExcludeFiles)
+	}
+	if excludedStats > 0 {
+		log.Printf("Excluded %d container entries matching %s", excludedStats, strings.Join(opts.ExcludeContainers, ","))
+	}
+	if opts.StrictFiles && len(loadErrors) > 0 {
+		return nil, loadErrors, fmt.Errorf("%d stats files failed to parse, first: %s", len(loadErrors), loadErrors[0].Error)
+	}
+
+	// Sort by timestamp (newest first)
+	sort.Slice(statsFiles, func(i, j int) bool {
+		return statsFiles[i].Timestamp.After(statsFiles[j].Timestamp)
+	})
+
+	if opts.MergeSameTimestamp {
+		statsFiles = mergeSameTimestamp(statsFiles)
+	}
+
+	return statsFiles, loadErrors, nil
+}
+
+// ClockWarning describes a stats file written after another one but carrying
+// an earlier timestamp, e.g. because the collecting host's clock jumped back
+type ClockWarning struct {
+	File              string    `json:"file"`
+	Timestamp         time.Time `json:"timestamp"`
+	PreviousFile      string    `json:"previous_file"`
+	PreviousTimestamp time.Time `json:"previous_timestamp"`
+	WrittenAt         time.Time `json:"written_at"`
+}
+
+// detectClockRegressions orders the files by the time they were written and
+// logs and returns every file whose timestamp is earlier than that of the
+// file written before it. Files without a modification time are ignored.
+func detectClockRegressions(statsFiles []StatsFile) []ClockWarning {
+	var written []StatsFile
+	for _, statsFile := range statsFiles {
+		if !statsFile.ModTime.IsZero() {
+			written = append(written, statsFile)
+		}
+	}
+	sort.SliceStable(written, func(i, j int) bool {
+		return written[i].ModTime.Before(written[j].ModTime)
+	})
+
+	warnings := []ClockWarning{}
+	for i := 1; i < len(written); i++ {
+		prev, cur := written[i-1], written[i]
+		if !cur.Timestamp.Before(prev.Timestamp) {
+			continue
+		}
+		log.Printf("Warning: clock regression: %s was written after %s but its timestamp is %v earlier",
+			cur.Name, prev.Name, prev.Timestamp.Sub(cur.Timestamp))
+		warnings = append(warnings, ClockWarning{
+			File:              cur.Name,
+			Timestamp:         cur.Timestamp,
+			PreviousFile:      prev.Name,
+			PreviousTimestamp: prev.Timestamp,
+			WrittenAt:         cur.ModTime,
+		})
+	}
+	return warnings
+}
+
+// readStatsArchive passes each JSON file in a tar.gz archive to add, parsed
+// straight from the archive stream. Entries other than regular .json files
+// are skipped.
+func readStatsArchive(archivePath string, add func(name string, parse func() (StatsFile, error))) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("error opening archive %s: %v", archivePath, err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("error reading archive %s: %v", archivePath, err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive %s: %v", archivePath, err)
+		}
+
+		name := path.Base(header.Name)
+		if header.Typeflag != tar.TypeReg || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		add(name, func() (StatsFile, error) {
+			statsFile, err := parseStatsReader(header.Name, archive)
+			statsFile.ModTime = header.ModTime
+			return statsFile, err
+		})
+	}
+}
+
+// IDCandidate is a container whose ID matches an ambiguous short ID
+type IDCandidate struct {
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	LastSeen      string `json:"last_seen"`
+}
+
+// resolveContainerID expands a short container ID prefix to the full ID.
+// Exact matches win and unknown IDs are returned unchanged. If the prefix
+// matches several containers, mode "latest" picks the most recently seen
+// one, while mode "strict" returns an empty ID and the candidates, most
+// recently seen first.
+func resolveContainerID(statsFiles []StatsFile, id, mode string) (string, []IDCandidate) {
+	var candidates []IDCandidate
+	seen := make(map[string]bool)
+	// Files are sorted newest first, so the first sighting is the latest
+	for _, statsFile := range statsFiles {
+		for _, stat := range statsFile.Stats {
+			if stat.ID == id {
+				return id, nil
+			}
+			if seen[stat.ID] || !strings.HasPrefix(stat.ID, id) {
+				continue
+			}
+			seen[stat.ID] = true
+			candidates = append(candidates, IDCandidate{
+				ContainerID:   stat.ID,
+				ContainerName: stat.Name,
+				LastSeen:      statsFile.Timestamp.Format(time.RFC3339),
+			})
+		}
+	}
+
+	switch {
+	case len(candidates) == 0:
+		return id, nil
+	case len(candidates) == 1 || mode == "latest":
+		return candidates[0].ContainerID, nil
+	default:
+		return "", candidates
+	}
+}
+
+// getContainerComparison returns historical data for a specific container
+func getContainerComparison(statsFiles []StatsFile, containerID string) ContainerComparison {
+	var dataPoints []ContainerDataPoint
+	var containerName string
+
+	for _, statsFile := range statsFiles {
+		for _, stat := range statsFile.Stats {
+			if stat.ID == containerID {
+				dataPoints = append(dataPoints, newDataPoint(statsFile, stat))
+
+				if containerName == "" {
+					containerName = stat.Name
+				}
+			}
+		}
+	}
+
+	// Sort data points by timestamp (oldest first for proper timeline)
+	sort.Slice(dataPoints, func(i, j int) bool {
+		return dataPoints[i].Time.Before(dataPoints[j].Time)
+	})
+
+	return ContainerComparison{
+		ContainerID:   containerID,
+		ContainerName: containerName,
+		Data:          dataPoints,
+	}
+}
+
+// getMultiContainerComparison builds the comparisons of several containers in
+// a single pass over the files, keyed by container ID. Containers without
+// data points get a comparison without data.
+func getMultiContainerComparison(statsFiles []StatsFile, ids []string) map[string]ContainerComparison {
+	comparisons := make(map[string]ContainerComparison, len(ids))
+	for _, id := range ids {
+		comparisons[id] = ContainerComparison{ContainerID: id}
+	}
+
+	for _, statsFile := range statsFiles {
+		for _, stat := range statsFile.Stats {
+			comparison, ok := comparisons[stat.ID]
+			if !ok {
+				continue
+			}
+			comparison.Data = append(comparison.Data, newDataPoint(statsFile, stat))
+			if comparison.ContainerName == "" {
+				comparison.ContainerName = stat.Name
+			}
+			comparisons[stat.ID] = comparison
+		}
+	}
+
+	for _, comparison := range comparisons {
+		sort.Slice(comparison.Data, func(i, j int) bool {
+			return comparison.Data[i].Time.Before(comparison.Data[j].Time)
+		})
+	}
+	return comparisons
+}
+
+// prometheusLabel escapes a label value for the Prometheus text format
+var prometheusLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writePrometheusMetrics writes the CPU and memory percentages of every
+// container in the latest stats file in the Prometheus text exposition
+// format, with the number of loaded files and the latest file's timestamp.
+// Stats merged by -merge-same-timestamp carry a source label with their file,
+// so a container reported by several hosts gives distinct series. Without
+// files only the file count is written.
+func writePrometheusMetrics(w io.Writer, latest StatsFile, filesLoaded int) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP docker_stats_files_loaded Number of stats files loaded.")
+	fmt.Fprintln(bw, "# TYPE docker_stats_files_loaded gauge")
+	fmt.Fprintf(bw, "docker_stats_files_loaded %d\n", filesLoaded)
+	if filesLoaded == 0 {
+		return bw.Flush()
+	}
+
+	fmt.Fprintln(bw, "# HELP docker_stats_latest_file_timestamp_seconds Timestamp of the latest stats file.")
+	fmt.Fprintln(bw, "# TYPE docker_stats_latest_file_timestamp_seconds gauge")
+	fmt.Fprintf(bw, "docker_stats_latest_file_timestamp_seconds %d\n", latest.Timestamp.Unix())
+
+	metrics := []struct {
+		name, help string
+		value      func(DockerStat) string
+	}{
+		{"docker_stats_container_cpu_percent", "CPU usage of the container in the latest stats file.", func(stat DockerStat) string { return stat.CPUPerc }},
+		{"docker_stats_container_mem_percent", "Memory usage of the container in the latest stats file.", func(stat DockerStat) string { return stat.MemPerc }},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", metric.name)
+		for _, stat := range latest.Stats {
+			labels := fmt.Sprintf("name=\"%s\",id=\"%s\"", prometheusLabel.Replace(stat.Name), prometheusLabel.Replace(stat.ID))
+			if stat.Source != "" {
+				labels += fmt.Sprintf(",source=\"%s\"", prometheusLabel.Replace(stat.Source))
+			}
+			fmt.Fprintf(bw, "%s{%s} %s\n", metric.name, labels,
+				strconv.FormatFloat(parsePercent(metric.value(stat)), 'f', -1, 64))
+		}
+	}
+	return bw.Flush()
+}
+
+// maxCompareContainers limits how many containers one comparison overlays
+const maxCompareContainers = 8
+
+// compareIDs returns the container IDs to compare, from the comma-separated
+// ids parameter or else from the a and b parameters, without duplicates
+func compareIDs(r *http.Request) ([]string, error) {
+	query := r.URL.Query()
+	params := []string{query.Get("a"), query.Get("b")}
+	if query.Get("ids") != "" {
+		params = strings.Split(query.Get("ids"), ",")
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range params {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 {
+		return nil, fmt.Errorf("at least two container IDs required in ids (or a and b)")
+	}
+	if len(ids) > maxCompareContainers {
+		return nil, fmt.Errorf("at most %d containers can be compared", maxCompareContainers)
+	}
+	return ids, nil
+}
+
+// median returns the median of the values, or 0 if there are none
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// percentile returns the p-th percentile (0-100) of the values using linear
+// interpolation between the closest ranks, or 0 if there are no values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	return sortedPercentile(sorted, p)
+}
+
+// sortedPercentile is percentile for values already sorted ascending, so
+// several percentiles of the same values need only one sort
+func sortedPercentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// movingMax returns, for every value, the maximum of the trailing window
+// ending at it. Early values use the shorter available prefix.
+func movingMax(values []float64, window int) []float64 {
+	result := make([]float64, len(values))
+	for i := range values {
+		start := max(0, i-window+1)
+		result[i] = values[start]
+		for _, value := range values[start+1 : i+1] {
+			result[i] = math.Max(result[i], value)
+		}
+	}
+	return result
+}
+
+// rollingPercentile returns, for every value, the p-th percentile of the
+// trailing window ending at it. Early values use the shorter available prefix.
+func rollingPercentile(values []float64, window int, p float64) []float64 {
+	result := make([]float64, len(values))
+	for i := range values {
+		start := max(0, i-window+1)
+		result[i] = percentile(values[start:i+1], p)
+	}
+	return result
+}
+
+// SeriesPoint is a single value of a derived per-container time series
+type SeriesPoint struct {
+	Timestamp string  `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// RollingSeries is a derived series computed over a trailing window
+type RollingSeries struct {
+	ContainerID string        `json:"container_id"`
+	Metric      string        `json:"metric"`
+	Window      int           `json:"window"`
+	Points      []SeriesPoint `json:"points"`
+}
+
+// SLOCompliance reports how often a container met a threshold objective
+type SLOCompliance struct {
+	ContainerID string  `json:"container_id"`
+	Metric      string  `json:"metric"`
+	Threshold   float64 `json:"threshold"`
+	Objective   string  `json:"objective"`
+	DataPoints  int     `json:"data_points"`
+	Compliant   int     `json:"compliant"`
+	Compliance  float64 `json:"compliance"`
+}
+
+// sloCompliance returns how many values are at or below the threshold, or
+// at or above it when above is set, and their percentage of all values
+func sloCompliance(values []float64, threshold float64, above bool) (int, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	compliant := 0
+	for _, value := range values {
+		if (!above && value <= threshold) || (above && value >= threshold) {
+			compliant++
+		}
+	}
+	return compliant, float64(compliant) / float64(len(values)) * 100
+}
+
+// OverThreshold reports how long a container spent above a threshold
+type OverThreshold struct {
+	ContainerID     string  `json:"container_id"`
+	Metric          string  `json:"metric"`
+	Threshold       float64 `json:"threshold"`
+	OverSeconds     float64 `json:"over_seconds"`
+	ObservedSeconds float64 `json:"observed_seconds"`
+	OverPercent     float64 `json:"over_percent"`
+}
+
+// overThresholdSeconds sums the intervals between consecutive oldest-first
+// data points that are both above the threshold, and all observed intervals.
+// A single point above the threshold has no known duration and adds nothing.
+// Intervals marked as sampling gaps (GapBefore) are left out of both sums,
+// as nothing is known about the container during them.
+func overThresholdSeconds(dataPoints []ContainerDataPoint, values []float64, threshold float64) (over, observed float64) {
+	for i := 1; i < len(dataPoints); i++ {
+		if dataPoints[i].GapBefore {
+			continue
+		}
+		interval := dataPoints[i].Time.Sub(dataPoints[i-1].Time).Seconds()
+		observed += interval
+		if values[i-1] > threshold && values[i] > threshold {
+			over += interval
+		}
+	}
+	return over, observed
+}
+
+// minRegressionSamples is the fewest data points each window needs before
+// a regression check compares them
+const minRegressionSamples = 3
+
+// regressionSigmas is how many baseline standard deviations the recent
+// average has to move for a shift to count as notable
+const regressionSigmas = 2.0
+
+// MetricShift compares a metric's recent average with its baseline average
+type MetricShift struct {
+	BaselineAvg    float64 `json:"baseline_avg"`
+	BaselineStddev float64 `json:"baseline_stddev"`
+	RecentAvg      float64 `json:"recent_avg"`
+	// ChangePercent is null when the baseline average is zero
+	ChangePercent *float64 `json:"change_percent"`
+	Notable       bool     `json:"notable"`
+}
+
+// Regression compares a container's recent window with the earlier part of
+// its history
+type Regression struct {
+	ContainerID     string       `json:"container_id"`
+	BaselineSamples int          `json:"baseline_samples"`
+	RecentSamples   int          `json:"recent_samples"`
+	BaselineFrom    string       `json:"baseline_from,omitempty"`
+	RecentFrom      string       `json:"recent_from,omitempty"`
+	Sufficient      bool         `json:"sufficient"`
+	CPU             *MetricShift `json:"cpu,omitempty"`
+	Mem             *MetricShift `json:"mem,omitempty"`
+}
+
+// meanStddev returns the mean and population standard deviation of values
+func meanStddev(values []float64) (mean, stddev float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	for _, value := range values {
+		mean += value
+	}
+	mean /= float64(len(values))
+	for _, value := range values {
+		stddev += (value - mean) * (value - mean)
+	}
+	return mean, math.Sqrt(stddev / float64(len(values)))
+}
+
+// metricShift compares recent values with baseline values. The shift is
+// notable when the recent average is more than regressionSigmas baseline
+// standard deviations away; a perfectly flat baseline makes any change
+// notable.
+func metricShift(baseline, recent []float64) *MetricShift {
+	baselineAvg, baselineStddev := meanStddev(baseline)
+	recentAvg, _ := meanStddev(recent)
+	shift := &MetricShift{
+		BaselineAvg:    baselineAvg,
+		BaselineStddev: baselineStddev,
+		RecentAvg:      recentAvg,
+		Notable:        math.Abs(recentAvg-baselineAvg) > regressionSigmas*baselineStddev,
+	}
+	if baselineAvg != 0 {
+		change := (recentAvg - baselineAvg) / baselineAvg * 100
+		shift.ChangePercent = &change
+	}
+	return shift
+}
+
+// detectRegression splits oldest-first data points into a baseline and the
+// last recent points and compares their CPU and memory. When either window
+// would have fewer than minRegressionSamples points the result is marked
+// insufficient and carries no comparison.
+func detectRegression(containerID string, dataPoints []ContainerDataPoint, recent int, timeLayout string) Regression {
+	if recent > len(dataPoints) {
+		recent = len(dataPoints)
+	}
+	split := len(dataPoints) - recent
+	result := Regression{
+		ContainerID:     containerID,
+		BaselineSamples: split,
+		RecentSamples:   recent,
+	}
+	if split > 0 {
+		result.BaselineFrom = dataPoints[0].Time.Format(timeLayout)
+	}
+	if recent > 0 {
+		result.RecentFrom = dataPoints[split].Time.Format(timeLayout)
+	}
+	if split < minRegressionSamples || recent < minRegressionSamples {
+		return result
+	}
+
+	cpuValues, _ := dataPointValues(dataPoints, "cpu")
+	memValues, _ := dataPointValues(dataPoints, "mem")
+	result.Sufficient = true
+	result.CPU = metricShift(cpuValues[:split], cpuValues[split:])
+	result.Mem = metricShift(memValues[:split], memValues[split:])
+	return result
+}
+
+// dataPointValues extracts the named metric ("cpu" or "mem") from data points
+func dataPointValues(dataPoints []ContainerDataPoint, metric string) ([]float64, error) {
+	values := make([]float64, len(dataPoints))
+	for i, point := range dataPoints {
+		switch metric {
+		case "cpu":
+			values[i] = point.CPUPerc
+		case "mem":
+			values[i] = point.MemPerc
+		default:
+			return nil, fmt.Errorf("invalid metric %q, expected cpu or mem", metric)
+		}
+	}
+	return values, nil
+}
+
+// seriesPoints pairs derived values with the timestamps of the data points
+// they were computed from
+func seriesPoints(dataPoints []ContainerDataPoint, values []float64, timeLayout string) []SeriesPoint {
+	points := make([]SeriesPoint, len(values))
+	for i, value := range values {
+		points[i] = SeriesPoint{
+			Timestamp: dataPoints[i].Time.Format(timeLayout),
+			Value:     value,
+		}
+	}
+	return points
+}
+
+// markGaps flags data points preceded by an interval longer than factor
+// times the median interval of the series. Each gap is reported by the index
+// of the point following it, which also gets GapBefore set.
+func markGaps(dataPoints []ContainerDataPoint, factor float64) []SamplingGap {
+	gaps := []SamplingGap{}
+	if len(dataPoints) < 3 || factor <= 0 {
+		return gaps
+	}
+
+	intervals := sampleIntervals(dataPoints)
+	expected := median(intervals)
+	if expected <= 0 {
+		return gaps
+	}
+
+	for i, interval := range intervals {
+		if interval > factor*expected {
+			dataPoints[i+1].GapBefore = true
+			gaps = append(gaps, SamplingGap{
+				Index:    i + 1,
+				Seconds:  interval,
+				Expected: expected,
+			})
+		}
+	}
+	return gaps
+}
+
+// sampleIntervals returns the seconds between consecutive oldest-first data
+// points
+func sampleIntervals(dataPoints []ContainerDataPoint) []float64 {
+	if len(dataPoints) < 2 {
+		return nil
+	}
+	intervals := make([]float64, len(dataPoints)-1)
+	for i := 1; i < len(dataPoints); i++ {
+		intervals[i-1] = dataPoints[i].Time.Sub(dataPoints[i-1].Time).Seconds()
+	}
+	return intervals
+}
+
+// An interval deviating from the observed interval by more than
+// intervalTolerance of it counts as off-schedule; a container with more than
+// irregularShare of its intervals off-schedule is flagged as irregular.
+const (
+	intervalTolerance = 0.5
+	irregularShare    = 0.25
+)
+
+// observedInterval detects a container's sampling interval as the median
+// time between its oldest-first data points, and reports whether the actual
+// intervals vary widely from it. It returns zero with fewer than two points.
+func observedInterval(dataPoints []ContainerDataPoint) (time.Duration, bool) {
+	intervals := sampleIntervals(dataPoints)
+	if len(intervals) == 0 {
+		return 0, false
+	}
+	expected := median(intervals)
+	if expected <= 0 {
+		return 0, false
+	}
+
+	offSchedule := 0
+	for _, interval := range intervals {
+		if math.Abs(interval-expected) > intervalTolerance*expected {
+			offSchedule++
+		}
+	}
+	irregular := float64(offSchedule) > irregularShare*float64(len(intervals))
+	return time.Duration(expected * float64(time.Second)), irregular
+}
+
+// StatsOptions controls how summary and comparison statistics are computed
+type StatsOptions struct {
+	// SkipFirst drops each container's earliest data point, which often
+	// shows a start-up spike, from the statistics
+	SkipFirst bool
+	// CPUSpike and MemSpike are the percentages above which a data point
+	// counts as a spike
+	CPUSpike float64
+	MemSpike float64
+	// HalfLife is the age at which a data point counts half as much as the
+	// newest one in the recency-weighted averages
+	HalfLife time.Duration
+	// AnomalyWindow is the number of preceding data points a CPU value is
+	// compared with, and AnomalyZ how many of their standard deviations it
+	// must be away from their mean to count as an anomaly
+	AnomalyWindow int
+	AnomalyZ      float64
+}
+
+// minAnomalyHistory is the fewest preceding data points needed before a
+// data point can be flagged as an anomaly
+const minAnomalyHistory = 3
+
+// detectAnomalies returns the indexes of the oldest-first data points whose
+// CPU is more than zThreshold standard deviations from the mean of the up to
+// window points before it. Early points use whatever history exists, from
+// minAnomalyHistory points on; a perfectly flat history has no spread to
+// measure against and flags nothing.
+func detectAnomalies(points []ContainerDataPoint, window int, zThreshold float64) []int {
+	var anomalies []int
+	for i := minAnomalyHistory; i < len(points); i++ {
+		history := make([]float64, 0, window)
+		for _, point := range points[max(0, i-window):i] {
+			history = append(history, point.CPUPerc)
+		}
+		mean, stddev := meanStddev(history)
+		if stddev > 0 && math.Abs(points[i].CPUPerc-mean)/stddev > zThreshold {
+			anomalies = append(anomalies, i)
+		}
+	}
+	return anomalies
+}
+
+// detectSpikes returns the data points whose CPU is above cpuThreshold or
+// whose memory is above memThreshold, so brief spikes show up even when the
+// averages look fine
+func detectSpikes(points []ContainerDataPoint, cpuThreshold, memThreshold float64) []ContainerDataPoint {
+	var spikes []ContainerDataPoint
+	for _, point := range points {
+		if point.CPUPerc > cpuThreshold || point.MemPerc > memThreshold {
+			spikes = append(spikes, point)
+		}
+	}
+	return spikes
+}
+
+// recencyWeightedAvg averages values of oldest-first data points, weighting
+// each by half for every halfLife it is older than the newest point, so
+// recent behavior dominates. Weights only matter relative to each other, so
+// the same average results whatever point the ages are measured from.
+func recencyWeightedAvg(points []ContainerDataPoint, values []float64, halfLife time.Duration) float64 {
+	if len(points) == 0 {
+		return 0
+	}
+	newest := points[len(points)-1].Time
+	var sum, weights float64
+	for i, point := range points {
+		weight := math.Exp2(-newest.Sub(point.Time).Seconds() / halfLife.Seconds())
+		sum += weight * values[i]
+		weights += weight
+	}
+	return sum / weights
+}
+
+// statsPoints returns the oldest-first data points statistics are computed
+// from. A series of a single point is always kept whole.
+func (o StatsOptions) statsPoints(dataPoints []ContainerDataPoint) []ContainerDataPoint {
+	if o.SkipFirst && len(dataPoints) > 1 {
+		return dataPoints[1:]
+	}
+	return dataPoints
+}
+
+// getContainerComparisonWithStats returns historical data with calculated statistics
+func getContainerComparisonWithStats(statsFiles []StatsFile, containerID string, opts StatsOptions) ContainerComparisonWithStats {
+	comparison := getContainerComparison(statsFiles, containerID)
+
+	if len(comparison.Data) == 0 {
+		return ContainerComparisonWithStats{
+			ContainerComparison: comparison,
+		}
+	}
+
+	// Calculate statistics
+	var cpuValues, memValues []float64
+	var memBytes []int64
+	for _, point := range opts.statsPoints(comparison.Data) {
+		cpuValues = append(cpuValues, point.CPUPerc)
+		memValues = append(memValues, point.MemPerc)
+		memBytes = append(memBytes, point.MemUsedBytes)
+	}
+
+	// Calculate CPU stats
+	var cpuSum float64
+	maxCPU := cpuValues[0]
+	minCPU := cpuValues[0]
+	for _, cpu := range cpuValues {
+		cpuSum += cpu
+		if cpu > maxCPU {
+			maxCPU = cpu
+		}
+		if cpu < minCPU {
+			minCPU = cpu
+		}
+	}
+	avgCPU := cpuSum / float64(len(cpuValues))
+
+	// Calculate Memory stats
+	var memSum float64
+	maxMem := memValues[0]
+	minMem := memValues[0]
+	for _, mem := range memValues {
+		memSum += mem
+		if mem > maxMem {
+			maxMem = mem
+		}
+		if mem < minMem {
+			minMem = mem
+		}
+	}
+	avgMem := memSum / float64(len(memValues))
+
+	// Calculate memory stats in bytes
+	var memBytesSum int64
+	maxMemBytes := memBytes[0]
+	minMemBytes := memBytes[0]
+	for _, used := range memBytes {
+		memBytesSum += used
+		maxMemBytes = max(maxMemBytes, used)
+		minMemBytes = min(minMemBytes, used)
+	}
+
+	interval, irregular := observedInterval(comparison.Data)
+	markIODeltas(comparison.Data)
+	netIn, netOut, blockRead, blockWrite := ioCounterTotals(comparison.Data)
+	anomalies := detectAnomalies(comparison.Data, opts.AnomalyWindow, opts.AnomalyZ)
+	for _, i := range anomalies {
+		comparison.Data[i].Anomaly = true
+	}
+
+	return ContainerComparisonWithStats{
+		ContainerComparison: comparison,
+		AvgCPU:              avgCPU,
+		MaxCPU:              maxCPU,
+		MinCPU:              minCPU,
+		AvgMem:              avgMem,
+		MaxMem:              maxMem,
+		MinMem:              minMem,
+		AvgMemBytes:         memBytesSum / int64(len(memBytes)),
+		MaxMemBytes:         maxMemBytes,
+		MinMemBytes:         minMemBytes,
+		AnomalyCount:        len(anomalies),
+		Stats:               opts,
+		ObservedInterval:    interval,
+		IrregularInterval:   irregular,
+		NetInTotal:          netIn,
+		NetOutTotal:         netOut,
+		BlockReadTotal:      blockRead,
+		BlockWriteTotal:     blockWrite,
+	}
+}
+
+// rankSummaries orders summaries for the summary page and API: by average
+// CPU (descending, the order getAllContainerSummaries returns) for "avg" or
+// an empty rank, or by recency-weighted average CPU for "recent". Ties keep
+// their order, which is by name and ID.
+func rankSummaries(summaries []ContainerSummary, rank string) error {
+	switch rank {
+	case "", "avg":
+	case "recent":
+		sort.SliceStable(summaries, func(i, j int) bool {
+			return summaries[i].RecentAvgCPU > summaries[j].RecentAvgCPU
+		})
+	default:
+		return fmt.Errorf("invalid rank %q, expected avg or recent", rank)
+	}
+	return nil
+}
+
+// summaryReport wraps the summaries of files with the time span they cover,
+// formatted with timeLayout, and the containers with the highest average and
+// peak CPU and the most data points
+func summaryReport(files []StatsFile, summaries []ContainerSummary, timeLayout string) SummaryReport {
+	report := SummaryReport{Summaries: summaries, TotalFiles: len(files)}
+	if len(files) > 0 {
+		first, last := files[0].Timestamp, files[0].Timestamp
+		for _, file := range files[1:] {
+			if file.Timestamp.Before(first) {
+				first = file.Timestamp
+			}
+			if file.Timestamp.After(last) {
+				last = file.Timestamp
+			}
+		}
+		report.FirstTimestamp = first.Format(timeLayout)
+		report.LastTimestamp = last.Format(timeLayout)
+		report.Newest = last
+	}
+
+	for i := range summaries {
+		if report.HighestAvgCPU == nil || summaries[i].AvgCPU > report.HighestAvgCPU.AvgCPU {
+			report.HighestAvgCPU = &summaries[i]
+		}
+		if report.HighestPeakCPU == nil || summaries[i].MaxCPU > report.HighestPeakCPU.MaxCPU {
+			report.HighestPeakCPU = &summaries[i]
+		}
+		if report.MostDataPoints == nil || summaries[i].DataPoints > report.MostDataPoints.DataPoints {
+			report.MostDataPoints = &summaries[i]
+		}
+	}
+	return report
+}
+
+// getAllContainerSummaries returns aggregated statistics for all containers across all files
+func getAllContainerSummaries(statsFiles []StatsFile, opts StatsOptions) []ContainerSummary {
+	collector := newSummaryCollector()
+	for _, statsFile := range statsFiles {
+		collector.add(statsFile)
+	}
+	return collector.summaries(opts)
+}
+
+// summaryCollector gathers the data points of every container one stats file
+// at a time, so the files themselves need not be kept for the summaries
+type summaryCollector struct {
+	containerData  map[string][]ContainerDataPoint
+	containerNames map[string]string
+}
+
+func newSummaryCollector() *summaryCollector {
+	return &summaryCollector{
+		containerData:  make(map[string][]ContainerDataPoint),
+		containerNames: make(map[string]string),
+	}
+}
+
+// add collects the data points of a stats file's containers
+func (c *summaryCollector) add(statsFile StatsFile) {
+	for _, stat := range statsFile.Stats {
+		c.containerData[stat.ID] = append(c.containerData[stat.ID], newDataPoint(statsFile, stat))
+		c.containerNames[stat.ID] = stat.Name
+	}
+}
+
+// summaries calculates the statistics of every collected container
+func (c *summaryCollector) summaries(opts StatsOptions) []ContainerSummary {
+	containerData, containerNames := c.containerData, c.containerNames
+
+	// Calculate statistics for each container
+	var summaries []ContainerSummary
+	for containerID, dataPoints := range containerData {
+		if len(dataPoints) == 0 {
+			continue
+		}
+
+		// Sort data points by timestamp
+		sort.Slice(dataPoints, func(i, j int) bool {
+			return dataPoints[i].Time.Before(dataPoints[j].Time)
+		})
+
+		// Calculate statistics, optionally without the first data point
+		statsPoints := opts.statsPoints(dataPoints)
+
+		// Calculate CPU statistics
+		var cpuSum float64
+		maxCPU := statsPoints[0].CPUPerc
+		minCPU := statsPoints[0].CPUPerc
+		for _, point := range statsPoints {
+			cpuSum += point.CPUPerc
+			if point.CPUPerc > maxCPU {
+				maxCPU = point.CPUPerc
+			}
+			if point.CPUPerc < minCPU {
+				minCPU = point.CPUPerc
+			}
+		}
+		avgCPU := cpuSum / float64(len(statsPoints))
+
+		// Calculate Memory statistics
+		var memSum float64
+		maxMem := statsPoints[0].MemPerc
+		minMem := statsPoints[0].MemPerc
+		for _, point := range statsPoints {
+			memSum += point.MemPerc
+			if point.MemPerc > maxMem {
+				maxMem = point.MemPerc
+			}
+			if point.MemPerc < minMem {
+				minMem = point.MemPerc
+			}
+		}
+		avgMem := memSum / float64(len(statsPoints))
+
+		// Calculate memory limit utilization and the average memory used
+		// from the parsed byte counts
+		var memLimitSum float64
+		var memUsedSum int64
+		for _, point := range statsPoints {
+			memLimitSum += memLimitUtil(point)
+			memUsedSum += point.MemUsedBytes
+		}
+
+		// Calculate trends from the oldest-first series
+		cpuValues := make([]float64, len(statsPoints))
+		memValues := make([]float64, len(statsPoints))
+		for i, point := range statsPoints {
+			cpuValues[i] = point.CPUPerc
+			memValues[i] = point.MemPerc
+		}
+
+		summary := ContainerSummary{
+			ContainerID:     containerID,
+			ContainerName:   containerNames[containerID],
+			Project:         composeProject(containerNames[containerID]),
+			DataPoints:      len(dataPoints),
+			AvgCPU:          avgCPU,
+			MaxCPU:          maxCPU,
+			MinCPU:          minCPU,
+			AvgMem:          avgMem,
+			MaxMem:          maxMem,
+			MinMem:          minMem,
+			FirstSeen:       dataPoints[0].Timestamp,
+			LastSeen:        dataPoints[len(dataPoints)-1].Timestamp,
+			FirstSeenTime:   dataPoints[0].Time,
+			LastSeenTime:    dataPoints[len(dataPoints)-1].Time,
+			CPUTrend:        computeTrend(cpuValues),
+			MemTrend:        computeTrend(memValues),
+			AvgMemLimitUtil: memLimitSum / float64(len(statsPoints)),
+			AvgMemUsedBytes: memUsedSum / int64(len(statsPoints)),
+		}
+		ioTotals(&summary, dataPoints)
+		interval, irregular := observedInterval(dataPoints)
+		summary.ObservedInterval = interval.Seconds()
+		summary.IrregularInterval = irregular
+		summary.Restarts = len(detectRestarts(dataPoints, time.RFC3339))
+		summary.CPUSparkline = sparklineSVG(downsample(cpuValues, summarySparklineWidth), summarySparklineWidth, 20)
+		summary.RecentAvgCPU = recencyWeightedAvg(statsPoints, cpuValues, opts.HalfLife)
+		summary.RecentAvgMem = recencyWeightedAvg(statsPoints, memValues, opts.HalfLife)
+		for _, spike := range detectSpikes(statsPoints, opts.CPUSpike, opts.MemSpike) {
+			if spike.CPUPerc > opts.CPUSpike {
+				summary.CPUSpikeCount++
+			}
+			if spike.MemPerc > opts.MemSpike {
+				summary.MemSpikeCount++
+			}
+		}
+		sort.Float64s(cpuValues)
+		sort.Float64s(memValues)
+		summary.P50CPU, summary.P90CPU = sortedPercentile(cpuValues, 50), sortedPercentile(cpuValues, 90)
+		summary.P95CPU, summary.P99CPU = sortedPercentile(cpuValues, 95), sortedPercentile(cpuValues, 99)
+		summary.P50Mem, summary.P90Mem = sortedPercentile(memValues, 50), sortedPercentile(memValues, 90)
+		summary.P95Mem, summary.P99Mem = sortedPercentile(memValues, 95), sortedPercentile(memValues, 99)
+
+		summaries = append(summaries, summary)
+	}
+
+	// Sort by average CPU usage (descending), breaking ties by name and ID
+	// so the order doesn't change between refreshes
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].AvgCPU != summaries[j].AvgCPU {
+			return summaries[i].AvgCPU > summaries[j].AvgCPU
+		}
+		if summaries[i].ContainerName != summaries[j].ContainerName {
+			return summaries[i].ContainerName < summaries[j].ContainerName
+		}
+		return summaries[i].ContainerID < summaries[j].ContainerID
+	})
+
+	return summaries
+}
+
+// noProjectGroup collects the containers whose name has no compose project
+const noProjectGroup = "(no project)"
+
+// composeProject returns the docker-compose project of a container name in
+// the "project_service_1" (Compose v1) or "project-service-1" (v2) form, or
+// "" for other names. As project and service names may contain the
+// separator themselves, the service is taken to be the last part.
+func composeProject(name string) string {
+	i := strings.LastIndexAny(name, "_-")
+	if i <= 0 || i == len(name)-1 {
+		return ""
+	}
+	if _, err := strconv.Atoi(name[i+1:]); err != nil {
+		return ""
+	}
+	separator, rest := name[i], name[:i]
+	j := strings.LastIndexByte(rest, separator)
+	if j <= 0 || j == len(rest)-1 {
+		return ""
+	}
+	return rest[:j]
+}
+
+// groupByProject groups summaries by their compose project, with containers
+// outside a project under noProjectGroup
+func groupByProject(summaries []ContainerSummary) map[string][]ContainerSummary {
+	groups := make(map[string][]ContainerSummary)
+	for _, summary := range summaries {
+		project := summary.Project
+		if project == "" {
+			project = noProjectGroup
+		}
+		groups[project] = append(groups[project], summary)
+	}
+	return groups
+}
+
+// getProjectGroups combines the summaries per compose project with agg, one
+// of groupAggregations, and sorts the groups by name
+func getProjectGroups(summaries []ContainerSummary, agg string) []ContainerGroup {
+	groups := []ContainerGroup{}
+	for project, members := range groupByProject(summaries) {
+		group := ContainerGroup{Group: project, Agg: agg}
+		for _, summary := range members {
+			group.add(summary)
+		}
+		group.finish()
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Group < groups[j].Group
+	})
+	return groups
+}
+
+// unlabeledGroup collects the containers that lack the grouping label
+const unlabeledGroup = "unlabeled"
+
+// groupAggregations lists the ways member containers' average CPU and
+// memory can be combined into a group figure: sum (the group's total
+// resource use), avg (a typical member) or max (the busiest member)
+var groupAggregations = []string{"sum", "avg", "max"}
+
+// ContainerGroup aggregates the summaries of containers sharing a label value
+type ContainerGroup struct {
+	Group      string   `json:"group"`
+	Containers []string `json:"containers"`
+	DataPoints int      `json:"data_points"`
+	// Agg names how the members' averages were combined into AvgCPU and
+	// AvgMem (see groupAggregations); MaxCPU and MaxMem are always the
+	// highest member peak
+	Agg    string  `json:"agg"`
+	AvgCPU float64 `json:"avg_cpu"`
+	MaxCPU float64 `json:"max_cpu"`
+	AvgMem float64 `json:"avg_mem"`
+	MaxMem float64 `json:"max_mem"`
+}
+
+// parseLabels parses labels in the "key=value,key=value" form of docker ps
+func parseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if ok && key != "" {
+			labels[strings.TrimSpace(key)] = value
+		}
+	}
+	return labels
+}
+
+// add adds a member container's summary to the group, combining its
+// averages according to the group's Agg
+func (g *ContainerGroup) add(summary ContainerSummary) {
+	g.Containers = append(g.Containers, summary.ContainerID)
+	g.DataPoints += summary.DataPoints
+	if g.Agg == "max" {
+		g.AvgCPU = math.Max(g.AvgCPU, summary.AvgCPU)
+		g.AvgMem = math.Max(g.AvgMem, summary.AvgMem)
+	} else {
+		g.AvgCPU += summary.AvgCPU
+		g.AvgMem += summary.AvgMem
+	}
+	g.MaxCPU = math.Max(g.MaxCPU, summary.MaxCPU)
+	g.MaxMem = math.Max(g.MaxMem, summary.MaxMem)
+}
+
+// finish completes the group's figures once all members were added
+func (g *ContainerGroup) finish() {
+	if g.Agg == "avg" && len(g.Containers) > 0 {
+		g.AvgCPU /= float64(len(g.Containers))
+		g.AvgMem /= float64(len(g.Containers))
+	}
+}
+
+// getLabelGroups groups the container summaries by the value of a label,
+// taken from each container's most recent stats line. The member containers'
+// averages are combined with agg, one of groupAggregations, and groups are
+// sorted by name.
+func getLabelGroups(statsFiles []StatsFile, summaries []ContainerSummary, key, agg string) []ContainerGroup {
+	// Files are sorted newest first, so the first sighting has the latest labels
+	groupOf := make(map[string]string)
+	for _, statsFile := range statsFiles {
+		for _, stat := range statsFile.Stats {
+			if _, ok := groupOf[stat.ID]; ok {
+				continue
+			}
+			groupOf[stat.ID] = unlabeledGroup
+			if value, ok := parseLabels(stat.Labels)[key]; ok && value != "" {
+				groupOf[stat.ID] = value
+			}
+		}
+	}
+
+	groupsByName := make(map[string]*ContainerGroup)
+	for _, summary := range summaries {
+		name := groupOf[summary.ContainerID]
+		group, ok := groupsByName[name]
+		if !ok {
+			group = &ContainerGroup{Group: name, Agg: agg}
+			groupsByName[name] = group
+		}
+		group.add(summary)
+	}
+
+	groups := make([]ContainerGroup, 0, len(groupsByName))
+	for _, group := range groupsByName {
+		group.finish()
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Group < groups[j].Group
+	})
+	return groups
+}
+
+// getContainerSummary returns the summary row of a single container, as it
+// appears in the full summary list, or false if the container has no data
+func getContainerSummary(statsFiles []StatsFile, containerID string, opts StatsOptions) (ContainerSummary, bool) {
+	// Only the container's own stats feed its summary
+	containerFiles := make([]StatsFile, 0, len(statsFiles))
+	for _, statsFile := range statsFiles {
+		for _, stat := range statsFile.Stats {
+			if stat.ID == containerID {
+				containerFile := statsFile
+				containerFile.Stats = []DockerStat{stat}
+				containerFiles = append(containerFiles, containerFile)
+				break
+			}
+		}
+	}
+
+	summaries := getAllContainerSummaries(containerFiles, opts)
+	if len(summaries) == 0 {
+		return ContainerSummary{}, false
+	}
+	return summaries[0], true
+}
+
+// computeTrend compares the average of the first half of the values with
+// the average of the second half. Series shorter than four points are flat.
+func computeTrend(values []float64) Trend {
+	if len(values) < 4 {
+		return TrendFlat
+	}
+
+	half := len(values) / 2
+	var firstSum, secondSum float64
+	for _, v := range values[:half] {
+		firstSum += v
+	}
+	// With an odd count the middle point belongs to neither half
+	for _, v := range values[len(values)-half:] {
+		secondSum += v
+	}
+	diff := (secondSum - firstSum) / float64(half)
+
+	switch {
+	case diff > trendTolerance:
+		return TrendUp
+	case diff < -trendTolerance:
+		return TrendDown
+	default:
+		return TrendFlat
+	}
+}
+
+// markEfficiency scores how much of its resources each container uses, as
+// the weighted mean of its average CPU and its average memory limit
+// utilization:
+//
+//	score = (cpuWeight*AvgCPU + memWeight*AvgMemLimitUtil) / (cpuWeight + memWeight)
+//
+// The score ranges from 0 to 100 for single-core CPU percentages. A low score
+// marks an over-provisioned container, e.g. one idling within a large memory
+// limit.
+func markEfficiency(summaries []ContainerSummary, cpuWeight, memWeight float64) {
+	if cpuWeight+memWeight <= 0 {
+		return
+	}
+	for i := range summaries {
+		summaries[i].EfficiencyScore = (cpuWeight*summaries[i].AvgCPU + memWeight*summaries[i].AvgMemLimitUtil) / (cpuWeight + memWeight)
+	}
+}
+
+// memLimitUtil returns the percentage of the memory limit in use at a data
+// point, falling back to the reported memory percentage when MemUsage has no
+// parseable limit
+func memLimitUtil(point ContainerDataPoint) float64 {
+	if point.MemLimitBytes <= 0 {
+		return point.MemPerc
+	}
+	return float64(point.MemUsedBytes) / float64(point.MemLimitBytes) * 100
+}
+
+// markAlwaysBusy flags containers whose minimum CPU never dropped to the floor
+func markAlwaysBusy(summaries []ContainerSummary, cpuFloor float64) {
+	for i := range summaries {
+		summaries[i].AlwaysBusy = summaries[i].MinCPU > cpuFloor
+	}
+}
+
+// markAboveBaseline flags containers that run hotter than the rest of the
+// fleet. The fleet baseline is the average CPU and memory over all containers
+// of each snapshot; a container is above baseline when its average CPU or
+// memory exceeds factor times the average baseline of the snapshots it
+// appears in.
+func markAboveBaseline(statsFiles []StatsFile, summaries []ContainerSummary, factor float64) {
+	baseline := newBaselineCollector()
+	for _, statsFile := range statsFiles {
+		baseline.add(statsFile)
+	}
+	baseline.mark(summaries, factor)
+}
+
+// baselineCollector sums each container's CPU and memory and the fleet
+// averages of the snapshots it appears in, one stats file at a time
+type baselineCollector struct {
+	containers map[string]*baselineTotals
+}
+
+type baselineTotals struct{ cpu, mem, baselineCPU, baselineMem float64 }
+
+func newBaselineCollector() *baselineCollector {
+	return &baselineCollector{containers: make(map[string]*baselineTotals)}
+}
+
+// add adds a stats file's containers and fleet averages to the sums
+func (b *baselineCollector) add(statsFile StatsFile) {
+	if len(statsFile.Stats) == 0 {
+		return
+	}
+	var fleetCPU, fleetMem float64
+	for _, stat := range statsFile.Stats {
+		fleetCPU += parsePercent(stat.CPUPerc)
+		fleetMem += parsePercent(stat.MemPerc)
+	}
+	fleetCPU /= float64(len(statsFile.Stats))
+	fleetMem /= float64(len(statsFile.Stats))
+
+	for _, stat := range statsFile.Stats {
+		t, ok := b.containers[stat.ID]
+		if !ok {
+			t = &baselineTotals{}
+			b.containers[stat.ID] = t
+		}
+		t.cpu += parsePercent(stat.CPUPerc)
+		t.mem += parsePercent(stat.MemPerc)
+		t.baselineCPU += fleetCPU
+		t.baselineMem += fleetMem
+	}
+}
+
+// mark flags the summaries of containers whose CPU or memory sum exceeds
+// factor times their baseline sum
+func (b *baselineCollector) mark(summaries []ContainerSummary, factor float64) {
+	// Sums cover the same snapshots, so comparing them compares the averages
+	for i := range summaries {
+		t, ok := b.containers[summaries[i].ContainerID]
+		if !ok {
+			continue
+		}
+		summaries[i].AboveBaseline = (t.baselineCPU > 0 && t.cpu > factor*t.baselineCPU) ||
+			(t.baselineMem > 0 && t.mem > factor*t.baselineMem)
+	}
+}
+
+// recencyClass returns the CSS class for a last-seen time based on its age
+// relative to the newest stats file
+func recencyClass(lastSeen, newest time.Time, staleAfter, oldAfter time.Duration) string {
+	age := newest.Sub(lastSeen)
+	switch {
+	case age >= oldAfter:
+		return "seen-old"
+	case age >= staleAfter:
+		return "seen-stale"
+	default:
+		return "seen-current"
+	}
+}
+
+// filesInRange returns the files whose timestamp lies within [from, to]. A
+// zero bound leaves that side of the range open.
+func filesInRange(statsFiles []StatsFile, from, to time.Time) []StatsFile {
+	var files []StatsFile
+	for _, statsFile := range statsFiles {
+		if !from.IsZero() && statsFile.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && statsFile.Timestamp.After(to) {
+			continue
+		}
+		files = append(files, statsFile)
+	}
+	return files
+}
+
+// recentFiles returns the files within window of the newest one, or all of
+// them for a zero window. Files are sorted newest first.
+func recentFiles(statsFiles []StatsFile, window time.Duration) []StatsFile {
+	if window == 0 || len(statsFiles) == 0 {
+		return statsFiles
+	}
+	return filesInRange(statsFiles, statsFiles[0].Timestamp.Add(-window), time.Time{})
+}
+
+// getOverview summarizes the newest stats file. A container counts towards
+// the crit total if either its CPU or memory is above the crit level, and
+// otherwise towards the warn total if either is above the warn level.
+func getOverview(statsFiles []StatsFile, thresholds Thresholds, timeLayout string) Overview {
+	var overview Overview
+	if len(statsFiles) == 0 {
+		return overview
+	}
+
+	// Files are sorted newest first
+	latest := statsFiles[0]
+	overview.TotalContainers = len(latest.Stats)
+	overview.NewestTimestamp = latest.Timestamp.Format(timeLayout)
+
+	for _, stat := range latest.Stats {
+		cpuPerc := parsePercent(stat.CPUPerc)
+		memPerc := parsePercent(stat.MemPerc)
+		overview.TotalCPU += cpuPerc
+		overview.TotalMem += memPerc
+
+		if cpuPerc > thresholds.CPU.Crit || memPerc > thresholds.Mem.Crit {
+			overview.CritCount++
+		} else if cpuPerc > thresholds.CPU.Warn || memPerc > thresholds.Mem.Warn {
+			overview.WarnCount++
+		}
+
+		if overview.Hottest == nil || cpuPerc > overview.Hottest.CPUPerc {
+			overview.Hottest = &HottestContainer{
+				ContainerID:   stat.ID,
+				ContainerName: stat.Name,
+				CPUPerc:       cpuPerc,
+				MemPerc:       memPerc,
+			}
+		}
+	}
+
+	return overview
+}
+
+// DatasetStats summarizes everything the server holds
+type DatasetStats struct {
+	TotalFiles      int     `json:"total_files"`
+	TotalContainers int     `json:"total_containers"`
+	TotalDataPoints int     `json:"total_data_points"`
+	AvgCPU          float64 `json:"avg_cpu"`
+	AvgMem          float64 `json:"avg_mem"`
+	FirstTimestamp  string  `json:"first_timestamp"`
+	LastTimestamp   string  `json:"last_timestamp"`
+	SpanSeconds     float64 `json:"span_seconds"`
+}
+
+// datasetCollector computes totals and averages across all data points of
+// all files, one stats file at a time
+type datasetCollector struct {
+	files          int
+	dataPoints     int
+	containers     map[string]bool
+	cpuSum, memSum float64
+	first, last    time.Time
+}
+
+func newDatasetCollector() *datasetCollector {
+	return &datasetCollector{containers: make(map[string]bool)}
+}
+
+// add adds a stats file's timestamp and data points to the totals
+func (c *datasetCollector) add(statsFile StatsFile) {
+	if c.files == 0 || statsFile.Timestamp.Before(c.first) {
+		c.first = statsFile.Timestamp
+	}
+	if c.files == 0 || statsFile.Timestamp.After(c.last) {
+		c.last = statsFile.Timestamp
+	}
+	c.files++
+	for _, stat := range statsFile.Stats {
+		c.containers[stat.ID] = true
+		c.cpuSum += parsePercent(stat.CPUPerc)
+		c.memSum += parsePercent(stat.MemPerc)
+		c.dataPoints++
+	}
+}
+
+// stats returns the totals and averages of the collected files
+func (c *datasetCollector) stats(timeLayout string) DatasetStats {
+	stats := DatasetStats{TotalFiles: c.files}
+	if c.files == 0 {
+		return stats
+	}
+
+	stats.TotalContainers = len(c.containers)
+	stats.TotalDataPoints = c.dataPoints
+	if c.dataPoints > 0 {
+		stats.AvgCPU = c.cpuSum / float64(c.dataPoints)
+		stats.AvgMem = c.memSum / float64(c.dataPoints)
+	}
+	stats.FirstTimestamp = c.first.Format(timeLayout)
+	stats.LastTimestamp = c.last.Format(timeLayout)
+	stats.SpanSeconds = c.last.Sub(c.first).Seconds()
+	return stats
+}
+
+// HeatmapCell holds the fleet averages for one hour of the day, optionally
+// within one day of the week (0 is Sunday)
+type HeatmapCell struct {
+	Day     *int    `json:"day,omitempty"`
+	Hour    int     `json:"hour"`
+	Samples int     `json:"samples"`
+	AvgCPU  float64 `json:"avg_cpu"`
+	AvgMem  float64 `json:"avg_mem"`
+}
+
+// heatmapCollector buckets every container data point by the hour of day of
+// its file, and by day of week too if byDay is set, one stats file at a time
+type heatmapCollector struct {
+	byDay bool
+	// Indexed by day*24+hour; the day is always 0 without byDay
+	buckets [7 * 24]heatmapBucket
+}
+
+type heatmapBucket struct {
+	samples        int
+	cpuSum, memSum float64
+}
+
+func newHeatmapCollector(byDay bool) *heatmapCollector {
+	return &heatmapCollector{byDay: byDay}
+}
+
+// add adds a stats file's data points to the bucket of its timestamp
+func (c *heatmapCollector) add(statsFile StatsFile) {
+	key := statsFile.Timestamp.Hour()
+	if c.byDay {
+		key += int(statsFile.Timestamp.Weekday()) * 24
+	}
+	for _, stat := range statsFile.Stats {
+		c.buckets[key].samples++
+		c.buckets[key].cpuSum += parsePercent(stat.CPUPerc)
+		c.buckets[key].memSum += parsePercent(stat.MemPerc)
+	}
+}
+
+// cells returns the averages of the non-empty buckets, ordered by day, then
+// hour
+func (c *heatmapCollector) cells() []HeatmapCell {
+	cells := []HeatmapCell{}
+	for key, b := range c.buckets {
+		if b.samples == 0 {
+			continue
+		}
+		cell := HeatmapCell{
+			Hour:    key % 24,
+			Samples: b.samples,
+			AvgCPU:  b.cpuSum / float64(b.samples),
+			AvgMem:  b.memSum / float64(b.samples),
+		}
+		if c.byDay {
+			day := key / 24
+			cell.Day = &day
+		}
+		cells = append(cells, cell)
+	}
+	return cells
+}
+
+// CalendarDay holds a container's CPU and memory over one calendar day
+type CalendarDay struct {
+	Date       string  `json:"date"`
+	DataPoints int     `json:"data_points"`
+	AvgCPU     float64 `json:"avg_cpu"`
+	MaxCPU     float64 `json:"max_cpu"`
+	AvgMem     float64 `json:"avg_mem"`
+	MaxMem     float64 `json:"max_mem"`
+}
+
+// containerCalendar buckets oldest-first data points by the calendar day of
+// their timestamp, in the timestamp's own time zone. Days without data
+// points are omitted, and the days are ordered oldest first.
+func containerCalendar(dataPoints []ContainerDataPoint) []CalendarDay {
+	days := []CalendarDay{}
+	for _, point := range dataPoints {
+		date := point.Time.Format("2006-01-02")
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, CalendarDay{Date: date, MaxCPU: point.CPUPerc, MaxMem: point.MemPerc})
+		}
+		day := &days[len(days)-1]
+		day.DataPoints++
+		// Sum into the averages and divide once the day is complete
+		day.AvgCPU += point.CPUPerc
+		day.AvgMem += point.MemPerc
+		day.MaxCPU = math.Max(day.MaxCPU, point.CPUPerc)
+		day.MaxMem = math.Max(day.MaxMem, point.MemPerc)
+	}
+	for i := range days {
+		days[i].AvgCPU /= float64(days[i].DataPoints)
+		days[i].AvgMem /= float64(days[i].DataPoints)
+	}
+	return days
+}
+
+// PeakEntry names the containers with the highest CPU and memory in one stats
+// file. The fields are nil for a file without containers.
+type PeakEntry struct {
+	Timestamp       string   `json:"timestamp"`
+	TopCPUContainer *string  `json:"top_cpu_container"`
+	TopCPUValue     *float64 `json:"top_cpu_value"`
+	TopMemContainer *string  `json:"top_mem_container"`
+	TopMemValue     *float64 `json:"top_mem_value"`
+}
+
+// getPeak returns the PeakEntry of a stats file. Ties go to the container
+// listed first in the file.
+func getPeak(statsFile StatsFile, timeLayout string) PeakEntry {
+	entry := PeakEntry{Timestamp: statsFile.Timestamp.Format(timeLayout)}
+	for j, stat := range statsFile.Stats {
+		name := stat.Name
+		cpu, mem := parsePercent(stat.CPUPerc), parsePercent(stat.MemPerc)
+		if j == 0 || cpu > *entry.TopCPUValue {
+			entry.TopCPUContainer, entry.TopCPUValue = &name, &cpu
+		}
+		if j == 0 || mem > *entry.TopMemValue {
+			entry.TopMemContainer, entry.TopMemValue = &name, &mem
+		}
+	}
+	return entry
+}
+
+// NearestFile is the stats file whose timestamp is closest to a given time
+type NearestFile struct {
+	// Index is the file's position in the dashboard dropdown (newest is 0)
+	Index     int    `json:"index"`
+	File      string `json:"file"`
+	Timestamp string `json:"timestamp"`
+	// DiffSeconds is the absolute difference to the requested time
+	DiffSeconds float64 `json:"diff_seconds"`
+	// Clamped is "before_first" or "after_last" for times outside the
+	// files' span
+	Clamped string `json:"clamped,omitempty"`
+}
+
+// nearestFile returns the index of the newest-first file whose timestamp is
+// closest to t, preferring the older file on a tie, and how far outside
+// the files' span t lies. There must be at least one file.
+func nearestFile(statsFiles []StatsFile, t time.Time) (int, string) {
+	if t.Before(statsFiles[len(statsFiles)-1].Timestamp) {
+		return len(statsFiles) - 1, "before_first"
+	}
+	if t.After(statsFiles[0].Timestamp) {
+		return 0, "after_last"
+	}
+	// The first file at or before t, and the one after it
+	i := sort.Search(len(statsFiles), func(i int) bool {
+		return !statsFiles[i].Timestamp.After(t)
+	})
+	if i > 0 && statsFiles[i-1].Timestamp.Sub(t) < t.Sub(statsFiles[i].Timestamp) {
+		return i - 1, ""
+	}
+	return i, ""
+}
+
+// ContainerCount is the number of containers in one stats file
+type ContainerCount struct {
+	Timestamp string `json:"timestamp"`
+	Count     int    `json:"count"`
+}
+
+// getContainerCounts returns the number of containers in every stats file,
+// oldest first, after any containers excluded at load time were dropped
+func getContainerCounts(statsFiles []StatsFile, timeLayout string) []ContainerCount {
+	counts := make([]ContainerCount, 0, len(statsFiles))
+	// Files are sorted newest first
+	for i := len(statsFiles) - 1; i >= 0; i-- {
+		counts = append(counts, ContainerCount{
+			Timestamp: statsFiles[i].Timestamp.Format(timeLayout),
+			Count:     len(statsFiles[i].Stats),
+		})
+	}
+	return counts
+}
+
+// QueryIndex holds every container data point of the loaded stats files in
+// an in-memory SQLite table for /api/query
+type QueryIndex struct {
+	db *sql.DB
+}
+
+// newQueryIndex loads the data points of the stats files into a new
+// in-memory database. Under -low-memory the files are read one at a time,
+// so their stats are only held by the database.
+func newQueryIndex(statsFiles []StatsFile, opts LoadOptions) (*QueryIndex, error) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// Every connection to :memory: opens a separate empty database, so all
+	// queries have to share the one the table was created in
+	db.SetMaxOpenConns(1)
+	index := &QueryIndex{db: db}
+	if err := index.load(statsFiles, opts); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error building query index: %v", err)
+	}
+	return index, nil
+}
+
+// load creates the points table and inserts one row per container and file.
+// local_ts is ts shifted by the -tz offset at that instant, so buckets can
+// follow the wall clock the pages show.
+func (index *QueryIndex) load(statsFiles []StatsFile, opts LoadOptions) error {
+	if _, err := index.db.Exec(`CREATE TABLE points (
+		container_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		ts INTEGER NOT NULL,
+		local_ts INTEGER NOT NULL,
+		cpu REAL NOT NULL,
+		mem REAL NOT NULL
+	)`); err != nil {
+		return err
+	}
+	tx, err := index.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insert, err := tx.Prepare("INSERT INTO points (container_id, name, ts, local_ts, cpu, mem) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	forEachStatsFile(statsFiles, opts, func(statsFile StatsFile) {
+		ts := statsFile.Timestamp.Unix()
+		_, offset := statsFile.Timestamp.In(displayLocation).Zone()
+		for _, stat := range statsFile.Stats {
+			if err == nil {
+				_, err = insert.Exec(stat.ID, stat.Name, ts, ts+int64(offset), parsePercent(stat.CPUPerc), parsePercent(stat.MemPerc))
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close releases the database
+func (index *QueryIndex) Close() error {
+	return index.db.Close()
+}
+
+// queryAggregations are the SQL aggregate functions /api/query can apply to
+// a metric column; p95 is registered by init below
+var queryAggregations = map[string]string{
+	"avg":   "AVG",
+	"min":   "MIN",
+	"max":   "MAX",
+	"p95":   "p95",
+	"count": "COUNT",
+}
+
+// queryMetrics maps the metric parameter of /api/query to its column
+var queryMetrics = map[string]string{
+	"cpu": "cpu",
+	"mem": "mem",
+}
+
+// queryTemplates are the only statements /api/query runs, keyed by the by
+// parameter. The %[1]s verbs are replaced by a whitelisted aggregation of a
+// whitelisted column; everything taken from the request is passed as a
+// parameter. Each row is the group key, the container name, the number of
+// samples and the aggregated value. Buckets start at multiples of the bucket
+// size on the -tz wall clock, so e.g. 24h buckets begin at local midnight.
+// Each is keyed by the instant of its local start.
+var queryTemplates = map[string]string{
+	"container": `SELECT container_id,
+		(SELECT name FROM points latest WHERE latest.container_id = points.container_id ORDER BY ts DESC LIMIT 1),
+		COUNT(*), %[1]s
+		FROM points
+		WHERE ts BETWEEN :from AND :to AND (:container = '' OR container_id = :container)
+		GROUP BY container_id
+		ORDER BY container_id`,
+	"bucket": `SELECT MIN(ts - local_ts %% :bucket) AS start, '', COUNT(*), %[1]s
+		FROM points
+		WHERE ts BETWEEN :from AND :to AND (:container = '' OR container_id = :container)
+		GROUP BY local_ts - local_ts %% :bucket
+		ORDER BY start`,
+}
+
+func init() {
+	// p95 gives /api/query the same interpolated percentile as the summaries
+	sqlite.MustRegisterFunction("p95", &sqlite.FunctionImpl{
+		NArgs:         1,
+		Deterministic: true,
+		MakeAggregate: func(sqlite.FunctionContext) (sqlite.AggregateFunction, error) {
+			return &percentileAggregate{p: 95}, nil
+		},
+	})
+}
+
+// percentileAggregate collects the values of a group for an SQL percentile
+type percentileAggregate struct {
+	p      float64
+	values []float64
+}
+
+// Step adds the value of one row
+func (a *percentileAggregate) Step(_ *sqlite.FunctionContext, args []driver.Value) error {
+	switch v := args[0].(type) {
+	case float64:
+		a.values = append(a.values, v)
+	case int64:
+		a.values = append(a.values, float64(v))
+	}
+	return nil
+}
+
+// WindowInverse is not supported, the percentile is only used as a plain
+// aggregate
+func (a *percentileAggregate) WindowInverse(*sqlite.FunctionContext, []driver.Value) error {
+	return fmt.Errorf("p%v cannot be used as a window function", a.p)
+}
+
+// WindowValue returns the percentile of the values so far
+func (a *percentileAggregate) WindowValue(*sqlite.FunctionContext) (driver.Value, error) {
+	return percentile(a.values, a.p), nil
+}
+
+// Final has nothing to release
+func (a *percentileAggregate) Final(*sqlite.FunctionContext) {}
+
+// Query is one templated aggregation: Agg over Metric, grouped By container
+// or by time bucket, optionally limited to one container
+type Query struct {
+	Agg       string
+	Metric    string
+	By        string
+	Bucket    time.Duration
+	Container string
+}
+
+// QueryRow is one group of a query result. Key is the container ID or the
+// start of the time bucket.
+type QueryRow struct {
+	Key     string  `json:"key"`
+	Name    string  `json:"name,omitempty"`
+	Samples int     `json:"samples"`
+	Value   float64 `json:"value"`
+}
+
+// parseQuery reads a Query from the agg, metric, by, bucket and container
+// parameters, rejecting anything outside the predefined templates
+func parseQuery(r *http.Request) (Query, error) {
+	params := r.URL.Query()
+	q := Query{
+		Agg:       params.Get("agg"),
+		Metric:    params.Get("metric"),
+		By:        params.Get("by"),
+		Bucket:    time.Hour,
+		Container: params.Get("container"),
+	}
+	if _, ok := queryAggregations[q.Agg]; !ok {
+		return q, fmt.Errorf("agg must be one of avg, min, max, p95 or count")
+	}
+	if q.Metric == "" {
+		q.Metric = "cpu"
+	}
+	if _, ok := queryMetrics[q.Metric]; !ok {
+		return q, fmt.Errorf("invalid metric %q, expected cpu or mem", q.Metric)
+	}
+	if q.By == "" {
+		q.By = "container"
+	}
+	if _, ok := queryTemplates[q.By]; !ok {
+		return q, fmt.Errorf("by must be container or bucket")
+	}
+	if bucket := params.Get("bucket"); bucket != "" {
+		d, err := time.ParseDuration(bucket)
+		if err != nil || d < time.Second {
+			return q, fmt.Errorf("invalid bucket parameter %q, expected a duration of at least 1s", bucket)
+		}
+		q.Bucket = d
+	}
+	return q, nil
+}
+
+// Run aggregates the data points of the stats files, which must be sorted
+// newest first, with the query's template. Container groups are ordered by
+// ID, bucket groups oldest first.
+func (index *QueryIndex) Run(statsFiles []StatsFile, q Query, timeLayout string) ([]QueryRow, error) {
+	rows := []QueryRow{}
+	if len(statsFiles) == 0 {
+		return rows, nil
+	}
+	statement := fmt.Sprintf(queryTemplates[q.By], queryAggregations[q.Agg]+"("+queryMetrics[q.Metric]+")")
+	result, err := index.db.Query(statement,
+		sql.Named("from", statsFiles[len(statsFiles)-1].Timestamp.Unix()),
+		sql.Named("to", statsFiles[0].Timestamp.Unix()),
+		sql.Named("container", q.Container),
+		sql.Named("bucket", int64(q.Bucket/time.Second)))
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var row QueryRow
+		var key interface{}
+		if err := result.Scan(&key, &row.Name, &row.Samples, &row.Value); err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case int64:
+			row.Key = time.Unix(key, 0).In(displayLocation).Format(timeLayout)
+		case string:
+			row.Key = key
+		}
+		rows = append(rows, row)
+	}
+	return rows, result.Err()
+}
+
+// NetworkTalker holds the bytes a container received and sent over its history
+type NetworkTalker struct {
+	ContainerID   string `json:"container_id"`
+	ContainerName string `json:"container_name"`
+	RxBytes       int64  `json:"rx_bytes"`
+	TxBytes       int64  `json:"tx_bytes"`
+	TotalBytes    int64  `json:"total_bytes"`
+}
+
+// getNetworkTop ranks the containers by total network bytes, most first,
+// from the NetIO totals of their summaries, and returns the top n
+func getNetworkTop(summaries []ContainerSummary, n int) []NetworkTalker {
+	talkers := make([]NetworkTalker, 0, len(summaries))
+	for _, summary := range summaries {
+		talkers = append(talkers, NetworkTalker{
+			ContainerID:   summary.ContainerID,
+			ContainerName: summary.ContainerName,
+			RxBytes:       summary.NetInTotal,
+			TxBytes:       summary.NetOutTotal,
+			TotalBytes:    summary.NetInTotal + summary.NetOutTotal,
+		})
+	}
+	sort.SliceStable(talkers, func(i, j int) bool {
+		return talkers[i].TotalBytes > talkers[j].TotalBytes
+	})
+	if len(talkers) > n {
+		talkers = talkers[:n]
+	}
+	return talkers
+}
+
+// ContainerChange holds a container's CPU and memory in two stats files
+type ContainerChange struct {
+	ContainerID   string  `json:"container_id"`
+	ContainerName string  `json:"container_name"`
+	Status        string  `json:"status"` // "present", "new" or "gone"
+	OldCPU        float64 `json:"old_cpu"`
+	NewCPU        float64 `json:"new_cpu"`
+	DeltaCPU      float64 `json:"delta_cpu"`
+	OldMem        float64 `json:"old_mem"`
+	NewMem        float64 `json:"new_mem"`
+	DeltaMem      float64 `json:"delta_mem"`
+}
+
+// getChanges compares each container between an older and a newer stats
+// file. Containers only in the newer file are "new", those only in the
+// older one are "gone". The result follows the newer file's order, with
+// gone containers appended.
+func getChanges(older, newer StatsFile) []ContainerChange {
+	oldStats := make(map[string]DockerStat)
+	for _, stat := range older.Stats {
+		oldStats[stat.ID] = stat
+	}
+
+	changes := []ContainerChange{}
+	seen := make(map[string]bool)
+	for _, stat := range newer.Stats {
+		seen[stat.ID] = true
+		change := ContainerChange{
+			ContainerID:   stat.ID,
+			ContainerName: stat.Name,
+			Status:        "new",
+			NewCPU:        parsePercent(stat.CPUPerc),
+			NewMem:        parsePercent(stat.MemPerc),
+		}
+		if old, ok := oldStats[stat.ID]; ok {
+			change.Status = "present"
+			change.OldCPU = parsePercent(old.CPUPerc)
+			change.OldMem = parsePercent(old.MemPerc)
+			change.DeltaCPU = change.NewCPU - change.OldCPU
+			change.DeltaMem = change.NewMem - change.OldMem
+		}
+		changes = append(changes, change)
+	}
+
+	for _, stat := range older.Stats {
+		if seen[stat.ID] {
+			continue
+		}
+		changes = append(changes, ContainerChange{
+			ContainerID:   stat.ID,
+			ContainerName: stat.Name,
+			Status:        "gone",
+			OldCPU:        parsePercent(stat.CPUPerc),
+			OldMem:        parsePercent(stat.MemPerc),
+		})
+	}
+	return changes
+}
+
+// getRecentChanges returns the n containers present in both of the two
+// newest files with the largest absolute CPU change between them
+func getRecentChanges(statsFiles []StatsFile, n int) []ContainerChange {
+	recent := []ContainerChange{}
+	if len(statsFiles) < 2 {
+		return recent
+	}
+
+	// Files are sorted newest first
+	for _, change := range getChanges(statsFiles[1], statsFiles[0]) {
+		if change.Status == "present" {
+			recent = append(recent, change)
+		}
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return math.Abs(recent[i].DeltaCPU) > math.Abs(recent[j].DeltaCPU)
+	})
+	if len(recent) > n {
+		recent = recent[:n]
+	}
+	return recent
+}
+
+// DuplicateName lists the container IDs that were seen under the same name
+type DuplicateName struct {
+	Name       string               `json:"name"`
+	Containers []DuplicateContainer `json:"containers"`
+}
+
+// DuplicateContainer is one container ID sharing a name with others
+type DuplicateContainer struct {
+	ContainerID string `json:"container_id"`
+	FirstSeen   string `json:"first_seen"`
+	LastSeen    string `json:"last_seen"`
+}
+
+// getDuplicateNames returns the container names used by more than one
+// container ID, those with the most IDs first
+func getDuplicateNames(statsFiles []StatsFile, timeLayout string) []DuplicateName {
+	type seenRange struct {
+		id          string
+		first, last time.Time
+	}
+	nameIndex := make(map[string]map[string]*seenRange)
+
+	for _, statsFile := range statsFiles {
+		for _, stat := range statsFile.Stats {
+			ids, ok := nameIndex[stat.Name]
+			if !ok {
+				ids = make(map[string]*seenRange)
+				nameIndex[stat.Name] = ids
+			}
+			seen, ok := ids[stat.ID]
+			if !ok {
+				ids[stat.ID] = &seenRange{id: stat.ID, first: statsFile.Timestamp, last: statsFile.Timestamp}
+				continue
+			}
+			if statsFile.Timestamp.Before(seen.first) {
+				seen.first = statsFile.Timestamp
+			}
+			if statsFile.Timestamp.After(seen.last) {
+				seen.last = statsFile.Timestamp
+			}
+		}
+	}
+
+	duplicates := []DuplicateName{}
+	for name, ids := range nameIndex {
+		if len(ids) < 2 {
+			continue
+		}
+
+		var ranges []*seenRange
+		for _, seen := range ids {
+			ranges = append(ranges, seen)
+		}
+		// Order the IDs by when they first appeared, then by ID
+		sort.Slice(ranges, func(i, j int) bool {
+			if !ranges[i].first.Equal(ranges[j].first) {
+				return ranges[i].first.Before(ranges[j].first)
+			}
+			return ranges[i].id < ranges[j].id
+		})
+
+		duplicate := DuplicateName{Name: name}
+		for _, seen := range ranges {
+			duplicate.Containers = append(duplicate.Containers, DuplicateContainer{
+				ContainerID: seen.id,
+				FirstSeen:   seen.first.Format(timeLayout),
+				LastSeen:    seen.last.Format(timeLayout),
+			})
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+
+	sort.Slice(duplicates, func(i, j int) bool {
+		if len(duplicates[i].Containers) != len(duplicates[j].Containers) {
+			return len(duplicates[i].Containers) > len(duplicates[j].Containers)
+		}
+		return duplicates[i].Name < duplicates[j].Name
+	})
+
+	return duplicates
+}
+
+// FileRangeResult lists the containers of a stats file within a metric range
+type FileRangeResult struct {
+	File       string       `json:"file"`
+	Timestamp  string       `json:"timestamp"`
+	Metric     string       `json:"metric"`
+	Min        float64      `json:"min"`
+	Max        float64      `json:"max"`
+	Containers []DockerStat `json:"containers"`
+}
+
+// minOutlierSample is the smallest number of containers in a file for which
+// the interquartile range says anything meaningful about outliers
+const minOutlierSample = 4
+
+// FileOutliers lists the containers of a stats file whose CPU lies outside
+// the interquartile range fences of the file's CPU distribution
+type FileOutliers struct {
+	File       string   `json:"file"`
+	Timestamp  string   `json:"timestamp"`
+	Sufficient bool     `json:"sufficient"`
+	Q1         float64  `json:"q1"`
+	Q3         float64  `json:"q3"`
+	LowerFence float64  `json:"lower_fence"`
+	UpperFence float64  `json:"upper_fence"`
+	Count      int      `json:"count"`
+	Outliers   []string `json:"outliers"`
+}
+
+// getFileOutliers flags CPU outliers in a stats file with the IQR method:
+// values more than 1.5 interquartile ranges below the first or above the
+// third quartile. Files with fewer than minOutlierSample containers are
+// reported as insufficient and have no outliers.
+func getFileOutliers(statsFile StatsFile, timeLayout string) FileOutliers {
+	result := FileOutliers{
+		File:      statsFile.Name,
+		Timestamp: statsFile.Timestamp.Format(timeLayout),
+		Outliers:  []string{},
+	}
+	if len(statsFile.Stats) < minOutlierSample {
+		return result
+	}
+
+	values := make([]float64, len(statsFile.Stats))
+	for i, stat := range statsFile.Stats {
+		values[i] = parsePercent(stat.CPUPerc)
+	}
+	result.Sufficient = true
+	result.Q1 = percentile(values, 25)
+	result.Q3 = percentile(values, 75)
+	iqr := result.Q3 - result.Q1
+	result.LowerFence = result.Q1 - 1.5*iqr
+	result.UpperFence = result.Q3 + 1.5*iqr
+
+	for i, stat := range statsFile.Stats {
+		if values[i] < result.LowerFence || values[i] > result.UpperFence {
+			result.Outliers = append(result.Outliers, stat.ID)
+		}
+	}
+	result.Count = len(result.Outliers)
+	return result
+}
+
+// statMetric returns the named percentage metric ("cpu" or "mem") of a stat
+func statMetric(stat DockerStat, metric string) (float64, error) {
+	switch metric {
+	case "cpu":
+		return parsePercent(stat.CPUPerc), nil
+	case "mem":
+		return parsePercent(stat.MemPerc), nil
+	default:
+		return 0, fmt.Errorf("invalid metric %q, expected cpu or mem", metric)
+	}
+}
+
+// filterStatsByRange returns the stats whose metric lies within [minValue, maxValue]
+func filterStatsByRange(stats []DockerStat, metric string, minValue, maxValue float64) ([]DockerStat, error) {
+	matching := []DockerStat{}
+	for _, stat := range stats {
+		value, err := statMetric(stat, metric)
+		if err != nil {
+			return nil, err
+		}
+		if value >= minValue && value <= maxValue {
+			matching = append(matching, stat)
+		}
+	}
+	return matching, nil
+}
+
+// averageStatsFile returns a copy of the selected file whose CPU and memory
+// percentages are replaced by each container's average over the selected
+// file and the window-1 files preceding it. Containers missing from some of
+// those files are averaged over the files they appear in.
+func averageStatsFile(statsFiles []StatsFile, selected, window int) StatsFile {
+	result := statsFiles[selected]
+	if window <= 1 {
+		return result
+	}
+
+	// Files are sorted newest first, so older files follow the selected one
+	end := min(selected+window, len(statsFiles))
+	cpuSums := make(map[string]float64)
+	memSums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, statsFile := range statsFiles[selected:end] {
+		for _, stat := range statsFile.Stats {
+			cpuSums[stat.ID] += parsePercent(stat.CPUPerc)
+			memSums[stat.ID] += parsePercent(stat.MemPerc)
+			counts[stat.ID]++
+		}
+	}
+
+	result.Stats = make([]DockerStat, len(statsFiles[selected].Stats))
+	for i, stat := range statsFiles[selected].Stats {
+		count := float64(counts[stat.ID])
+		stat.CPUPerc = fmt.Sprintf("%.2f%%", cpuSums[stat.ID]/count)
+		stat.MemPerc = fmt.Sprintf("%.2f%%", memSums[stat.ID]/count)
+		result.Stats[i] = stat
+	}
+	return result
+}
+
+// defaultPageSize is the number of containers per dashboard page
+const defaultPageSize = 50
+
+// Pagination describes the page of the dashboard table being shown, with
+// links to the neighbouring pages that keep the other query parameters
+type Pagination struct {
+	Page     int
+	PageSize int
+	Pages    int
+	Total    int
+	PrevURL  string
+	NextURL  string
+}
+
+// paginate returns the bounds of the given 1-based page of total items,
+// clamping the page into range
+func paginate(total, page, pageSize int) (Pagination, int, int) {
+	pages := max(1, (total+pageSize-1)/pageSize)
+	page = min(max(page, 1), pages)
+	start := (page - 1) * pageSize
+	return Pagination{Page: page, PageSize: pageSize, Pages: pages, Total: total}, start, min(start+pageSize, total)
+}
+
+// pageURL returns the request's URL with the page parameter replaced
+func pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return "?" + query.Encode()
+}
+
+const htmlTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Docker Stats Viewer</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            margin: 20px;
+            background-color: #121212;
+            color: #e0e0e0;
+        }
+        table {
+            border-collapse: collapse;
+            width: 100%;
+            margin-top: 20px;
+            background-color: #1e1e1e;
+            color: #e0e0e0;
+        }
+        th, td {
+            border: 1px solid #333;
+            padding: 8px;
+            text-align: left;
+        }
+        th {
+            background-color: #333;
+            cursor: pointer;
+            user-select: none;
+        }
+        th:hover {
+            background-color: #444;
+        }
+        select {
+            padding: 5px;
+            margin: 10px 0;
+            background-color: #1e1e1e;
+            color: #e0e0e0;
+            border: 1px solid #333;
+        }
+        .stats-summary {
+            background: #1e1e1e;
+            padding: 15px;
+            margin: 10px 0;
+            border-radius: 5px;
+            border: 1px solid #333;
+        }
+        .pagination {
+            margin: 15px 0;
+            display: flex;
+            gap: 15px;
+            align-items: center;
+        }
+        .pagination a {
+            color: #64b5f6;
+            text-decoration: none;
+            padding: 5px 10px;
+            border: 1px solid #64b5f6;
+            border-radius: 3px;
+        }
+        .pagination .disabled {
+            color: #555;
+            padding: 5px 10px;
+            border: 1px solid #333;
+            border-radius: 3px;
+        }
+        .high-usage {
+            background-color: #ff5252;
+        }
+        .medium-usage {
+            background-color: #ffb74d;
+        }
+        .delta-up { color: #ff5252; font-weight: bold; }
+        .delta-down { color: #28a745; font-weight: bold; }
+        .delta-flat { color: #9e9e9e; }
+        .hottest {
+            outline: 3px solid #ff5252;
+            outline-offset: -3px;
+        }
+        .mem-bar {
+            display: inline-block;
+            width: 60px;
+            height: 8px;
+            margin-right: 6px;
+            background-color: #333;
+            border-radius: 4px;
+            overflow: hidden;
+            vertical-align: middle;
+        }
+        .mem-bar-fill { height: 100%; background-color: #28a745; }
+        .mem-bar-fill.bar-medium { background-color: #fd7e14; }
+        .mem-bar-fill.bar-high { background-color: #dc3545; }
+        .modal {
+            display: none;
+            position: fixed;
+            z-index: 1000;
+            left: 0;
+            top: 0;
+            width: 100%;
+            height: 100%;
+            background-color: rgba(0, 0, 0, 0.8);
+            overflow-y: auto;
+        }
+        .modal-content {
+            background-color: #1e1e1e;
+            margin: 0;
+            padding: 20px;
+            width: 100%;
+            height: 100%;
+            position: relative;
+            box-sizing: border-box;
+            color: #e0e0e0;
+        }
+        .close {
+            color: #aaa;
+            float: right;
+            font-size: 28px;
+            font-weight: bold;
+            cursor: pointer;
+            position: fixed;
+            right: 25px;
+            top: 20px;
+            background: #333;
+            border: 2px solid #555;
+            border-radius: 50%;
+            width: 40px;
+            height: 40px;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            z-index: 1001;
+        }
+        .close:hover,
+        .close:focus {
+            color: white;
+        }
+        .clickable-id {
+            color: #64b5f6;
+            cursor: pointer;
+            text-decoration: underline;
+        }
+        .clickable-id:hover {
+            color: #42a5f5;
+        }
+        .loading {
+            text-align: center;
+            padding: 20px;
+        }
+    </style>
+</head>
+<body>
+    <h1>Docker Stats Viewer</h1>
+    
+    <div style="margin-bottom: 20px; display: flex; gap: 10px; align-items: center;">
+        <a href="/summary" style="background: #64b5f6; color: white; padding: 10px 20px; text-decoration: none; border-radius: 5px;">View Summary Report</a>
+        <a href="/network" style="background: #64b5f6; color: white; padding: 10px 20px; text-decoration: none; border-radius: 5px;">Network Top Talkers</a>
+        <button id="runScriptBtn" style="background: #43a047; color: white; padding: 10px 20px; border: none; border-radius: 5px; cursor: pointer;">Run Stats Script</button>
+        <span id="runScriptStatus" style="margin-left: 10px;"></span>
+    </div>
+    
+    {{if .Files}}
+    <div class="stats-summary">
+        <h3>File: {{.SelectedFile.Name}}</h3>
+        <p>Timestamp: {{humanTime .SelectedFile.Timestamp}}</p>
+        <p>Total containers: {{len .SelectedFile.Stats}}</p>
+        {{if gt .AvgWindow 1}}<p>CPU and memory percentages are averaged over the last {{.AvgWindow}} snapshots</p>{{end}}
+    </div>
+
+    <form method="GET">
+        <label for="file">Select stats file:</label>
+        <select name="file" id="file" onchange="this.form.submit()">
+            {{range $i, $file := .Files}}
+            <option value="{{$i}}" {{if eq $i $.SelectedIndex}}selected{{end}}>
+                {{$file.Name}} ({{humanTime $file.Timestamp}}) ({{age $file.Timestamp (index $.Files 0).Timestamp}})
+            </option>
+            {{end}}
+        </select>
+        <label for="avg" style="margin-left: 15px;">Average over last</label>
+        <input type="number" name="avg" id="avg" min="1" value="{{.AvgWindow}}" onchange="this.form.submit()" style="width: 60px; padding: 5px; background-color: #1e1e1e; color: #e0e0e0; border: 1px solid #333;">
+        <span>snapshots</span>
+        <label for="diff_back" style="margin-left: 15px;">Compare to</label>
+        <input type="number" name="diff_back" id="diff_back" min="1" value="{{if .DiffBack}}{{.DiffBack}}{{end}}" placeholder="5" onchange="this.form.submit()" style="width: 60px; padding: 5px; background-color: #1e1e1e; color: #e0e0e0; border: 1px solid #333;">
+        <span>snapshots ago</span>
+        <label style="margin-left: 15px;"><input type="checkbox" name="accent" value="1" {{if .ContainerAccents}}checked{{end}} onchange="this.form.submit()"> Color rows by container</label>
+        <input type="hidden" name="focus" value="0">
+        <label style="margin-left: 15px;"><input type="checkbox" name="focus" value="1" {{if .FocusHottest}}checked{{end}} onchange="this.form.submit()"> Focus hottest container</label>
+        <input type="hidden" name="pageSize" value="{{.Page.PageSize}}">
+    </form>
+
+    <div style="margin: 10px 0;">
+        <label for="searchInput">Search by container name:</label>
+        <input type="text" id="searchInput" placeholder="Enter container name..." onkeyup="filterTable()" style="padding: 5px; margin-left: 10px; width: 250px; background-color: #1e1e1e; color: #e0e0e0; border: 1px solid #333;">
+        <button onclick="clearSearch()" style="margin-left: 5px; padding: 5px 10px; background-color: #64b5f6; color: white; border: none; border-radius: 3px;">Clear</button>
+        {{if gt .Page.Pages 1}}<span style="margin-left: 10px; color: #9e9e9e;">Search and sorting apply to this page only</span>{{end}}
+    </div>
+
+    <table id="statsTable">
+        <thead>
+            <tr>
+                <th onclick="sortTable(this.cellIndex)">Container Name</th>
+                <th onclick="sortTable(this.cellIndex)">ID</th>
+                {{if .Columns.cpu}}<th onclick="sortTable(this.cellIndex)" data-sort="percent">CPU %</th>{{end}}
+                {{if .Columns.cpu_history}}<th>CPU History</th>{{end}}
+                {{if .Columns.mem}}<th onclick="sortTable(this.cellIndex)" data-sort="percent">Memory %</th>{{end}}
+                {{if .Columns.mem_usage}}<th onclick="sortTable(this.cellIndex)">Memory Usage</th>{{end}}
+                {{if .Columns.net_io}}<th onclick="sortTable(this.cellIndex)">Network I/O</th>{{end}}
+                {{if .Columns.block_io}}<th onclick="sortTable(this.cellIndex)">Block I/O</th>{{end}}
+                {{if .Columns.pids}}<th onclick="sortTable(this.cellIndex)">PIDs</th>{{end}}
+            </tr>
+        </thead>
+        <tbody>
+            {{range .PageStats}}
+            <tr class="{{if gt (parseFloat .MemPerc) $.Thresholds.Mem.Crit}}high-usage{{else if gt (parseFloat .MemPerc) $.Thresholds.Mem.Warn}}medium-usage{{end}}{{if eq .ID $.HottestID}} hottest{{end}}"{{if eq .ID $.HottestID}} id="hottest"{{end}}{{if $.ContainerAccents}} style="border-left: 6px solid {{containerColor .ID}}"{{end}}>
+                <td{{if .Source}} title="From {{.Source}}"{{end}}>{{.Name}}</td>
+                <td><a href="/container/{{.ID}}" class="clickable-id">{{.ID}}</a></td>
+                {{if $.Columns.cpu}}<td>{{.CPUPerc}}</td>{{end}}
+                {{if $.Columns.cpu_history}}<td>{{sparkline (index $.CPUSeries .ID)}}</td>{{end}}
+                {{if $.Columns.mem}}<td>{{.MemPerc}}</td>{{end}}
+                {{if $.Columns.mem_usage}}<td>{{with memBar .MemUsage $.Thresholds.Mem}}<span class="mem-bar" title="{{num .Percent 1}}% of the limit"><span class="mem-bar-fill {{.Class}}" style="width: {{printf "%.1f" .Percent}}%"></span></span>{{end}}{{if memBar .MemUsage $.Thresholds.Mem}}{{.MemUsage}}{{else}}{{.MemPerc}}{{end}}</td>{{end}}
+                {{if $.Columns.net_io}}<td>{{.NetIO}}</td>{{end}}
+                {{if $.Columns.block_io}}<td>{{.BlockIO}}</td>{{end}}
+                {{if $.Columns.pids}}<td>{{.PIDs}}</td>{{end}}
+            </tr>
+            {{end}}
+        </tbody>
+    </table>
+
+    {{if gt .Page.Pages 1}}
+    <div class="pagination">
+        {{with .Page.PrevURL}}<a href="{{.}}">&larr; Prev</a>{{else}}<span class="disabled">&larr; Prev</span>{{end}}
+        <span>Page {{.Page.Page}} of {{.Page.Pages}} ({{.Page.Total}} containers)</span>
+        {{with .Page.NextURL}}<a href="{{.}}">Next &rarr;</a>{{else}}<span class="disabled">Next &rarr;</span>{{end}}
+    </div>
+    {{end}}
+
+    {{if .Changes}}
+    <h2>Changes since {{.DiffBack}} snapshot{{if gt .DiffBack 1}}s{{end}} ago ({{humanTime .DiffFile.Timestamp}})</h2>
+    <table id="changesTable">
+        <thead>
+            <tr>
+                <th>Container Name</th>
+                <th>ID</th>
+                <th>CPU %</th>
+                <th>Memory %</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{range .Changes}}
+            <tr>
+                <td>{{.ContainerName}}</td>
+                <td><a href="/container/{{.ContainerID}}" class="clickable-id">{{.ContainerID}}</a></td>
+                {{if eq .Status "present"}}
+                <td>{{num .OldCPU 2}}% &rarr; {{num .NewCPU 2}}% {{template "delta" .DeltaCPU}}</td>
+                <td>{{num .OldMem 2}}% &rarr; {{num .NewMem 2}}% {{template "delta" .DeltaMem}}</td>
+                {{else}}
+                <td colspan="2"><em>{{.Status}}</em></td>
+                {{end}}
+            </tr>
+            {{end}}
+        </tbody>
+    </table>
+    {{end}}
+    {{else}}
+    <div class="stats-summary">
+        <h3>No data</h3>
+        <p>No stats files are currently loaded. New files will be shown after the next refresh.</p>
+    </div>
+    {{end}}
+
+    <!-- Modal -->
+    <div id="comparisonModal" class="modal">
+        <div class="modal-content">
+            <span class="close" onclick="closeModal()">&times;</span>
+            <div id="modalContent">
+                <div class="loading">Loading...</div>
+            </div>
+        </div>
+    </div>
+
+    <script>
+        // Highlighting levels and visible table columns configured on the server
+        const thresholds = {{.Thresholds}};
+        const columns = {{.Columns}};
+
+        document.addEventListener('DOMContentLoaded', function() {
+            const hottest = document.getElementById('hottest');
+            if (hottest) {
+                hottest.scrollIntoView({block: 'center'});
+            }
+            const btn = document.getElementById('runScriptBtn');
+            const status = document.getElementById('runScriptStatus');
+            if (btn) {
+                btn.onclick = async function() {
+                    status.textContent = 'Running...';
+                    status.style.color = '#ffb74d';
+                    try {
+                        const resp = await fetch('/api/run-script', {method: 'POST'});
+                        const data = await resp.json();
+                        if (data.success) {
+                            status.textContent = 'Script ran successfully!';
+                            status.style.color = '#43a047';
+                            setTimeout(() => location.reload(), 800);
+                        } else {
+                            status.textContent = 'Error: ' + (data.error || 'Unknown error');
+                            status.style.color = '#ff5252';
+                        }
+                    } catch (e) {
+                        status.textContent = 'Request failed';
+                        status.style.color = '#ff5252';
+                    }
+                }
+            }
+        });
+        let sortDirection = {};
+        
+        function sortTable(columnIndex) {
+            const table = document.getElementById('statsTable');
+            const tbody = table.querySelector('tbody');
+            const rows = Array.from(tbody.querySelectorAll('tr')).filter(row => row.style.display !== 'none');
+            // Column positions depend on -columns, so the header says how to sort
+            const isPercent = table.tHead.rows[0].cells[columnIndex].dataset.sort === 'percent';
+            
+            const isNumeric = (str) => {
+                if (isPercent) { // CPU % or Memory %
+                    return !isNaN(parseFloat(str.replace('%', '')));
+                }
+                return !isNaN(parseFloat(str));
+            };
+            
+            const getValue = (row, index) => {
+                let value = row.cells[index].textContent.trim();
+                if (isPercent) {
+                    return parseFloat(value.replace('%', '')) || 0;
+                }
+                return isNumeric(value) ? parseFloat(value) : value.toLowerCase();
+            };
+            
+            const currentDirection = sortDirection[columnIndex] || 'asc';
+            const newDirection = currentDirection === 'asc' ? 'desc' : 'asc';
+            sortDirection[columnIndex] = newDirection;
+            
+            rows.sort((a, b) => {
+                const aVal = getValue(a, columnIndex);
+                const bVal = getValue(b, columnIndex);
+                
+                let comparison = 0;
+                if (aVal < bVal) comparison = -1;
+                else if (aVal > bVal) comparison = 1;
+                
+                return newDirection === 'asc' ? comparison : -comparison;
+            });
+            
+            // Reorder rows
+            rows.forEach(row => tbody.appendChild(row));
+        }
+
+        function filterTable() {
+            const input = document.getElementById('searchInput');
+            const filter = input.value.toLowerCase();
+            const table = document.getElementById('statsTable');
+            const tbody = table.querySelector('tbody');
+            const rows = tbody.querySelectorAll('tr');
+            
+            rows.forEach(row => {
+                const containerName = row.cells[0].textContent.toLowerCase();
+                if (containerName.includes(filter)) {
+                    row.style.display = '';
+                } else {
+                    row.style.display = 'none';
+                }
+            });
+        }
+
+        function clearSearch() {
+            document.getElementById('searchInput').value = '';
+            filterTable();
+        }
+
+        function openModal(containerId) {
+            const modal = document.getElementById('comparisonModal');
+            const modalContent = document.getElementById('modalContent');
+            
+            modal.style.display = 'block';
+            modalContent.innerHTML = '<div class="loading">Loading comparison data...</div>';
+            
+            // Fetch comparison data over the same time range as the page
+            const params = new URLSearchParams();
+            const pageParams = new URLSearchParams(location.search);
+            ['range', 'from', 'to'].forEach(key => {
+                if (pageParams.get(key)) params.set(key, pageParams.get(key));
+            });
+            params.set('ts', 'human');
+            fetch('/api/container/' + containerId + '?' + params.toString())
+                .then(response => response.json())
+                .then(data => {
+                    displayComparisonData(data);
+                })
+                .catch(error => {
+                    modalContent.innerHTML = '<div style="color: red;">Error loading data: ' + error.message + '</div>';
+                });
+        }
+
+        // containerColor mirrors the Go helper of the same name: the hue comes
+        // from an FNV-1a hash of the container ID
+        function containerColor(id) {
+            let hash = 0x811c9dc5;
+            for (const byte of new TextEncoder().encode(id)) {
+                hash ^= byte;
+                hash = Math.imul(hash, 0x01000193) >>> 0;
+            }
+            return 'hsl(' + (hash % 360) + ', 65%, 55%)';
+        }
+
+        function closeModal() {
+            document.getElementById('comparisonModal').style.display = 'none';
+        }
+
+        function displayComparisonData(data) {
+            const modalContent = document.getElementById('modalContent');
+            
+            if (!data.data || data.data.length === 0) {
+                modalContent.innerHTML = '<h3>No historical data found for container: ' + data.container_id + '</h3>';
+                return;
+            }
+
+            let html = '<h1>Container Historical Analysis</h1>';
+            html += '<div style="background: #f8f9fa; padding: 15px; border-radius: 5px; margin-bottom: 20px; border-left: 6px solid ' + containerColor(data.container_id) + ';">';
+            html += '<h3>Container Information</h3>';
+            html += '<p><strong>Container Name:</strong> ' + (data.container_name || 'Unknown') + '</p>';
+            html += '<p><strong>Container ID:</strong> ' + data.container_id + '</p>';
+            html += '<p><strong>Total Data Points:</strong> ' + data.data.length + '</p>';
+            html += '</div>';
+
+            html += '<table class="comparison-table">';
+            html += '<thead><tr>';
+            html += '<th>Timestamp</th>';
+            if (columns.cpu) html += '<th>CPU %</th>';
+            if (columns.mem) html += '<th>Memory %</th>';
+            if (columns.mem_usage) html += '<th>Memory Usage</th>';
+            if (columns.net_io) html += '<th>Network I/O</th>';
+            if (columns.block_io) html += '<th>Block I/O</th>';
+            if (columns.pids) html += '<th>PIDs</th>';
+            html += '</tr></thead>';
+            html += '<tbody>';
+
+            data.data.forEach(point => {
+                const cpuClass = point.cpu_perc > thresholds.cpu.crit ? 'metric-high' : point.cpu_perc > thresholds.cpu.warn ? 'metric-medium' : 'metric-low';
+                const memClass = point.mem_perc > thresholds.mem.crit ? 'metric-high' : point.mem_perc > thresholds.mem.warn ? 'metric-medium' : 'metric-low';
+                
+                if (point.gap_before) {
+                    html += '<tr><td colspan="' + (1 + ['cpu', 'mem', 'mem_usage', 'net_io', 'block_io', 'pids'].filter(key => columns[key]).length) + '" style="text-align: center; font-style: italic; color: #ffb74d;">Gap in collection before this point</td></tr>';
+                }
+                html += '<tr>';
+                html += '<td>' + point.timestamp + '</td>';
+                if (columns.cpu) html += '<td class="' + cpuClass + '">' + point.cpu_perc.toFixed(2) + '%</td>';
+                if (columns.mem) html += '<td class="' + memClass + '">' + point.mem_perc.toFixed(2) + '%</td>';
+                if (columns.mem_usage) html += '<td>' + (point.mem_usage || 'N/A') + '</td>';
+                if (columns.net_io) html += '<td>' + (point.net_io || 'N/A') + '</td>';
+                if (columns.block_io) html += '<td>' + (point.block_io || 'N/A') + '</td>';
+                if (columns.pids) html += '<td>' + (point.pids || 'N/A') + '</td>';
+                html += '</tr>';
+            });
+
+            html += '</tbody></table>';
+
+            // Calculate averages
+            const avgCpu = data.data.reduce((sum, point) => sum + point.cpu_perc, 0) / data.data.length;
+            const avgMem = data.data.reduce((sum, point) => sum + point.mem_perc, 0) / data.data.length;
+            const maxCpu = Math.max(...data.data.map(point => point.cpu_perc));
+            const maxMem = Math.max(...data.data.map(point => point.mem_perc));
+            const minCpu = Math.min(...data.data.map(point => point.cpu_perc));
+            const minMem = Math.min(...data.data.map(point => point.mem_perc));
+
+            html += '<div style="margin-top: 30px; background: #f8f9fa; padding: 20px; border-radius: 5px;">';
+            html += '<h3>Summary Statistics</h3>';
+            html += '<div style="display: grid; grid-template-columns: repeat(2, 1fr); gap: 20px;">';
+            html += '<div>';
+            html += '<h4>CPU Usage</h4>';
+            html += '<p><strong>Average:</strong> ' + avgCpu.toFixed(2) + '%</p>';
+            html += '<p><strong>Peak:</strong> ' + maxCpu.toFixed(2) + '%</p>';
+            html += '<p><strong>Minimum:</strong> ' + minCpu.toFixed(2) + '%</p>';
+            html += '</div>';
+            html += '<div>';
+            html += '<h4>Memory Usage</h4>';
+            html += '<p><strong>Average:</strong> ' + avgMem.toFixed(2) + '%</p>';
+            html += '<p><strong>Peak:</strong> ' + maxMem.toFixed(2) + '%</p>';
+            html += '<p><strong>Minimum:</strong> ' + minMem.toFixed(2) + '%</p>';
+            html += '</div>';
+            html += '</div>';
+            html += '</div>';
+
+            modalContent.innerHTML = html;
+        }
+
+        // Close modal with Escape key
+        document.addEventListener('keydown', function(event) {
+            if (event.key === 'Escape') {
+                closeModal();
+            }
+        });
+    </script>
+</body>
+</html>
+{{define "delta"}}{{if gt . 0.0}}<span class="delta-up">&uarr; +{{num . 2}}</span>{{else if lt . 0.0}}<span class="delta-down">&darr; {{num . 2}}</span>{{else}}<span class="delta-flat">&rarr; {{num 0.0 2}}</span>{{end}}{{end}}
+`
+
+const containerPageTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Container Details - {{.ContainerName}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background-color: #121212; color: #e0e0e0; }
+        .back-link { 
+            display: inline-block; 
+            margin-bottom: 20px; 
+            color: #64b5f6; 
+            text-decoration: none; 
+            padding: 8px 15px;
+            border: 1px solid #64b5f6;
+            border-radius: 4px;
+        }
+        .back-link:hover { 
+            background-color: #64b5f6; 
+            color: white; 
+        }
+        .container-info { 
+            background: #1e1e1e; 
+            padding: 20px; 
+            border-radius: 5px; 
+            margin-bottom: 30px; 
+            border: 1px solid #333;
+        }
+        .status-line { font-size: 1.1em; }
+        .io-delta { color: #888; font-size: 0.9em; }
+        .chart-container {
+            background: #1e1e1e;
+            padding: 10px;
+            border-radius: 5px;
+            border: 1px solid #333;
+            margin-bottom: 30px;
+        }
+        .stats-grid { 
+            display: grid; 
+            grid-template-columns: repeat(2, 1fr); 
+            gap: 30px; 
+            margin-bottom: 30px; 
+        }
+        .stats-card { 
+            background: #1e1e1e; 
+            padding: 20px; 
+            border-radius: 5px; 
+            border: 1px solid #333;
+        }
+        table { 
+            border-collapse: collapse; 
+            width: 100%; 
+            margin-top: 20px; 
+            background-color: #1e1e1e;
+            color: #e0e0e0;
+        }
+        th, td { 
+            border: 1px solid #333; 
+            padding: 8px; 
+            text-align: left; 
+        }
+        th { 
+            background-color: #333; 
+            position: sticky; 
+            top: 0; 
+            z-index: 10; 
+        }
+        .metric-high { color: #dc3545; font-weight: bold; }
+        .metric-medium { color: #fd7e14; }
+        .metric-low { color: #28a745; }
+        .mem-bar {
+            display: inline-block;
+            width: 60px;
+            height: 8px;
+            margin-right: 6px;
+            background-color: #333;
+            border-radius: 4px;
+            overflow: hidden;
+            vertical-align: middle;
+        }
+        .mem-bar-fill { height: 100%; background-color: #28a745; }
+        .mem-bar-fill.bar-medium { background-color: #fd7e14; }
+        .mem-bar-fill.bar-high { background-color: #dc3545; }
+        .anomaly-row td { background-color: #4a2c2c; }
+        .gap-row td {
+            text-align: center;
+            font-style: italic;
+            color: #ffb74d;
+            background-color: #2a2a2a;
+        }
+        .no-data {
+            text-align: center;
+            padding: 40px;
+            color: #6c757d;
+            background: #1e1e1e;
+            border-radius: 5px;
+        }
+    </style>
+</head>
+<body>
+    <a href="/" class="back-link"><- Back to Dashboard</a>
+    {{if .Data}}<a href="/container/{{.ContainerID}}.csv" class="back-link" style="margin-left: 15px;">Download CSV</a>{{end}}
+    
+    <h1>Container Historical Analysis</h1>
+    
+    {{if .Data}}
+    <div class="container-info">
+        <h2>Container Information</h2>
+        <p><strong>Container Name:</strong> {{.ContainerName}}</p>
+        <p><strong>Container ID:</strong> {{.ContainerID}}</p>
+        <p class="status-line{{with .StatusClass}} {{.}}{{end}}">{{.StatusLine}}</p>
+        <p><strong>Total Data Points:</strong> {{len .Data}}</p>
+        <p><strong>Data Range:</strong> {{(index .Data 0).Timestamp}} to {{(index .Data (sub (len .Data) 1)).Timestamp}}</p>
+        {{if .AnomalyCount}}<p><strong>CPU Anomalies:</strong> <span class="metric-high">{{.AnomalyCount}}</span> data point{{if gt .AnomalyCount 1}}s{{end}} more than {{num .Stats.AnomalyZ 1}} standard deviations from the preceding {{.Stats.AnomalyWindow}}, highlighted below</p>{{end}}
+        {{if .ObservedInterval}}<p><strong>Observed Interval:</strong> {{.ObservedInterval}}{{if .IrregularInterval}} <span class="metric-medium" title="Many intervals differ from this by more than half, so rates are averaged over uneven periods">(irregular)</span>{{end}}</p>{{end}}
+        <form method="GET" action="/compare">
+            <input type="hidden" name="a" value="{{.ContainerID}}">
+            <label for="compareWith"><strong>Compare CPU with container ID:</strong></label>
+            <input type="text" name="b" id="compareWith" style="padding: 5px; background-color: #121212; color: #e0e0e0; border: 1px solid #333;">
+            <button type="submit" style="padding: 5px 10px; background-color: #64b5f6; color: white; border: none; border-radius: 3px;">Compare</button>
+        </form>
+    </div>
+
+    <div class="stats-grid">
+        <div class="stats-card">
+            <h3>CPU Usage Statistics</h3>
+            <p><strong>Average:</strong> {{num .AvgCPU 2}}%</p>
+            <p><strong>Peak:</strong> {{num .MaxCPU 2}}%</p>
+            <p><strong>Minimum:</strong> {{num .MinCPU 2}}%</p>
+        </div>
+        <div class="stats-card">
+            <h3>Memory Usage Statistics</h3>
+            <p><strong>Average:</strong> {{num .AvgMem 2}}% ({{humanBytes .AvgMemBytes}})</p>
+            <p><strong>Peak:</strong> {{num .MaxMem 2}}% ({{humanBytes .MaxMemBytes}})</p>
+            <p><strong>Minimum:</strong> {{num .MinMem 2}}% ({{humanBytes .MinMemBytes}})</p>
+        </div>
+        <div class="stats-card">
+            <h3>Network I/O</h3>
+            <p><strong>Received:</strong> {{humanBytes .NetInTotal}}</p>
+            <p><strong>Sent:</strong> {{humanBytes .NetOutTotal}}</p>
+        </div>
+        <div class="stats-card">
+            <h3>Block I/O</h3>
+            <p><strong>Read:</strong> {{humanBytes .BlockReadTotal}}</p>
+            <p><strong>Written:</strong> {{humanBytes .BlockWriteTotal}}</p>
+        </div>
+    </div>
+
+    {{with cpuMemChart .Data}}
+    <h2>CPU and Memory over Time</h2>
+    <div class="chart-container">{{.}}</div>
+    {{end}}
+
+    <h2>Historical Data</h2>
+    <table>
+        <thead>
+            <tr>
+                <th>Timestamp</th>
+                {{if .Columns.cpu}}<th>CPU %</th>{{end}}
+                {{if .Columns.mem}}<th>Memory %</th>{{end}}
+                {{if .Columns.mem_usage}}<th>Memory Usage</th>{{end}}
+                {{if .Columns.net_io}}<th>Network I/O</th>{{end}}
+                {{if .Columns.block_io}}<th>Block I/O</th>{{end}}
+                {{if .Columns.pids}}<th>PIDs</th>{{end}}
+            </tr>
+        </thead>
+        <tbody>
+            {{range .Data}}
+            {{if .GapBefore}}
+            <tr class="gap-row"><td colspan="{{add 1 ($.Columns.Visible "cpu" "mem" "mem_usage" "net_io" "block_io" "pids")}}">Gap in collection before this point</td></tr>
+            {{end}}
+            <tr{{if .Anomaly}} class="anomaly-row" title="CPU more than {{num $.Stats.AnomalyZ 1}} standard deviations from the preceding {{$.Stats.AnomalyWindow}} data points"{{end}}>
+                <td>{{.Timestamp}}</td>
+                {{if $.Columns.cpu}}<td class="{{if gt .CPUPerc $.Thresholds.CPU.Crit}}metric-high{{else if gt .CPUPerc $.Thresholds.CPU.Warn}}metric-medium{{else}}metric-low{{end}}">{{num .CPUPerc 2}}%</td>{{end}}
+                {{if $.Columns.mem}}<td class="{{if gt .MemPerc $.Thresholds.Mem.Crit}}metric-high{{else if gt .MemPerc $.Thresholds.Mem.Warn}}metric-medium{{else}}metric-low{{end}}">{{num .MemPerc 2}}%</td>{{end}}
+                {{if $.Columns.mem_usage}}<td>{{with memBar .MemUsage $.Thresholds.Mem}}<span class="mem-bar" title="{{num .Percent 1}}% of the limit"><span class="mem-bar-fill {{.Class}}" style="width: {{printf "%.1f" .Percent}}%"></span></span>{{end}}{{if memBar .MemUsage $.Thresholds.Mem}}{{.MemUsage}}{{else}}{{num .MemPerc 2}}%{{end}}</td>{{end}}
+                {{if $.Columns.net_io}}<td>{{.NetIO}}{{if .HasNetDelta}} <span class="io-delta">(+{{humanBytes .NetInDelta}} / +{{humanBytes .NetOutDelta}})</span>{{end}}</td>{{end}}
+                {{if $.Columns.block_io}}<td>{{.BlockIO}}{{if .HasBlockDelta}} <span class="io-delta">(+{{humanBytes .BlockReadDelta}} / +{{humanBytes .BlockWriteDelta}})</span>{{end}}</td>{{end}}
+                {{if $.Columns.pids}}<td>{{.PIDs}}</td>{{end}}
+            </tr>
+            {{end}}
+        </tbody>
+    </table>
+    {{else}}
+    <div class="no-data">
+        <h3>No Historical Data Found</h3>
+        <p>No data points were found for container ID: <strong>{{.ContainerID}}</strong></p>
+        <p>This could mean the container was recently created or the statistics haven't been collected yet.</p>
+    </div>
+    {{end}}
+</body>
+</html>
+`
+
+const networkPageTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Network Top Talkers</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background-color: #121212; color: #e0e0e0; }
+        .back-link { 
+            display: inline-block; 
+            margin-bottom: 20px; 
+            color: #64b5f6; 
+            text-decoration: none; 
+            padding: 8px 15px;
+            border: 1px solid #64b5f6;
+            border-radius: 4px;
+        }
+        .back-link:hover { 
+            background-color: #64b5f6; 
+            color: white; 
+        }
+        table { 
+            border-collapse: collapse; 
+            width: 100%; 
+            margin-top: 20px; 
+            background-color: #1e1e1e;
+            color: #e0e0e0;
+        }
+        th, td { 
+            border: 1px solid #333; 
+            padding: 8px; 
+            text-align: left; 
+        }
+        th { background-color: #333; }
+        .clickable-id {
+            color: #64b5f6;
+            cursor: pointer;
+            text-decoration: underline;
+        }
+    </style>
+</head>
+<body>
+    <a href="/" class="back-link"><- Back to Dashboard</a>
+
+    <h1>Network Top Talkers</h1>
+    <p>Containers ranked by the bytes received and sent over their history.</p>
+
+    <form method="GET">
+        <label for="n">Show top</label>
+        <input type="number" name="n" id="n" min="1" value="{{.N}}" onchange="this.form.submit()" style="width: 60px; padding: 5px; background-color: #1e1e1e; color: #e0e0e0; border: 1px solid #333;">
+        <span>containers</span>
+    </form>
+
+    {{if .Talkers}}
+    <table>
+        <thead>
+            <tr>
+                <th>#</th>
+                <th>Container Name</th>
+                <th>Container ID</th>
+                <th>Received</th>
+                <th>Sent</th>
+                <th>Total</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{range $i, $talker := .Talkers}}
+            <tr>
+                <td>{{add $i 1}}</td>
+                <td>{{$talker.ContainerName}}</td>
+                <td><a href="/container/{{$talker.ContainerID}}" class="clickable-id">{{$talker.ContainerID}}</a></td>
+                <td>{{humanBytes $talker.RxBytes}}</td>
+                <td>{{humanBytes $talker.TxBytes}}</td>
+                <td>{{humanBytes $talker.TotalBytes}}</td>
+            </tr>
+            {{end}}
+        </tbody>
+    </table>
+    {{else}}
+    <p>No container data available.</p>
+    {{end}}
+</body>
+</html>
+`
+
+const comparePageTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Compare Containers</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background-color: #121212; color: #e0e0e0; }
+        .back-link { 
+            display: inline-block; 
+            margin-bottom: 20px; 
+            color: #64b5f6; 
+            text-decoration: none; 
+            padding: 8px 15px;
+            border: 1px solid #64b5f6;
+            border-radius: 4px;
+        }
+        .back-link:hover { 
+            background-color: #64b5f6; 
+            color: white; 
+        }
+        .chart-card {
+            background: #1e1e1e;
+            padding: 20px;
+            border-radius: 5px;
+            border: 1px solid #333;
+        }
+        .legend span {
+            display: inline-block;
+            margin-right: 20px;
+        }
+        .legend i {
+            display: inline-block;
+            width: 12px;
+            height: 12px;
+            margin-right: 6px;
+            vertical-align: middle;
+        }
+        .error { color: #ff5252; }
+        table {
+            border-collapse: collapse;
+            width: 100%;
+            margin-top: 20px;
+            background-color: #1e1e1e;
+        }
+        th, td {
+            border: 1px solid #333;
+            padding: 8px;
+            text-align: left;
+        }
+        th { background-color: #333; }
+        tr:nth-child(even) { background-color: #252525; }
+    </style>
+</head>
+<body>
+    <a href="/" class="back-link"><- Back to Dashboard</a>
+
+    <h1>Container Comparison</h1>
+
+    <form method="GET" style="margin-bottom: 20px;">
+        <label for="ids">Container IDs (comma-separated):</label>
+        <input type="text" name="ids" id="ids" value="{{range $i, $id := .IDs}}{{if $i}},{{end}}{{$id}}{{end}}" size="50" style="padding: 5px; background-color: #1e1e1e; color: #e0e0e0; border: 1px solid #333;">
+        <button type="submit" style="padding: 5px 10px; background-color: #64b5f6; color: white; border: none; border-radius: 3px;">Compare</button>
+    </form>
+    {{with .Error}}<p class="error">{{.}}</p>{{end}}
+
+    <div class="chart-card">
+        <h3>CPU Usage</h3>
+        <div id="legend" class="legend"></div>
+        <canvas id="chart" width="1000" height="400" style="width: 100%;"></canvas>
+        <p id="status"></p>
+    </div>
+
+    <table id="compareTable" style="display: none;">
+        <thead></thead>
+        <tbody></tbody>
+    </table>
+
+    <script>
+        const colors = ['#64b5f6', '#ff8a65', '#81c784', '#ba68c8', '#ffd54f', '#4dd0e1', '#f06292', '#a1887f'];
+        const ids = {{.IDs}} || [];
+
+        // Draws each aligned series as a line, breaking it where a container
+        // has no data point at a timestamp
+        function drawChart(data) {
+            const canvas = document.getElementById('chart');
+            const ctx = canvas.getContext('2d');
+            const pad = 40;
+            const width = canvas.width - 2 * pad;
+            const height = canvas.height - 2 * pad;
+            const count = data.timestamps.length;
+
+            let maxValue = 1;
+            data.series.forEach(series => series.cpu.forEach(value => {
+                if (value !== null && value > maxValue) maxValue = value;
+            }));
+            const x = i => pad + (count > 1 ? i / (count - 1) * width : width / 2);
+            const y = value => pad + height - value / maxValue * height;
+
+            ctx.clearRect(0, 0, canvas.width, canvas.height);
+            ctx.strokeStyle = '#333';
+            ctx.fillStyle = '#9e9e9e';
+            ctx.font = '12px Arial';
+            for (let step = 0; step <= 4; step++) {
+                const value = maxValue * step / 4;
+                ctx.beginPath();
+                ctx.moveTo(pad, y(value));
+                ctx.lineTo(pad + width, y(value));
+                ctx.stroke();
+                ctx.fillText(value.toFixed(1) + '%', 0, y(value) + 4);
+            }
+            if (count > 0) {
+                ctx.fillText(data.timestamps[0], pad, canvas.height - 10);
+                const last = data.timestamps[count - 1];
+                ctx.fillText(last, pad + width - ctx.measureText(last).width, canvas.height - 10);
+            }
+
+            data.series.forEach((series, index) => {
+                ctx.strokeStyle = colors[index % colors.length];
+                ctx.lineWidth = 2;
+                ctx.beginPath();
+                let drawing = false;
+                series.cpu.forEach((value, i) => {
+                    if (value === null) {
+                        drawing = false;
+                        return;
+                    }
+                    if (drawing) {
+                        ctx.lineTo(x(i), y(value));
+                    } else {
+                        ctx.moveTo(x(i), y(value));
+                        drawing = true;
+                    }
+                });
+                ctx.stroke();
+
+                // Mark the points too, so isolated ones stay visible
+                ctx.fillStyle = colors[index % colors.length];
+                series.cpu.forEach((value, i) => {
+                    if (value === null) return;
+                    ctx.beginPath();
+                    ctx.arc(x(i), y(value), 3, 0, 2 * Math.PI);
+                    ctx.fill();
+                });
+            });
+
+            const legend = document.getElementById('legend');
+            legend.replaceChildren();
+            data.series.forEach((series, index) => {
+                const entry = document.createElement('span');
+                const swatch = document.createElement('i');
+                swatch.style.backgroundColor = colors[index % colors.length];
+                entry.appendChild(swatch);
+                entry.appendChild(document.createTextNode(series.container_name + ' (' + series.container_id + ')'));
+                legend.appendChild(entry);
+            });
+        }
+
+        // Lists the CPU and memory of every container per timestamp, newest
+        // first, with a dash where a container has no data point
+        function fillTable(data) {
+            const table = document.getElementById('compareTable');
+            const format = value => value === null ? '-' : value.toFixed(2) + '%';
+            const header = document.createElement('tr');
+            const cell = (tag, text, row) => {
+                const element = document.createElement(tag);
+                element.textContent = text;
+                row.appendChild(element);
+            };
+            cell('th', 'Timestamp', header);
+            data.series.forEach((series, index) => {
+                cell('th', series.container_name + ' CPU', header);
+                cell('th', series.container_name + ' Memory', header);
+                header.children[header.children.length - 2].style.color = colors[index % colors.length];
+                header.children[header.children.length - 1].style.color = colors[index % colors.length];
+            });
+            table.tHead.replaceChildren(header);
+
+            const body = table.tBodies[0];
+            body.replaceChildren();
+            for (let i = data.timestamps.length - 1; i >= 0; i--) {
+                const row = document.createElement('tr');
+                cell('td', data.timestamps[i], row);
+                data.series.forEach(series => {
+                    cell('td', format(series.cpu[i]), row);
+                    cell('td', format(series.mem[i]), row);
+                });
+                body.appendChild(row);
+            }
+            table.style.display = '';
+        }
+
+        if (ids.length >= 2) {
+            const status = document.getElementById('status');
+            status.textContent = 'Loading comparison data...';
+            const params = new URLSearchParams(location.search);
+            params.delete('a');
+            params.delete('b');
+            params.set('ids', ids.join(','));
+            params.set('ts', 'human');
+            fetch('/api/compare?' + params.toString())
+                .then(response => response.ok ? response.json() : response.text().then(text => { throw new Error(text); }))
+                .then(data => {
+                    status.textContent = '';
+                    drawChart(data);
+                    fillTable(data);
+                })
+                .catch(error => {
+                    status.className = 'error';
+                    status.textContent = 'Error loading data: ' + error.message;
+                });
+        }
+    </script>
+</body>
+</html>
+`
+
+const summaryPageTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <title>Container Summary - All Files Analysis</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 20px; background-color: #121212; color: #e0e0e0; }
+        .back-link { 
+            display: inline-block; 
+            margin-bottom: 20px; 
+            color: #64b5f6; 
+            text-decoration: none; 
+            padding: 8px 15px;
+            border: 1px solid #64b5f6;
+            border-radius: 4px;
+        }
+        .back-link:hover { 
+            background-color: #64b5f6; 
+            color: white; 
+        }
+        .summary-info { 
+            background: #1e1e1e; 
+            padding: 20px; 
+            border-radius: 5px; 
+            margin-bottom: 30px; 
+            border: 1px solid #333;
         }
         table { 
             border-collapse: collapse; 
@@ -1000,10 +5259,30 @@ const summaryPageTemplate = `
             font-weight: bold;
             color: #64b5f6;
         }
+        .busy-badge {
+            display: inline-block;
+            margin-left: 6px;
+            padding: 1px 6px;
+            border-radius: 3px;
+            font-size: 11px;
+            background-color: #7e57c2;
+            color: white;
+        }
+        .trend { font-weight: bold; }
+        .trend-up { color: #ff5252; }
+        .trend-down { color: #28a745; }
+        .trend-flat { color: #9e9e9e; }
+        .baseline-badge {
+            background-color: #e65100;
+        }
+        .seen-current { color: #28a745; }
+        .seen-stale { color: #ffb74d; }
+        .seen-old { color: #ff5252; font-weight: bold; }
     </style>
 </head>
 <body>
     <a href="/" class="back-link"><- Back to Dashboard</a>
+    <a href="/summary.csv" class="back-link" style="margin-left: 15px;">Download CSV</a>
     
     <h1>Container Summary - All Files Analysis</h1>
     
@@ -1014,336 +5293,2325 @@ const summaryPageTemplate = `
         <p><strong>Analysis Period:</strong> {{.FirstTimestamp}} to {{.LastTimestamp}}</p>
     </div>
 
-    <div class="stats-summary">
-        <div class="stats-card">
-            <h3>Highest Avg CPU</h3>
-            <div class="stats-value">{{if .Summaries}}{{printf "%.1f%%" (index .Summaries 0).AvgCPU}}{{else}}N/A{{end}}</div>
-            <p>{{if .Summaries}}{{(index .Summaries 0).ContainerName}}{{end}}</p>
-        </div>
-        <div class="stats-card">
-            <h3>Highest Peak CPU</h3>
-            <div class="stats-value">{{if .HighestPeakCPU}}{{printf "%.1f%%" .HighestPeakCPU.MaxCPU}}{{else}}N/A{{end}}</div>
-            <p>{{if .HighestPeakCPU}}{{.HighestPeakCPU.ContainerName}}{{end}}</p>
-        </div>
-        <div class="stats-card">
-            <h3>Most Data Points</h3>
-            <div class="stats-value">{{if .MostDataPoints}}{{.MostDataPoints.DataPoints}}{{else}}N/A{{end}}</div>
-            <p>{{if .MostDataPoints}}{{.MostDataPoints.ContainerName}}{{end}}</p>
-        </div>
-    </div>
+    <div class="stats-summary">
+        <div class="stats-card">
+            <h3>Highest Avg CPU</h3>
+            <div class="stats-value">{{if .HighestAvgCPU}}{{num .HighestAvgCPU.AvgCPU 1}}%{{else}}N/A{{end}}</div>
+            <p>{{if .HighestAvgCPU}}{{.HighestAvgCPU.ContainerName}}{{end}}</p>
+        </div>
+        <div class="stats-card">
+            <h3>Highest Peak CPU</h3>
+            <div class="stats-value">{{if .HighestPeakCPU}}{{num .HighestPeakCPU.MaxCPU 1}}%{{else}}N/A{{end}}</div>
+            <p>{{if .HighestPeakCPU}}{{.HighestPeakCPU.ContainerName}}{{end}}</p>
+        </div>
+        <div class="stats-card">
+            <h3>Most Data Points</h3>
+            <div class="stats-value">{{if .MostDataPoints}}{{.MostDataPoints.DataPoints}}{{else}}N/A{{end}}</div>
+            <p>{{if .MostDataPoints}}{{.MostDataPoints.ContainerName}}{{end}}</p>
+        </div>
+    </div>
+
+    {{if .Projects}}
+    <h2>Compose Projects</h2>
+    <table>
+        <thead>
+            <tr>
+                <th>Project</th>
+                <th>Containers</th>
+                <th>Total Avg CPU %</th>
+                <th>Highest Peak CPU %</th>
+                <th>Total Avg Mem %</th>
+                <th>Highest Peak Mem %</th>
+            </tr>
+        </thead>
+        <tbody>
+            {{range .Projects}}
+            <tr>
+                <td>{{.Group}}</td>
+                <td>{{len .Containers}}</td>
+                <td>{{num .AvgCPU 2}}%</td>
+                <td>{{num .MaxCPU 2}}%</td>
+                <td>{{num .AvgMem 2}}%</td>
+                <td>{{num .MaxMem 2}}%</td>
+            </tr>
+            {{end}}
+        </tbody>
+    </table>
+    {{end}}
+
+    <div class="search-container">
+        <label for="searchInput">Search by container name:</label>
+        <input type="text" id="searchInput" placeholder="Enter container name..." onkeyup="filterTable()">
+        <button onclick="clearSearch()">Clear</button>
+        <label style="margin-left: 15px;"><input type="checkbox" id="busyOnly" onchange="filterTable()"> Always busy only (min CPU above {{num .BusyFloor 1}}%)</label>
+        <label style="margin-left: 15px;"><input type="checkbox" id="baselineOnly" onchange="filterTable()"> Above fleet baseline only ({{num .BaselineFactor 1}}x the fleet average)</label>
+        <label style="margin-left: 15px;">Efficiency below <input type="number" id="efficiencyMax" min="0" step="any" onchange="filterTable()" onkeyup="filterTable()" style="width: 60px;"></label>
+        <span style="margin-left: 15px;">{{if .Projects}}<a href="?" class="clickable-id">ungroup</a>{{else}}<a href="?group=project" class="clickable-id">group by compose project</a>{{end}}</span>
+        {{if or .Columns.net_io .Columns.block_io}}<span style="margin-left: 15px;">I/O: {{if eq .IOMode "rate"}}<a href="?io=total" class="clickable-id">total moved</a> | <strong>average rate</strong>{{else}}<strong>total moved</strong> | <a href="?io=rate" class="clickable-id">average rate</a>{{end}}</span>{{end}}
+    </div>
+
+    <table id="summaryTable">
+        <thead>
+            <tr>
+                <th onclick="sortTable(this.cellIndex)">Container Name</th>
+                <th onclick="sortTable(this.cellIndex)">ID</th>
+                {{if .Columns.data_points}}<th onclick="sortTable(this.cellIndex)" data-sort="number">Data Points</th>{{end}}
+                {{if .Columns.cpu_history}}<th>CPU History</th>{{end}}
+                {{if .Columns.cpu}}
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Avg CPU %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value" title="Average with a half-life of {{.Stats.HalfLife}}, so recent behavior dominates">Recent CPU %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Peak CPU %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Min CPU %</th>
+                {{end}}
+                {{if .Columns.mem}}
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Avg Mem %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value" title="Average with a half-life of {{.Stats.HalfLife}}, so recent behavior dominates">Recent Mem %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Peak Mem %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Min Mem %</th>
+                {{end}}
+                {{if .Columns.percentiles}}
+                {{if .Columns.cpu}}
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">P50 CPU %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">P90 CPU %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">P95 CPU %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">P99 CPU %</th>
+                {{end}}
+                {{if .Columns.mem}}
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">P50 Mem %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">P90 Mem %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">P95 Mem %</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">P99 Mem %</th>
+                {{end}}
+                {{end}}
+                {{if .Columns.mem_usage}}<th onclick="sortTable(this.cellIndex)" data-sort="value">Avg Mem Used</th>{{end}}
+                {{if .Columns.net_io}}
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Net In{{if eq .IOMode "rate"}}/s{{end}}</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Net Out{{if eq .IOMode "rate"}}/s{{end}}</th>
+                {{end}}
+                {{if .Columns.block_io}}
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Block Read{{if eq .IOMode "rate"}}/s{{end}}</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="value">Block Write{{if eq .IOMode "rate"}}/s{{end}}</th>
+                {{end}}
+                {{if .Columns.spikes}}
+                <th onclick="sortTable(this.cellIndex)" data-sort="number" title="Data points above {{num .Stats.CPUSpike 0}}% CPU">CPU Spikes</th>
+                <th onclick="sortTable(this.cellIndex)" data-sort="number" title="Data points above {{num .Stats.MemSpike 0}}% memory">Mem Spikes</th>
+                {{end}}
+                {{if .Columns.efficiency}}<th onclick="sortTable(this.cellIndex)" data-sort="value" title="Weighted mean of average CPU and memory limit utilization; low means over-provisioned">Efficiency</th>{{end}}
+                {{if .Columns.first_seen}}<th onclick="sortTable(this.cellIndex)">First Seen</th>{{end}}
+                {{if .Columns.last_seen}}<th onclick="sortTable(this.cellIndex)">Last Seen</th>{{end}}
+            </tr>
+        </thead>
+        <tbody>
+            {{range .Summaries}}
+            <tr data-always-busy="{{.AlwaysBusy}}" data-above-baseline="{{.AboveBaseline}}" data-efficiency="{{.EfficiencyScore}}">
+                <td>{{.ContainerName}}{{if .AlwaysBusy}}<span class="busy-badge" title="CPU never dropped to the idle floor">always busy</span>{{end}}{{if .AboveBaseline}}<span class="busy-badge baseline-badge" title="Average CPU or memory well above the fleet average">above baseline</span>{{end}}{{if .Restarts}}<span class="busy-badge" title="I/O counters dropped, which usually means the container restarted">{{.Restarts}} restart{{if gt .Restarts 1}}s{{end}}</span>{{end}}</td>
+                <td><a href="/container/{{.ContainerID}}" class="clickable-id">{{.ContainerID}}</a></td>
+                {{if $.Columns.data_points}}<td>{{.DataPoints}}</td>{{end}}
+                {{if $.Columns.cpu_history}}<td>{{.CPUSparkline}}</td>{{end}}
+                {{if $.Columns.cpu}}
+                <td class="{{if gt .AvgCPU $.Thresholds.CPU.Crit}}metric-high{{else if gt .AvgCPU $.Thresholds.CPU.Warn}}metric-medium{{else}}metric-low{{end}}" data-value="{{.AvgCPU}}">{{num .AvgCPU 2}}% {{template "trend" .CPUTrend}}</td>
+                <td data-value="{{.RecentAvgCPU}}">{{num .RecentAvgCPU 2}}%</td>
+                <td class="{{if gt .MaxCPU $.Thresholds.CPU.Crit}}metric-high{{else if gt .MaxCPU $.Thresholds.CPU.Warn}}metric-medium{{else}}metric-low{{end}}" data-value="{{.MaxCPU}}">{{num .MaxCPU 2}}%</td>
+                <td data-value="{{.MinCPU}}">{{num .MinCPU 2}}%</td>
+                {{end}}
+                {{if $.Columns.mem}}
+                <td class="{{if gt .AvgMem $.Thresholds.Mem.Crit}}metric-high{{else if gt .AvgMem $.Thresholds.Mem.Warn}}metric-medium{{else}}metric-low{{end}}" data-value="{{.AvgMem}}">{{num .AvgMem 2}}% {{template "trend" .MemTrend}}</td>
+                <td data-value="{{.RecentAvgMem}}">{{num .RecentAvgMem 2}}%</td>
+                <td class="{{if gt .MaxMem $.Thresholds.Mem.Crit}}metric-high{{else if gt .MaxMem $.Thresholds.Mem.Warn}}metric-medium{{else}}metric-low{{end}}" data-value="{{.MaxMem}}">{{num .MaxMem 2}}%</td>
+                <td data-value="{{.MinMem}}">{{num .MinMem 2}}%</td>
+                {{end}}
+                {{if $.Columns.percentiles}}
+                {{if $.Columns.cpu}}
+                <td data-value="{{.P50CPU}}">{{num .P50CPU 2}}%</td>
+                <td data-value="{{.P90CPU}}">{{num .P90CPU 2}}%</td>
+                <td data-value="{{.P95CPU}}">{{num .P95CPU 2}}%</td>
+                <td data-value="{{.P99CPU}}">{{num .P99CPU 2}}%</td>
+                {{end}}
+                {{if $.Columns.mem}}
+                <td data-value="{{.P50Mem}}">{{num .P50Mem 2}}%</td>
+                <td data-value="{{.P90Mem}}">{{num .P90Mem 2}}%</td>
+                <td data-value="{{.P95Mem}}">{{num .P95Mem 2}}%</td>
+                <td data-value="{{.P99Mem}}">{{num .P99Mem 2}}%</td>
+                {{end}}
+                {{end}}
+                {{if $.Columns.mem_usage}}<td data-value="{{.AvgMemUsedBytes}}">{{humanBytes .AvgMemUsedBytes}}</td>{{end}}
+                {{if $.Columns.net_io}}{{if eq $.IOMode "rate"}}
+                <td data-value="{{.NetInRate}}">{{humanRate .NetInRate}}</td>
+                <td data-value="{{.NetOutRate}}">{{humanRate .NetOutRate}}</td>
+                {{else}}
+                <td data-value="{{.NetInTotal}}">{{humanBytes .NetInTotal}}</td>
+                <td data-value="{{.NetOutTotal}}">{{humanBytes .NetOutTotal}}</td>
+                {{end}}{{end}}
+                {{if $.Columns.block_io}}{{if eq $.IOMode "rate"}}
+                <td data-value="{{.BlockReadRate}}">{{humanRate .BlockReadRate}}</td>
+                <td data-value="{{.BlockWriteRate}}">{{humanRate .BlockWriteRate}}</td>
+                {{else}}
+                <td data-value="{{.BlockReadTotal}}">{{humanBytes .BlockReadTotal}}</td>
+                <td data-value="{{.BlockWriteTotal}}">{{humanBytes .BlockWriteTotal}}</td>
+                {{end}}{{end}}
+                {{if $.Columns.spikes}}
+                <td{{if .CPUSpikeCount}} class="metric-high"{{end}}>{{.CPUSpikeCount}}</td>
+                <td{{if .MemSpikeCount}} class="metric-high"{{end}}>{{.MemSpikeCount}}</td>
+                {{end}}
+                {{if $.Columns.efficiency}}<td title="Memory limit utilization {{num .AvgMemLimitUtil 1}}%" data-value="{{.EfficiencyScore}}">{{num .EfficiencyScore 1}}</td>{{end}}
+                {{if $.Columns.first_seen}}<td>{{.FirstSeen}}</td>{{end}}
+                {{if $.Columns.last_seen}}<td class="{{.LastSeenClass}}">{{.LastSeen}}</td>{{end}}
+            </tr>
+            {{end}}
+        </tbody>
+    </table>
+
+    <script>
+        let sortDirection = {};
+        
+        function sortTable(columnIndex) {
+            const table = document.getElementById('summaryTable');
+            const tbody = table.querySelector('tbody');
+            const rows = Array.from(tbody.querySelectorAll('tr')).filter(row => row.style.display !== 'none');
+            
+            // Column positions depend on -columns, so the header says how to sort
+            const sortKind = table.tHead.rows[0].cells[columnIndex].dataset.sort;
+            
+            const getValue = (row, index) => {
+                let value = row.cells[index].textContent.trim();
+                if (sortKind === 'number') { // Data Points column
+                    return parseFloat(value) || 0;
+                }
+                if (sortKind === 'value') { // Formatted columns carry the raw number
+                    return parseFloat(row.cells[index].dataset.value) || 0;
+                }
+                return value.toLowerCase();
+            };
+            
+            const currentDirection = sortDirection[columnIndex] || 'asc';
+            const newDirection = currentDirection === 'asc' ? 'desc' : 'asc';
+            sortDirection[columnIndex] = newDirection;
+            
+            rows.sort((a, b) => {
+                const aVal = getValue(a, columnIndex);
+                const bVal = getValue(b, columnIndex);
+                
+                let comparison = 0;
+                if (aVal < bVal) comparison = -1;
+                else if (aVal > bVal) comparison = 1;
+                
+                return newDirection === 'asc' ? comparison : -comparison;
+            });
+            
+            // Reorder rows
+            rows.forEach(row => tbody.appendChild(row));
+        }
+
+        function filterTable() {
+            const input = document.getElementById('searchInput');
+            const filter = input.value.toLowerCase();
+            const busyOnly = document.getElementById('busyOnly').checked;
+            const baselineOnly = document.getElementById('baselineOnly').checked;
+            const efficiencyMax = parseFloat(document.getElementById('efficiencyMax').value);
+            const table = document.getElementById('summaryTable');
+            const tbody = table.querySelector('tbody');
+            const rows = tbody.querySelectorAll('tr');
+            
+            rows.forEach(row => {
+                const containerName = row.cells[0].textContent.toLowerCase();
+                const busyMatch = !busyOnly || row.dataset.alwaysBusy === 'true';
+                const baselineMatch = !baselineOnly || row.dataset.aboveBaseline === 'true';
+                const efficiencyMatch = isNaN(efficiencyMax) || parseFloat(row.dataset.efficiency) < efficiencyMax;
+                if (containerName.includes(filter) && busyMatch && baselineMatch && efficiencyMatch) {
+                    row.style.display = '';
+                } else {
+                    row.style.display = 'none';
+                }
+            });
+        }
+
+        function clearSearch() {
+            document.getElementById('searchInput').value = '';
+            filterTable();
+        }
+    </script>
+</body>
+</html>
+{{define "trend"}}{{if eq . "up"}}<span class="trend trend-up" title="Rising: second half of the history averages higher">&uarr;</span>{{else if eq . "down"}}<span class="trend trend-down" title="Falling: second half of the history averages lower">&darr;</span>{{else}}<span class="trend trend-flat" title="Flat">&rarr;</span>{{end}}{{end}}
+`
+
+// containerColor returns a stable color for a container, derived from an
+// FNV-1a hash of its ID so the same container always gets the same hue.
+// The containerColor function in the dashboard script mirrors it.
+func containerColor(id string) string {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	hue := float64(h.Sum32() % 360)
+
+	// HSL to RGB with fixed saturation and lightness that read well on the dark theme
+	const saturation, lightness = 0.65, 0.55
+	chroma := (1 - math.Abs(2*lightness-1)) * saturation
+	x := chroma * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := lightness - chroma/2
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = chroma, x, 0
+	case hue < 120:
+		r, g, b = x, chroma, 0
+	case hue < 180:
+		r, g, b = 0, chroma, x
+	case hue < 240:
+		r, g, b = 0, x, chroma
+	case hue < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	return fmt.Sprintf("#%02x%02x%02x",
+		int(math.Round((r+m)*255)), int(math.Round((g+m)*255)), int(math.Round((b+m)*255)))
+}
+
+// fileAge describes how much older t is than newest in the largest whole
+// unit, e.g. "12m ago", or "latest" for the newest file itself
+func fileAge(t, newest time.Time) string {
+	d := newest.Sub(t)
+	switch {
+	case d <= 0:
+		return "latest"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// templateFuncs holds the helper functions available to every page template
+var templateFuncs = template.FuncMap{
+	"containerColor": containerColor,
+	"parseFloat": func(s string) float64 {
+		s = strings.TrimSuffix(s, "%")
+		val, _ := strconv.ParseFloat(s, 64)
+		return val
+	},
+	"humanBytes": humanBytes,
+	"num":        formatNumber,
+	"memBar":     memBar,
+	"age":        fileAge,
+	"humanTime":  humanTime,
+	"sparkline": func(values []float64) template.HTML {
+		return sparklineSVG(values, 80, 20)
+	},
+	"cpuMemChart": cpuMemChart,
+	"humanRate": func(bytesPerSecond float64) string {
+		return humanBytes(int64(bytesPerSecond)) + "/s"
+	},
+	"add": func(a, b int) int {
+		return a + b
+	},
+	"sub": func(a, b int) int {
+		return a - b
+	},
+}
+
+// trailingCPUSeries returns, for every container of the selected file, its
+// CPU over the selected file and up to points-1 older files, oldest first.
+// Files are sorted newest first.
+func trailingCPUSeries(statsFiles []StatsFile, selected, points int) map[string][]float64 {
+	series := make(map[string][]float64)
+	if selected < 0 || selected >= len(statsFiles) || points < 1 {
+		return series
+	}
+	for _, stat := range statsFiles[selected].Stats {
+		series[stat.ID] = nil
+	}
+
+	oldest := min(selected+points, len(statsFiles)) - 1
+	for i := oldest; i >= selected; i-- {
+		for _, stat := range statsFiles[i].Stats {
+			if values, ok := series[stat.ID]; ok {
+				series[stat.ID] = append(values, parsePercent(stat.CPUPerc))
+			}
+		}
+	}
+	return series
+}
+
+// summarySparklineWidth is the width of the summary table sparklines in
+// pixels, and the most points they draw
+const summarySparklineWidth = 80
+
+// downsample reduces values to at most n points by averaging consecutive
+// runs of them, so long histories keep their shape in a small sparkline
+func downsample(values []float64, n int) []float64 {
+	if len(values) <= n {
+		return values
+	}
+	result := make([]float64, n)
+	for i := range result {
+		start, end := i*len(values)/n, (i+1)*len(values)/n
+		var sum float64
+		for _, value := range values[start:end] {
+			sum += value
+		}
+		result[i] = sum / float64(end-start)
+	}
+	return result
+}
+
+// chartTop returns the value drawn at the top of a chart of the series: 100,
+// or the largest value when a container uses more than one CPU core
+func chartTop(series ...[]float64) float64 {
+	top := 100.0
+	for _, values := range series {
+		for _, value := range values {
+			top = math.Max(top, value)
+		}
+	}
+	return top
+}
+
+// buildSparklinePath returns the SVG path data of a line through the values,
+// spread evenly across width and scaled from 0 (bottom) to top (top) of
+// height. It is empty for fewer than two values.
+func buildSparklinePath(values []float64, width, height int, top float64) string {
+	if len(values) < 2 || top <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, value := range values {
+		x := float64(i) / float64(len(values)-1) * float64(width)
+		y := float64(height) - math.Min(math.Max(value, 0), top)/top*float64(height)
+		command := "L"
+		if i == 0 {
+			command = "M"
+		}
+		fmt.Fprintf(&b, "%s%.1f,%.1f ", command, x, y)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// buildChartPath returns the SVG path data of a line through the values of
+// oldest-first data points, placed across width by their timestamps between
+// the first and the last one and scaled like buildSparklinePath. Points after
+// a sampling gap (GapBefore) start a new subpath, so the line breaks instead
+// of bridging the missing samples. It is empty for fewer than two points.
+func buildChartPath(dataPoints []ContainerDataPoint, values []float64, width, height int, top float64) string {
+	if len(dataPoints) < 2 || top <= 0 {
+		return ""
+	}
+	first, last := dataPoints[0].Time, dataPoints[len(dataPoints)-1].Time
+	span := last.Sub(first)
+	var b strings.Builder
+	for i, point := range dataPoints {
+		// Points without a usable time span are spread evenly instead
+		x := float64(i) / float64(len(dataPoints)-1) * float64(width)
+		if span > 0 {
+			x = float64(point.Time.Sub(first)) / float64(span) * float64(width)
+		}
+		y := float64(height) - math.Min(math.Max(values[i], 0), top)/top*float64(height)
+		command := "L"
+		if i == 0 || point.GapBefore {
+			command = "M"
+		}
+		fmt.Fprintf(&b, "%s%.1f,%.1f ", command, x, y)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// sparklineSVG renders the values as a small inline SVG line, scaled from 0
+// to 100 so rows can be compared at a glance, or to the peak of a series
+// going above 100
+func sparklineSVG(values []float64, width, height int) template.HTML {
+	path := buildSparklinePath(values, width, height, chartTop(values))
+	if path == "" {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<svg width="%d" height="%d" viewBox="0 0 %d %d" class="sparkline"><path fill="none" stroke="#64b5f6" stroke-width="1.5" d="%s"/></svg>`,
+		width, height, width, height, path))
+}
+
+// Size of the plot area of the container page chart, and the margins left
+// for the axis labels
+const (
+	chartWidth   = 800
+	chartHeight  = 200
+	chartMarginX = 40
+	chartMarginY = 10
+)
+
+// cpuMemChart renders the CPU and memory percentages of oldest-first data
+// points as an inline SVG line chart with a 0-100 y-axis, extended to the
+// highest value if CPU goes above 100, the first and last timestamps under it
+// and a legend. The lines follow the timestamps and break at sampling gaps
+// marked by markGaps. It is empty for fewer than two points.
+func cpuMemChart(dataPoints []ContainerDataPoint) template.HTML {
+	if len(dataPoints) < 2 {
+		return ""
+	}
+	cpuValues, _ := dataPointValues(dataPoints, "cpu")
+	memValues, _ := dataPointValues(dataPoints, "mem")
+
+	var b strings.Builder
+	totalWidth, totalHeight := chartWidth+2*chartMarginX, chartHeight+2*chartMarginY+20
+	fmt.Fprintf(&b, `<svg width="100%%" viewBox="0 0 %d %d" class="chart" role="img" aria-label="CPU and memory over time">`, totalWidth, totalHeight)
+	fmt.Fprintf(&b, `<g transform="translate(%d,%d)">`, chartMarginX, chartMarginY)
+	top := chartTop(cpuValues, memValues)
+	for quarter := 0; quarter <= 4; quarter++ {
+		y := chartHeight - quarter*chartHeight/4
+		fmt.Fprintf(&b, `<line x1="0" y1="%d" x2="%d" y2="%d" stroke="#333"/>`, y, chartWidth, y)
+		fmt.Fprintf(&b, `<text x="-6" y="%d" fill="#888" font-size="11" text-anchor="end" dominant-baseline="middle">%.0f%%</text>`, y, top*float64(quarter)/4)
+	}
+	fmt.Fprintf(&b, `<path fill="none" stroke="#64b5f6" stroke-width="2" d="%s"/>`, buildChartPath(dataPoints, cpuValues, chartWidth, chartHeight, top))
+	fmt.Fprintf(&b, `<path fill="none" stroke="#ffb74d" stroke-width="2" d="%s"/>`, buildChartPath(dataPoints, memValues, chartWidth, chartHeight, top))
+	first, last := humanTime(dataPoints[0].Time), humanTime(dataPoints[len(dataPoints)-1].Time)
+	fmt.Fprintf(&b, `<text x="0" y="%d" fill="#888" font-size="11">%s</text>`, chartHeight+16, first)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#888" font-size="11" text-anchor="end">%s</text>`, chartWidth, chartHeight+16, last)
+	b.WriteString(`<rect x="10" y="4" width="12" height="3" fill="#64b5f6"/><text x="26" y="9" fill="#e0e0e0" font-size="11">CPU %</text>`)
+	b.WriteString(`<rect x="80" y="4" width="12" height="3" fill="#ffb74d"/><text x="96" y="9" fill="#e0e0e0" font-size="11">Memory %</text>`)
+	b.WriteString(`</g></svg>`)
+	return template.HTML(b.String())
+}
+
+// MemBar describes the memory usage bar drawn in the Memory Usage columns
+type MemBar struct {
+	Percent float64
+	Class   string
+}
+
+// memBar returns the usage bar for a "used / limit" memory value, colored
+// by the memory thresholds, or nil if the value has no parseable limit
+func memBar(memUsage string, thresholds MetricThresholds) *MemBar {
+	used, limit, err := parseMemUsage(memUsage)
+	if err != nil || limit <= 0 {
+		return nil
+	}
+	bar := &MemBar{Percent: math.Min(float64(used)/float64(limit)*100, 100)}
+	switch {
+	case bar.Percent > thresholds.Crit:
+		bar.Class = "bar-high"
+	case bar.Percent > thresholds.Warn:
+		bar.Class = "bar-medium"
+	}
+	return bar
+}
+
+// NumberFormat holds the separators used to display numbers on the pages
+type NumberFormat struct {
+	Thousands string
+	Decimal   string
+}
+
+// numberFormats maps the -locale values to their number formats
+var numberFormats = map[string]NumberFormat{
+	"en": {Thousands: ",", Decimal: "."},
+	"de": {Thousands: ".", Decimal: ","},
+	"fr": {Thousands: "\u202f", Decimal: ","},
+	"ch": {Thousands: "'", Decimal: "."},
+}
+
+// displayFormat is the number format of the pages, set from -locale
+var displayFormat = numberFormats["en"]
+
+// localeNames returns the supported -locale values in sorted order
+func localeNames() []string {
+	names := make([]string, 0, len(numberFormats))
+	for name := range numberFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Format returns value rounded to decimals places, with the integer digits
+// grouped in threes, e.g. "1,234.56" or "1.234,56"
+func (f NumberFormat) Format(value float64, decimals int) string {
+	digits := strconv.FormatFloat(value, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	whole, fraction, _ := strings.Cut(digits, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(f.Thousands)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(f.Decimal)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
+
+// formatNumber formats value for display using the -locale number format
+func formatNumber(value float64, decimals int) string {
+	return displayFormat.Format(value, decimals)
+}
+
+// humanBytes formats a byte count with binary units, e.g. "1.2 GiB"
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%s %ciB", formatNumber(float64(n)/float64(div), 1), "KMGTP"[exp])
+}
+
+// tableColumns lists the keys of the optional table columns. The container
+// name and ID columns are always shown.
+var tableColumns = []string{
+	"cpu", "cpu_history", "mem", "mem_usage", "net_io", "block_io", "pids",
+	"data_points", "efficiency", "first_seen", "last_seen", "percentiles",
+	"spikes",
+}
+
+// ColumnSet holds the visibility of each optional table column by key
+type ColumnSet map[string]bool
+
+// parseColumns builds the column set from a comma-separated list of column
+// keys, showing all columns when the list is empty. Unknown keys are logged
+// and ignored.
+func parseColumns(list string) ColumnSet {
+	columns := make(ColumnSet)
+	for _, key := range tableColumns {
+		columns[key] = list == ""
+	}
+	if list == "" {
+		return columns
+	}
+
+	for _, key := range strings.Split(list, ",") {
+		key = strings.TrimSpace(key)
+		if _, ok := columns[key]; !ok {
+			log.Printf("Warning: ignoring unknown column %q", key)
+			continue
+		}
+		columns[key] = true
+	}
+	return columns
+}
+
+// Visible returns how many of the given columns are shown
+func (c ColumnSet) Visible(keys ...string) int {
+	count := 0
+	for _, key := range keys {
+		if c[key] {
+			count++
+		}
+	}
+	return count
+}
+
+// templateSources lists the page templates with their built-in source and
+// the file name that overrides them inside the templates directory
+var templateSources = []struct {
+	Name    string
+	File    string
+	Builtin string
+}{
+	{Name: "stats", File: "index.html", Builtin: htmlTemplate},
+	{Name: "container", File: "container.html", Builtin: containerPageTemplate},
+	{Name: "summary", File: "summary.html", Builtin: summaryPageTemplate},
+	{Name: "compare", File: "compare.html", Builtin: comparePageTemplate},
+	{Name: "network", File: "network.html", Builtin: networkPageTemplate},
+}
+
+// TemplateStore holds the parsed page templates, optionally loaded from disk
+type TemplateStore struct {
+	mu        sync.RWMutex
+	dir       string
+	templates map[string]*template.Template
+	modTimes  map[string]time.Time
+}
+
+// newTemplateStore parses all page templates, preferring files in dir over
+// the built-in ones when dir is set
+func newTemplateStore(dir string) (*TemplateStore, error) {
+	store := &TemplateStore{dir: dir}
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Get returns the parsed template with the given name
+func (s *TemplateStore) Get(name string) *template.Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.templates[name]
+}
+
+// reload parses every template and swaps them in only if all of them parse
+func (s *TemplateStore) reload() error {
+	templates := make(map[string]*template.Template)
+	modTimes := make(map[string]time.Time)
+
+	for _, src := range templateSources {
+		text := src.Builtin
+		if s.dir != "" {
+			filePath := filepath.Join(s.dir, src.File)
+			if info, err := os.Stat(filePath); err == nil {
+				content, err := os.ReadFile(filePath)
+				if err != nil {
+					return fmt.Errorf("error reading template %s: %v", filePath, err)
+				}
+				text = string(content)
+				modTimes[src.Name] = info.ModTime()
+			}
+		}
+
+		tmpl, err := template.New(src.Name).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return fmt.Errorf("error parsing template %s: %v", src.Name, err)
+		}
+		templates[src.Name] = tmpl
+	}
+
+	s.mu.Lock()
+	s.templates = templates
+	s.modTimes = modTimes
+	s.mu.Unlock()
+	return nil
+}
+
+// changed reports whether any template file was added, removed or modified
+func (s *TemplateStore) changed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, src := range templateSources {
+		var modTime time.Time
+		if info, err := os.Stat(filepath.Join(s.dir, src.File)); err == nil {
+			modTime = info.ModTime()
+		}
+		if !modTime.Equal(s.modTimes[src.Name]) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch polls the templates directory and reloads the templates on change,
+// keeping the previous ones if the new files fail to parse
+func (s *TemplateStore) watch(interval time.Duration) {
+	if s.dir == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !s.changed() {
+			continue
+		}
+		if err := s.reload(); err != nil {
+			log.Printf("Keeping previous templates: %v", err)
+			// Remember the new mod times so a broken file is reported only once
+			s.mu.Lock()
+			for _, src := range templateSources {
+				if info, err := os.Stat(filepath.Join(s.dir, src.File)); err == nil {
+					s.modTimes[src.Name] = info.ModTime()
+				} else {
+					delete(s.modTimes, src.Name)
+				}
+			}
+			s.mu.Unlock()
+			continue
+		}
+		log.Printf("Reloaded templates from %s", s.dir)
+	}
+}
+
+type PageData struct {
+	Files        []StatsFile
+	SelectedFile StatsFile
+	// PageStats are the containers of SelectedFile on the current page
+	PageStats        []DockerStat
+	Page             Pagination
+	SelectedIndex    int
+	AvgWindow        int
+	ContainerAccents bool
+	FocusHottest     bool
+	HottestID        string
+	DiffBack         int
+	DiffFile         StatsFile
+	Changes          []ContainerChange
+	CPUSeries        map[string][]float64
+	Thresholds       Thresholds
+	Columns          ColumnSet
+}
+
+// NetworkPageData holds the data for the network top talkers page
+type NetworkPageData struct {
+	Talkers []NetworkTalker
+	N       int
+}
+
+// ComparePageData holds the container IDs of the comparison page, or the
+// reason they were rejected
+type ComparePageData struct {
+	IDs   []string
+	Error string
+}
+
+// SummaryReport holds the container summaries of the summary page and the
+// figures derived from them
+type SummaryReport struct {
+	Summaries      []ContainerSummary `json:"summaries"`
+	TotalFiles     int                `json:"total_files"`
+	FirstTimestamp string             `json:"first_timestamp,omitempty"`
+	LastTimestamp  string             `json:"last_timestamp,omitempty"`
+	HighestAvgCPU  *ContainerSummary  `json:"highest_avg_cpu,omitempty"`
+	HighestPeakCPU *ContainerSummary  `json:"highest_peak_cpu,omitempty"`
+	MostDataPoints *ContainerSummary  `json:"most_data_points,omitempty"`
+	// Newest is the timestamp of the newest file, zero without files
+	Newest time.Time `json:"-"`
+}
+
+type SummaryPageData struct {
+	SummaryReport
+	BusyFloor      float64
+	BaselineFactor float64
+	Thresholds     Thresholds
+	Columns        ColumnSet
+	IOMode         string
+	Stats          StatsOptions
+	// Projects totals the containers per compose project with ?group=project
+	Projects []ContainerGroup
+}
+
+func main() {
+	var cfg Config
+	cfg.registerFlags(flag.CommandLine)
+	configFile := flag.String("config", "", "JSON file of flag values, keyed by flag name; flags given on the command line take precedence")
+	flag.Parse()
+	if *configFile != "" {
+		if err := applyConfigFile(flag.CommandLine, *configFile); err != nil {
+			log.Fatalf("Error loading config file: %v", err)
+		}
+	}
+	if err := cfg.resolve(); err != nil {
+		log.Fatal(err)
+	}
+
+	// Load all stats files on startup
+	statsFiles, loadErrors, err := loadAllStatsFiles(cfg.Dir, cfg.Load)
+	if err != nil {
+		log.Fatalf("Error loading stats files: %v", err)
+	}
+
+	if len(statsFiles) == 0 {
+		log.Fatalf("No JSON stats files found in %s directory", cfg.Dir)
+	}
+
+	fmt.Printf("Loaded %d stats files\n", len(statsFiles))
+
+	server, err := newServer(cfg, flag.CommandLine, statsFiles, loadErrors)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.Refresh > 0 {
+		log.Printf("Refreshing stats every %v", cfg.Refresh)
+		go func() {
+			ticker := time.NewTicker(cfg.Refresh)
+			defer ticker.Stop()
+			for range ticker.C {
+				if _, err := server.refresh(true); err != nil {
+					log.Printf("Refresh failed: %v", err)
+				}
+			}
+		}()
+	} else {
+		log.Printf("Automatic refresh disabled, run.sh will not be run")
+	}
+
+	fmt.Printf("Starting server on http://localhost:%s\n", cfg.Port)
+	log.Fatal(http.ListenAndServe(":"+cfg.Port, server))
+}
+
+// Server serves the pages and APIs over the loaded stats files
+type Server struct {
+	mux  *http.ServeMux
+	data *ServerData
+	// refresh runs run.sh if script is set and reloads the stats files,
+	// returning how many were loaded, and setFiles swaps in newly loaded ones
+	refresh  func(script bool) (int, error)
+	setFiles func(newStatsFiles []StatsFile) bool
+}
+
+// ServeHTTP dispatches the request to the server's handlers
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// newServer registers the handlers over the initially loaded stats files.
+// flags are the flags cfg was parsed from, reported by /api/config.
+func newServer(cfg Config, flags *flag.FlagSet, statsFiles []StatsFile, loadErrors []LoadError) (*Server, error) {
+	columns := parseColumns(cfg.Columns)
+	mux := http.NewServeMux()
+
+	// Parse the page templates, from disk if a templates directory is given
+	templates, err := newTemplateStore(cfg.TemplatesDir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading templates: %v", err)
+	}
+	if cfg.TemplatesDir != "" {
+		fmt.Printf("Loading templates from %s\n", cfg.TemplatesDir)
+		go templates.watch(2 * time.Second)
+	}
+
+	serverData := &ServerData{Files: statsFiles, LoadErrors: loadErrors, ClockWarnings: detectClockRegressions(statsFiles), LastRefresh: time.Now()}
+	if cfg.QueryAPI {
+		if serverData.Query, err = newQueryIndex(statsFiles, cfg.Load); err != nil {
+			return nil, err
+		}
+	}
+
+	sparklines := newSparklineCache()
+	if cfg.PrecomputeWorkers > 0 && !cfg.Load.LowMemory {
+		go precomputeSparklines(sparklines, recentFiles(statsFiles, cfg.DefaultRange), serverData.Version, cfg.PrecomputeWorkers)
+	}
+
+	// refreshMu serializes script runs and reloads between the ticker and
+	// the HTTP endpoints that trigger them
+	var refreshMu sync.Mutex
+
+	// setFiles swaps in newly loaded stats files. An empty result either keeps
+	// the last good data or clears it, depending on -on-empty; it reports
+	// whether the new files were applied.
+	setFiles := func(newStatsFiles []StatsFile) bool {
+		serverData.mu.Lock()
+		defer serverData.mu.Unlock()
+		serverData.RefreshEmpty = len(newStatsFiles) == 0
+		if serverData.RefreshEmpty && cfg.OnEmpty == "keep" {
+			log.Printf("No JSON stats files found in %s directory, keeping previous data", cfg.Dir)
+			return false
+		}
+		statsFiles = newStatsFiles
+		// Update server data
+		serverData.Files = statsFiles
+		serverData.ClockWarnings = detectClockRegressions(statsFiles)
+		serverData.LastRefresh = time.Now()
+		serverData.Version++
+		if cfg.QueryAPI {
+			index, err := newQueryIndex(statsFiles, cfg.Load)
+			if err != nil {
+				log.Printf("Error rebuilding the query index: %v", err)
+			}
+			// Handlers only query the index under the read lock, so the
+			// old one is no longer in use
+			if serverData.Query != nil {
+				serverData.Query.Close()
+			}
+			serverData.Query = index
+		}
+		if cfg.PrecomputeWorkers > 0 && !cfg.Load.LowMemory {
+			go precomputeSparklines(sparklines, recentFiles(statsFiles, cfg.DefaultRange), serverData.Version, cfg.PrecomputeWorkers)
+		}
+		return true
+	}
+
+	// recordLoad keeps the outcome of a reload for /api/load-errors and
+	// /healthz. A load that failed with load errors was rejected under
+	// -strict-files, and the previous data stays in place.
+	recordLoad := func(loadErrors []LoadError, err error) {
+		if loadErrors == nil {
+			return
+		}
+		serverData.mu.Lock()
+		defer serverData.mu.Unlock()
+		serverData.LoadErrors = loadErrors
+		serverData.LoadFailed = ""
+		if err != nil {
+			serverData.LoadFailed = err.Error()
+		}
+	}
+
+	// runScript runs run.sh within -refresh-timeout, counting consecutive
+	// timeouts for /healthz. The caller must hold refreshMu.
+	runScript := func() ([]byte, error) {
+		output, err := runCommand(cfg.RefreshTimeout, []string{"STATS_DIR=" + cfg.Dir}, "bash", "run.sh")
+		serverData.mu.Lock()
+		defer serverData.mu.Unlock()
+		if err == errCommandTimeout {
+			serverData.RefreshTimeouts++
+			log.Printf("run.sh killed after %v (%d consecutive timeouts)", cfg.RefreshTimeout, serverData.RefreshTimeouts)
+			return output, fmt.Errorf("run.sh timed out after %v", cfg.RefreshTimeout)
+		}
+		serverData.RefreshTimeouts = 0
+		return output, err
+	}
+
+	// refresh runs the stats script if script is set and reloads the stats
+	// files. With -refresh 0 the script is never run and only the files are
+	// reloaded. refreshMu keeps overlapping refreshes from interleaving.
+	refresh := func(script bool) (int, error) {
+		refreshMu.Lock()
+		defer refreshMu.Unlock()
+
+		// run bash script to refresh stats files
+		if script && cfg.Refresh > 0 {
+			if _, err := runScript(); err != nil {
+				return 0, fmt.Errorf("error running run.sh: %v", err)
+			}
+		}
+		log.Println("Refreshing stats files...")
+		newStatsFiles, loadErrors, err := loadAllStatsFiles(cfg.Dir, cfg.Load)
+		recordLoad(loadErrors, err)
+		if err != nil {
+			return 0, fmt.Errorf("error refreshing stats files: %v", err)
+		}
+		if !setFiles(newStatsFiles) {
+			return 0, fmt.Errorf("no JSON stats files found in %s directory", cfg.Dir)
+		}
+		fmt.Printf("Refreshed %d stats files\n", len(statsFiles))
+		return len(statsFiles), nil
+	}
+
+	// scopedMeta returns the stats files a request covers: those within the
+	// from/to parameters if given, else those within the ?range= duration or
+	// -default-range of the newest file. range=all covers every file. Under
+	// -low-memory the files have no stats; see scopedFiles.
+	scopedMeta := func(r *http.Request) ([]StatsFile, error) {
+		query := r.URL.Query()
+		if query.Get("from") != "" || query.Get("to") != "" {
+			var bounds [2]time.Time
+			for i, param := range []string{"from", "to"} {
+				if value := query.Get(param); value != "" {
+					t, err := parseTimeParam(value)
+					if err != nil {
+						return nil, fmt.Errorf("invalid %s parameter: %v", param, err)
+					}
+					bounds[i] = t
+				}
+			}
+			if !bounds[0].IsZero() && !bounds[1].IsZero() && bounds[0].After(bounds[1]) {
+				return nil, fmt.Errorf("invalid time range: from %s is after to %s", query.Get("from"), query.Get("to"))
+			}
+			return filesInRange(serverData.Snapshot(), bounds[0], bounds[1]), nil
+		}
+
+		window := cfg.DefaultRange
+		if rangeParam := query.Get("range"); rangeParam == "all" {
+			window = 0
+		} else if rangeParam != "" {
+			var err error
+			if window, err = time.ParseDuration(rangeParam); err != nil || window < 0 {
+				return nil, fmt.Errorf("invalid range parameter %q", rangeParam)
+			}
+		}
+		return recentFiles(serverData.Snapshot(), window), nil
+	}
+
+	// scopedFiles returns the stats files a request covers with their stats,
+	// re-reading them from disk under -low-memory
+	scopedFiles := func(r *http.Request) ([]StatsFile, error) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			return nil, err
+		}
+		return withStats(files, cfg.Load), nil
+	}
+
+	// containerSummaries returns the marked summaries of the files'
+	// containers. The files are aggregated one at a time, so under
+	// -low-memory only one file's stats are in memory at once.
+	containerSummaries := func(files []StatsFile) []ContainerSummary {
+		collector, baseline := newSummaryCollector(), newBaselineCollector()
+		forEachStatsFile(files, cfg.Load, func(statsFile StatsFile) {
+			collector.add(statsFile)
+			baseline.add(statsFile)
+		})
+		summaries := collector.summaries(cfg.Stats)
+		markAlwaysBusy(summaries, cfg.BusyFloor)
+		markEfficiency(summaries, cfg.EfficiencyCPUWeight, cfg.EfficiencyMemWeight)
+		baseline.mark(summaries, cfg.BaselineFactor)
+		return summaries
+	}
+
+	// Main page handler
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(files) == 0 {
+			w.Header().Set("Content-Type", "text/html")
+			if err := templates.Get("stats").Execute(w, PageData{Thresholds: cfg.Thresholds, Columns: columns}); err != nil {
+				http.Error(w, "Error rendering template", http.StatusInternalServerError)
+				log.Printf("Template error: %v", err)
+			}
+			return
+		}
+
+		selectedIndex := 0
+		if fileParam := r.URL.Query().Get("file"); fileParam != "" {
+			if idx, err := strconv.Atoi(fileParam); err == nil && idx >= 0 && idx < len(files) {
+				selectedIndex = idx
+			}
+		}
+
+		// Optionally average each container over the trailing avg files
+		avgWindow := 1
+		if avgParam := r.URL.Query().Get("avg"); avgParam != "" {
+			if n, err := strconv.Atoi(avgParam); err == nil && n >= 1 {
+				avgWindow = min(n, len(files)-selectedIndex)
+			}
+		}
+		// Optionally diff the selected file against the one diff_back
+		// snapshots older, clamped to the available history
+		diffBack := 0
+		if diffParam := r.URL.Query().Get("diff_back"); diffParam != "" {
+			if n, err := strconv.Atoi(diffParam); err == nil && n >= 1 {
+				diffBack = min(n, len(files)-1-selectedIndex)
+			}
+		}
+
+		// The page only shows the stats of the selected file and the older
+		// ones averaged, charted or diffed against it; the dropdown only
+		// needs the names and timestamps of the rest
+		files = withStatsWindow(files, selectedIndex, max(avgWindow, cfg.SparklinePoints, diffBack+1), cfg.Load)
+
+		pageData := PageData{
+			Files:            files,
+			SelectedFile:     averageStatsFile(files, selectedIndex, avgWindow),
+			SelectedIndex:    selectedIndex,
+			AvgWindow:        avgWindow,
+			ContainerAccents: r.URL.Query().Get("accent") == "1",
+			FocusHottest:     cfg.FocusHottest,
+			CPUSeries:        trailingCPUSeries(files, selectedIndex, cfg.SparklinePoints),
+			Columns:          columns,
+			Thresholds:       cfg.Thresholds,
+			DiffBack:         diffBack,
+		}
+		if pageData.DiffBack > 0 {
+			pageData.DiffFile = files[selectedIndex+pageData.DiffBack]
+			pageData.Changes = getChanges(pageData.DiffFile, files[selectedIndex])
+		}
+
+		// Optionally point the page at the selected file's worst offender. The
+		// form sends a hidden focus=0 before the checkbox, so the last value wins
+		if focusParams := r.URL.Query()["focus"]; len(focusParams) > 0 {
+			pageData.FocusHottest = focusParams[len(focusParams)-1] == "1"
+		}
+		if pageData.FocusHottest {
+			if hottest := getOverview([]StatsFile{pageData.SelectedFile}, cfg.Thresholds, "").Hottest; hottest != nil {
+				pageData.HottestID = hottest.ContainerID
+			}
+		}
+
+		// Show one page of the selected file's containers. Without an explicit
+		// page, a focused hottest container opens the page it is on.
+		pageSize := defaultPageSize
+		if sizeParam := r.URL.Query().Get("pageSize"); sizeParam != "" {
+			if n, err := strconv.Atoi(sizeParam); err == nil && n >= 1 {
+				pageSize = n
+			}
+		}
+		page := 1
+		if pageParam := r.URL.Query().Get("page"); pageParam != "" {
+			if n, err := strconv.Atoi(pageParam); err == nil {
+				page = n
+			}
+		} else if pageData.HottestID != "" {
+			for i, stat := range pageData.SelectedFile.Stats {
+				if stat.ID == pageData.HottestID {
+					page = i/pageSize + 1
+					break
+				}
+			}
+		}
+		pagination, start, end := paginate(len(pageData.SelectedFile.Stats), page, pageSize)
+		if pagination.Page > 1 {
+			pagination.PrevURL = pageURL(r, pagination.Page-1)
+		}
+		if pagination.Page < pagination.Pages {
+			pagination.NextURL = pageURL(r, pagination.Page+1)
+		}
+		pageData.Page = pagination
+		pageData.PageStats = pageData.SelectedFile.Stats[start:end]
+
+		w.Header().Set("Content-Type", "text/html")
+		if err := templates.Get("stats").Execute(w, pageData); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			log.Printf("Template error: %v", err)
+		}
+	})
+
+	// API endpoint for container comparison (JSON), with per-container
+	// sub-resources under /api/container/{id}/...
+	mux.HandleFunc("/api/container/", func(w http.ResponseWriter, r *http.Request) {
+		// Taken before the files, so a refresh in between caches the
+		// sparkline under the old version rather than stale data under the new
+		version := serverData.CurrentVersion()
+		files, err := scopedFiles(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Extract container ID and optional sub-resource from URL path
+		path := strings.TrimPrefix(r.URL.Path, "/api/container/")
+		containerID, resource, _ := strings.Cut(path, "/")
+
+		if containerID == "" {
+			http.Error(w, "Container ID required", http.StatusBadRequest)
+			return
+		}
+
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Expand short IDs, refusing ambiguous ones in strict mode
+		containerID, candidates := resolveContainerID(files, containerID, cfg.ShortIDMode)
+		if candidates != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			newJSONEncoder(w, r).Encode(map[string]interface{}{
+				"error":      "ambiguous container ID prefix",
+				"candidates": candidates,
+			})
+			return
+		}
+
+		// The summary row doesn't need the full history
+		if resource == "summary" {
+			summary, ok := getContainerSummary(files, containerID, cfg.Stats)
+			if !ok {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			summaries := []ContainerSummary{summary}
+			markAlwaysBusy(summaries, cfg.BusyFloor)
+			markEfficiency(summaries, cfg.EfficiencyCPUWeight, cfg.EfficiencyMemWeight)
+			markAboveBaseline(files, summaries, cfg.BaselineFactor)
+			summary = summaries[0]
+			summary.FirstSeen = summary.FirstSeenTime.Format(timeLayout)
+			summary.LastSeen = summary.LastSeenTime.Format(timeLayout)
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := newJSONEncoder(w, r).Encode(summary); err != nil {
+				http.Error(w, "Error encoding response", http.StatusInternalServerError)
+				log.Printf("JSON encoding error: %v", err)
+			}
+			return
+		}
+
+		// Get comparison data
+		comparison := getContainerComparison(files, containerID)
+
+		var response interface{}
+		switch resource {
+		case "":
+			raw := false
+			if rawParam := r.URL.Query().Get("raw"); rawParam != "" {
+				if raw, err = strconv.ParseBool(rawParam); err != nil {
+					http.Error(w, "Invalid raw parameter", http.StatusBadRequest)
+					return
+				}
+			}
+			if !raw {
+				stripRawValues(comparison.Data)
+			}
+			order := r.URL.Query().Get("order")
+			if order != "" && order != "asc" && order != "desc" {
+				http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+				return
+			}
+			window := 5
+			if windowParam := r.URL.Query().Get("window"); windowParam != "" {
+				window, err = strconv.Atoi(windowParam)
+				if err != nil || window < 1 {
+					http.Error(w, "Invalid window parameter", http.StatusBadRequest)
+					return
+				}
+			}
+			cpuValues, _ := dataPointValues(comparison.Data, "cpu")
+			comparison.CPUMovingMax = movingMax(cpuValues, window)
+			comparison.Gaps = markGaps(comparison.Data, cfg.GapFactor)
+			formatDataPointTimestamps(comparison.Data, timeLayout)
+			if order == "desc" {
+				reverseDataPoints(&comparison)
+			}
+			response = comparison
+		case "rolling-p95":
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			window := 20
+			if windowParam := r.URL.Query().Get("window"); windowParam != "" {
+				window, err = strconv.Atoi(windowParam)
+				if err != nil || window < 1 {
+					http.Error(w, "Invalid window parameter", http.StatusBadRequest)
+					return
+				}
+			}
+			metric := r.URL.Query().Get("metric")
+			if metric == "" {
+				metric = "cpu"
+			}
+			values, err := dataPointValues(comparison.Data, metric)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			response = RollingSeries{
+				ContainerID: containerID,
+				Metric:      metric,
+				Window:      window,
+				Points:      seriesPoints(comparison.Data, rollingPercentile(values, window, 95), timeLayout),
+			}
+		case "sparkline.png":
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			query := r.URL.Query()
+			metric := query.Get("metric")
+			if metric == "" {
+				metric = "cpu"
+			}
+			values, err := dataPointValues(comparison.Data, metric)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			width, height := sparklineWidth, sparklineHeight
+			if widthParam := query.Get("width"); widthParam != "" {
+				if width, err = strconv.Atoi(widthParam); err != nil || width < 1 || width > 1000 {
+					http.Error(w, "width must be between 1 and 1000", http.StatusBadRequest)
+					return
+				}
+			}
+			if heightParam := query.Get("height"); heightParam != "" {
+				if height, err = strconv.Atoi(heightParam); err != nil || height < 1 || height > 500 {
+					http.Error(w, "height must be between 1 and 500", http.StatusBadRequest)
+					return
+				}
+			}
+
+			var scope string
+			if query.Get("range") != "" || query.Get("from") != "" || query.Get("to") != "" {
+				scope = strings.Join([]string{query.Get("range"), query.Get("from"), query.Get("to")}, "|")
+			}
+			key := sparklineKey(containerID, metric, width, height, scope)
+			img, err := sparklines.Get(version, key, func() ([]byte, error) {
+				return renderSparkline(values, width, height)
+			})
+			if err != nil {
+				http.Error(w, "Error rendering sparkline", http.StatusInternalServerError)
+				log.Printf("Sparkline error: %v", err)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(img)
+			return
+		case "rates":
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			response = intervalRates(comparison.Data, cfg.RateGapAfter, timeLayout)
+		case "restarts":
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			response = detectRestarts(comparison.Data, timeLayout)
+		case "io.csv":
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			delimiter, contentType, ext := ',', "text/csv", "csv"
+			switch r.URL.Query().Get("format") {
+			case "", "csv":
+			case "tsv":
+				delimiter, contentType, ext = '\t', "text/tab-separated-values", "tsv"
+			default:
+				http.Error(w, "format must be csv or tsv", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", containerID+"_io."+ext))
+			if err := writeIOCSV(w, comparison.Data, timeLayout, delimiter); err != nil {
+				log.Printf("CSV writing error: %v", err)
+			}
+			return
+		case "calendar":
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			response = containerCalendar(comparison.Data)
+		case "regression":
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			// By default the recent window is the newer half of the history
+			recent := len(comparison.Data) / 2
+			if recentParam := r.URL.Query().Get("recent"); recentParam != "" {
+				recent, err = strconv.Atoi(recentParam)
+				if err != nil || recent < 1 {
+					http.Error(w, "Invalid recent parameter", http.StatusBadRequest)
+					return
+				}
+			}
+			response = detectRegression(containerID, comparison.Data, recent, timeLayout)
+		case "over":
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			metric := r.URL.Query().Get("metric")
+			if metric == "" {
+				metric = "cpu"
+			}
+			values, err := dataPointValues(comparison.Data, metric)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			threshold, err := strconv.ParseFloat(r.URL.Query().Get("threshold"), 64)
+			if err != nil {
+				http.Error(w, "Invalid threshold parameter", http.StatusBadRequest)
+				return
+			}
+			markGaps(comparison.Data, cfg.GapFactor)
+			over, observed := overThresholdSeconds(comparison.Data, values, threshold)
+			result := OverThreshold{
+				ContainerID:     containerID,
+				Metric:          metric,
+				Threshold:       threshold,
+				OverSeconds:     over,
+				ObservedSeconds: observed,
+			}
+			if observed > 0 {
+				result.OverPercent = over / observed * 100
+			}
+			response = result
+		case "slo":
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			metric := r.URL.Query().Get("metric")
+			if metric == "" {
+				metric = "cpu"
+			}
+			values, err := dataPointValues(comparison.Data, metric)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			threshold, err := strconv.ParseFloat(r.URL.Query().Get("threshold"), 64)
+			if err != nil {
+				http.Error(w, "Invalid threshold parameter", http.StatusBadRequest)
+				return
+			}
+			objective := r.URL.Query().Get("objective")
+			if objective == "" {
+				objective = "below"
+			}
+			if objective != "below" && objective != "above" {
+				http.Error(w, "objective must be below or above", http.StatusBadRequest)
+				return
+			}
+			compliant, compliance := sloCompliance(values, threshold, objective == "above")
+			response = SLOCompliance{
+				ContainerID: containerID,
+				Metric:      metric,
+				Threshold:   threshold,
+				Objective:   objective,
+				DataPoints:  len(values),
+				Compliant:   compliant,
+				Compliance:  compliance,
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(response); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// Container details page route
+	mux.HandleFunc("/container/", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedFiles(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Extract container ID from URL path; /container/{id}.csv and
+		// ?format=csv download the history instead
+		path := r.URL.Path
+		containerID, csvSuffix := strings.CutSuffix(strings.TrimPrefix(path, "/container/"), ".csv")
+		asCSV := csvSuffix || r.URL.Query().Get("format") == "csv"
+
+		if containerID == "" {
+			http.Error(w, "Container ID required", http.StatusBadRequest)
+			return
+		}
+
+		// Expand short IDs, refusing ambiguous ones in strict mode
+		containerID, candidates := resolveContainerID(files, containerID, cfg.ShortIDMode)
+		if candidates != nil {
+			var ids []string
+			for _, candidate := range candidates {
+				ids = append(ids, candidate.ContainerID+" ("+candidate.ContainerName+")")
+			}
+			http.Error(w, "Ambiguous container ID prefix, matches: "+strings.Join(ids, ", "), http.StatusConflict)
+			return
+		}
+
+		if asCSV {
+			comparison := getContainerComparison(files, containerID)
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", containerID+".csv"))
+			if err := writeHistoryCSV(w, comparison.Data, humanTimeLayout); err != nil {
+				log.Printf("CSV writing error: %v", err)
+			}
+			return
+		}
+
+		// Get comparison data with statistics
+		comparison := getContainerComparisonWithStats(files, containerID, cfg.Stats)
+		comparison.Gaps = markGaps(comparison.Data, cfg.GapFactor)
+		comparison.Thresholds = cfg.Thresholds
+		comparison.Columns = columns
+
+		if len(comparison.Data) == 0 {
+			http.Error(w, "No historical data found for container", http.StatusNotFound)
+			return
+		}
+		comparison.StatusLine, comparison.StatusClass = statusLine(comparison, files[0].Timestamp)
+
+		// Render container details page
+		w.Header().Set("Content-Type", "text/html")
+		if err := templates.Get("container").Execute(w, comparison); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			log.Printf("Template error: %v", err)
+		}
+	})
+
+	// Summary page route
+	mux.HandleFunc("/summary", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// IO columns show either the bytes moved or the average rate
+		ioMode := r.URL.Query().Get("io")
+		if ioMode == "" {
+			ioMode = "total"
+		}
+		if ioMode != "total" && ioMode != "rate" {
+			http.Error(w, "io must be total or rate", http.StatusBadRequest)
+			return
+		}
+
+		summaries := containerSummaries(files)
+		if err := rankSummaries(summaries, r.URL.Query().Get("rank")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		report := summaryReport(files, summaries, humanTimeLayout)
+		var projects []ContainerGroup
+		switch r.URL.Query().Get("group") {
+		case "":
+		case "project":
+			projects = getProjectGroups(summaries, "sum")
+		default:
+			http.Error(w, "group must be project", http.StatusBadRequest)
+			return
+		}
 
-    <div class="search-container">
-        <label for="searchInput">Search by container name:</label>
-        <input type="text" id="searchInput" placeholder="Enter container name..." onkeyup="filterTable()">
-        <button onclick="clearSearch()">Clear</button>
-    </div>
+		// Color each container's last seen time by how far it lags the newest file
+		if !report.Newest.IsZero() {
+			for i := range report.Summaries {
+				report.Summaries[i].LastSeenClass = recencyClass(report.Summaries[i].LastSeenTime, report.Newest, cfg.StaleAfter, cfg.OldAfter)
+			}
+		}
 
-    <table id="summaryTable">
-        <thead>
-            <tr>
-                <th onclick="sortTable(0)">Container Name</th>
-                <th onclick="sortTable(1)">ID</th>
-                <th onclick="sortTable(2)">Data Points</th>
-                <th onclick="sortTable(3)">Avg CPU %</th>
-                <th onclick="sortTable(4)">Peak CPU %</th>
-                <th onclick="sortTable(5)">Min CPU %</th>
-                <th onclick="sortTable(6)">Avg Mem %</th>
-                <th onclick="sortTable(7)">Peak Mem %</th>
-                <th onclick="sortTable(8)">Min Mem %</th>
-                <th onclick="sortTable(9)">First Seen</th>
-                <th onclick="sortTable(10)">Last Seen</th>
-            </tr>
-        </thead>
-        <tbody>
-            {{range .Summaries}}
-            <tr>
-                <td>{{.ContainerName}}</td>
-                <td><a href="/container/{{.ContainerID}}" class="clickable-id">{{.ContainerID}}</a></td>
-                <td>{{.DataPoints}}</td>
-                <td class="{{if gt .AvgCPU 80.0}}metric-high{{else if gt .AvgCPU 50.0}}metric-medium{{else}}metric-low{{end}}">{{printf "%.2f" .AvgCPU}}%</td>
-                <td class="{{if gt .MaxCPU 90.0}}metric-high{{else if gt .MaxCPU 70.0}}metric-medium{{else}}metric-low{{end}}">{{printf "%.2f" .MaxCPU}}%</td>
-                <td>{{printf "%.2f" .MinCPU}}%</td>
-                <td class="{{if gt .AvgMem 80.0}}metric-high{{else if gt .AvgMem 50.0}}metric-medium{{else}}metric-low{{end}}">{{printf "%.2f" .AvgMem}}%</td>
-                <td class="{{if gt .MaxMem 90.0}}metric-high{{else if gt .MaxMem 70.0}}metric-medium{{else}}metric-low{{end}}">{{printf "%.2f" .MaxMem}}%</td>
-                <td>{{printf "%.2f" .MinMem}}%</td>
-                <td>{{.FirstSeen}}</td>
-                <td>{{.LastSeen}}</td>
-            </tr>
-            {{end}}
-        </tbody>
-    </table>
+		pageData := SummaryPageData{
+			SummaryReport:  report,
+			BusyFloor:      cfg.BusyFloor,
+			BaselineFactor: cfg.BaselineFactor,
+			Thresholds:     cfg.Thresholds,
+			Columns:        columns,
+			IOMode:         ioMode,
+			Stats:          cfg.Stats,
+			Projects:       projects,
+		}
 
-    <script>
-        let sortDirection = {};
-        
-        function sortTable(columnIndex) {
-            const table = document.getElementById('summaryTable');
-            const tbody = table.querySelector('tbody');
-            const rows = Array.from(tbody.querySelectorAll('tr')).filter(row => row.style.display !== 'none');
-            
-            const isNumeric = (str) => {
-                if (columnIndex >= 3 && columnIndex <= 8) { // CPU/Memory percentage columns
-                    return !isNaN(parseFloat(str.replace('%', '')));
-                }
-                if (columnIndex === 2) { // Data Points column
-                    return !isNaN(parseFloat(str));
-                }
-                return false;
-            };
-            
-            const getValue = (row, index) => {
-                let value = row.cells[index].textContent.trim();
-                if (columnIndex >= 3 && columnIndex <= 8) {
-                    return parseFloat(value.replace('%', '')) || 0;
-                }
-                if (columnIndex === 2) {
-                    return parseFloat(value) || 0;
-                }
-                return value.toLowerCase();
-            };
-            
-            const currentDirection = sortDirection[columnIndex] || 'asc';
-            const newDirection = currentDirection === 'asc' ? 'desc' : 'asc';
-            sortDirection[columnIndex] = newDirection;
-            
-            rows.sort((a, b) => {
-                const aVal = getValue(a, columnIndex);
-                const bVal = getValue(b, columnIndex);
-                
-                let comparison = 0;
-                if (aVal < bVal) comparison = -1;
-                else if (aVal > bVal) comparison = 1;
-                
-                return newDirection === 'asc' ? comparison : -comparison;
-            });
-            
-            // Reorder rows
-            rows.forEach(row => tbody.appendChild(row));
-        }
+		// Render summary page
+		w.Header().Set("Content-Type", "text/html")
+		if err := templates.Get("summary").Execute(w, pageData); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			log.Printf("Template error: %v", err)
+		}
+	})
 
-        function filterTable() {
-            const input = document.getElementById('searchInput');
-            const filter = input.value.toLowerCase();
-            const table = document.getElementById('summaryTable');
-            const tbody = table.querySelector('tbody');
-            const rows = tbody.querySelectorAll('tr');
-            
-            rows.forEach(row => {
-                const containerName = row.cells[0].textContent.toLowerCase();
-                if (containerName.includes(filter)) {
-                    row.style.display = '';
-                } else {
-                    row.style.display = 'none';
-                }
-            });
-        }
+	// API endpoint for the summary report (JSON)
+	mux.HandleFunc("/api/summary", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		summaries := containerSummaries(files)
+		if err := rankSummaries(summaries, r.URL.Query().Get("rank")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i := range summaries {
+			summaries[i].FirstSeen = summaries[i].FirstSeenTime.Format(timeLayout)
+			summaries[i].LastSeen = summaries[i].LastSeenTime.Format(timeLayout)
+		}
+		report := summaryReport(files, summaries, timeLayout)
+		if report.Summaries == nil {
+			report.Summaries = []ContainerSummary{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(report); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// API endpoint exporting the summary report with every computed field
+	// as CSV, optionally filtered by name and sorted by a column
+	mux.HandleFunc("/api/summary.csv", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query()
+		order := query.Get("order")
+		if order != "" && order != "asc" && order != "desc" {
+			http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+			return
+		}
+		var sortColumn SummaryColumn
+		if sortParam := query.Get("sort"); sortParam != "" {
+			var ok bool
+			if sortColumn, ok = lookupSummaryColumn(sortParam); !ok {
+				http.Error(w, fmt.Sprintf("Unknown sort column %q", sortParam), http.StatusBadRequest)
+				return
+			}
+		}
+
+		summaries := containerSummaries(files)
+		if name := strings.ToLower(query.Get("name")); name != "" {
+			filtered := summaries[:0]
+			for _, summary := range summaries {
+				if strings.Contains(strings.ToLower(summary.ContainerName), name) {
+					filtered = append(filtered, summary)
+				}
+			}
+			summaries = filtered
+		}
+		if sortColumn.Value != nil {
+			sortSummaries(summaries, sortColumn, order == "desc")
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="summary.csv"`)
+		if err := writeSummaryCSV(w, summaries, summaryColumns, timeLayout); err != nil {
+			log.Printf("CSV writing error: %v", err)
+		}
+	})
+
+	// CSV download of the summary page
+	mux.HandleFunc("/summary.csv", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="summary.csv"`)
+		if err := writeSummaryCSV(w, containerSummaries(files), summaryReportColumns, humanTimeLayout); err != nil {
+			log.Printf("CSV writing error: %v", err)
+		}
+	})
+
+	// API endpoint that parses an uploaded stats file without loading it
+	mux.HandleFunc("/api/validate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dockerStats, lineErrors, err := readStats(r.Body)
+		if err != nil {
+			http.Error(w, "Error reading request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := ValidationResult{Parsed: len(dockerStats), Failed: lineErrors}
+		if result.Failed == nil {
+			result.Failed = []LineError{}
+		}
+		if len(dockerStats) > 0 {
+			result.Sample = &dockerStats[0]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(result); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// API endpoint aggregating the summaries by a container label or
+	// compose project
+	mux.HandleFunc("/api/groups", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedFiles(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		by := r.URL.Query().Get("by")
+		key, ok := strings.CutPrefix(by, "label:")
+		if by != "project" && (!ok || key == "") {
+			http.Error(w, "by must be label:<key> or project", http.StatusBadRequest)
+			return
+		}
+
+		agg := r.URL.Query().Get("agg")
+		if agg == "" {
+			agg = "sum"
+		}
+		switch agg {
+		case "sum", "avg", "max":
+		default:
+			http.Error(w, "agg must be one of "+strings.Join(groupAggregations, ", "), http.StatusBadRequest)
+			return
+		}
+
+		summaries := getAllContainerSummaries(files, cfg.Stats)
+		var groups []ContainerGroup
+		if by == "project" {
+			groups = getProjectGroups(summaries, agg)
+		} else {
+			groups = getLabelGroups(files, summaries, key, agg)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(groups); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// API endpoint listing the files skipped by the last load
+	mux.HandleFunc("/api/load-errors", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		serverData.mu.RLock()
+		loadErrors := serverData.LoadErrors
+		serverData.mu.RUnlock()
+		if err := newJSONEncoder(w, r).Encode(loadErrors); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// API endpoint listing files whose timestamp went backwards compared to
+	// the file written before them
+	mux.HandleFunc("/api/clock-warnings", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		serverData.mu.RLock()
+		warnings := serverData.ClockWarnings
+		serverData.mu.RUnlock()
+		if err := newJSONEncoder(w, r).Encode(warnings); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// API endpoint with the CPU and memory series of several containers
+	// aligned for overlay
+	mux.HandleFunc("/api/compare", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedFiles(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ids, err := compareIDs(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		byID := getMultiContainerComparison(files, ids)
+		var comparisons []ContainerComparison
+		for _, containerID := range ids {
+			comparison := byID[containerID]
+			if len(comparison.Data) == 0 {
+				http.Error(w, "No historical data found for container "+containerID, http.StatusNotFound)
+				return
+			}
+			comparisons = append(comparisons, comparison)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(alignComparisons(comparisons, timeLayout)); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// networkTop ranks the request's files' containers by network bytes,
+	// limited to the ?n= parameter (default 10)
+	networkTop := func(r *http.Request) ([]NetworkTalker, int, error) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		n := 10
+		if nParam := r.URL.Query().Get("n"); nParam != "" {
+			n, err = strconv.Atoi(nParam)
+			if err != nil || n < 1 {
+				return nil, 0, fmt.Errorf("invalid n parameter")
+			}
+		}
+		return getNetworkTop(containerSummaries(files), n), n, nil
+	}
+
+	// API endpoint with the containers that moved the most network bytes
+	mux.HandleFunc("/api/network-top", func(w http.ResponseWriter, r *http.Request) {
+		talkers, _, err := networkTop(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(talkers); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// Network top talkers page
+	mux.HandleFunc("/network", func(w http.ResponseWriter, r *http.Request) {
+		talkers, n, err := networkTop(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		if err := templates.Get("network").Execute(w, NetworkPageData{Talkers: talkers, N: n}); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			log.Printf("Template error: %v", err)
+		}
+	})
+
+	// Multi-container comparison page, drawing the aligned series
+	// client-side. Without IDs only the form is shown.
+	mux.HandleFunc("/compare", func(w http.ResponseWriter, r *http.Request) {
+		var pageData ComparePageData
+		ids, err := compareIDs(r)
+		if err == nil {
+			pageData.IDs = ids
+		} else if r.URL.RawQuery != "" {
+			pageData.Error = err.Error()
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if err := templates.Get("compare").Execute(w, pageData); err != nil {
+			http.Error(w, "Error rendering template", http.StatusInternalServerError)
+			log.Printf("Template error: %v", err)
+		}
+	})
+
+	// API endpoint with the effective configuration, secrets masked
+	mux.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(effectiveConfig(flags)); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
 
-        function clearSearch() {
-            document.getElementById('searchInput').value = '';
-            filterTable();
-        }
-    </script>
-</body>
-</html>
-`
+	// API endpoint with the key numbers of the newest stats file
+	mux.HandleFunc("/api/overview", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-type PageData struct {
-	Files         []StatsFile
-	SelectedFile  StatsFile
-	SelectedIndex int
-}
+		// Only the newest file is summarized
+		overview := getOverview(withStats(files[:min(1, len(files))], cfg.Load), cfg.Thresholds, timeLayout)
 
-type SummaryPageData struct {
-	Summaries      []ContainerSummary
-	TotalFiles     int
-	FirstTimestamp string
-	LastTimestamp  string
-	HighestPeakCPU *ContainerSummary
-	MostDataPoints *ContainerSummary
-}
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(overview); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
 
-func main() {
-	// Load all stats files on startup
-	statsFiles, err := loadAllStatsFiles("stats/")
-	if err != nil {
-		log.Fatalf("Error loading stats files: %v", err)
-	}
+	// API endpoint with totals across the whole dataset
+	mux.HandleFunc("/api/stats-overview", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	if len(statsFiles) == 0 {
-		log.Fatal("No JSON stats files found in stats/ directory")
-	}
+		collector := newDatasetCollector()
+		forEachStatsFile(files, cfg.Load, collector.add)
+		datasetStats := collector.stats(timeLayout)
 
-	fmt.Printf("Loaded %d stats files\n", len(statsFiles))
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(datasetStats); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
 
-	// Create template with custom function
-	tmpl := template.Must(template.New("stats").Funcs(template.FuncMap{
-		"parseFloat": func(s string) float64 {
-			s = strings.TrimSuffix(s, "%")
-			val, _ := strconv.ParseFloat(s, 64)
-			return val
-		},
-	}).Parse(htmlTemplate))
-
-	serverData := &ServerData{Files: statsFiles}
-
-	go func() {
-		// 5 minute refresh interval
-		ticker := time.NewTicker(5 * time.Minute)
-		defer ticker.Stop()
-		for range ticker.C {
-			// run bash script to refresh stats files
-			cmd := exec.Command("bash", "run.sh")
-			err := cmd.Run()
-			if err != nil {
-				log.Printf("Error running run.sh: %v", err)
-				continue
-			}
-			log.Println("Refreshing stats files...")
-			newStatsFiles, err := loadAllStatsFiles("stats/")
-			if err != nil {
-				log.Printf("Error refreshing stats files: %v", err)
-				continue
-			}
-			if len(newStatsFiles) == 0 {
-				log.Println("No JSON stats files found in stats/ directory")
-				continue
-			}
-			statsFiles = newStatsFiles
-			fmt.Printf("Refreshed %d stats files\n", len(statsFiles))
-			// Update server data
-			serverData.Files = statsFiles
+	// API endpoint with the fleet averages per hour of day (and day of week
+	// with ?by=day) for external charting
+	mux.HandleFunc("/api/heatmap", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var byDay bool
+		switch r.URL.Query().Get("by") {
+		case "", "hour":
+		case "day":
+			byDay = true
+		default:
+			http.Error(w, "Invalid by parameter, expected hour or day", http.StatusBadRequest)
+			return
 		}
-	}()
 
-	// Main page handler
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		selectedIndex := 0
-		if fileParam := r.URL.Query().Get("file"); fileParam != "" {
-			if idx, err := strconv.Atoi(fileParam); err == nil && idx >= 0 && idx < len(statsFiles) {
-				selectedIndex = idx
-			}
+		collector := newHeatmapCollector(byDay)
+		forEachStatsFile(files, cfg.Load, collector.add)
+		cells := collector.cells()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(cells); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
 		}
+	})
 
-		pageData := PageData{
-			Files:         serverData.Files,
-			SelectedFile:  serverData.Files[selectedIndex],
-			SelectedIndex: selectedIndex,
+	// API endpoint with the top CPU and memory container of every file, oldest first
+	mux.HandleFunc("/api/peaks", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		w.Header().Set("Content-Type", "text/html")
-		if err := tmpl.Execute(w, pageData); err != nil {
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			log.Printf("Template error: %v", err)
+		// Files are sorted newest first, peaks are listed oldest first
+		peaks := make([]PeakEntry, 0, len(files))
+		forEachStatsFile(files, cfg.Load, func(statsFile StatsFile) {
+			peaks = append(peaks, getPeak(statsFile, timeLayout))
+		})
+		slices.Reverse(peaks)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(peaks); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
 		}
 	})
 
-	// API endpoint for container comparison (JSON)
-	http.HandleFunc("/api/container/", func(w http.ResponseWriter, r *http.Request) {
-		// Extract container ID from URL path
-		path := r.URL.Path
-		containerID := strings.TrimPrefix(path, "/api/container/")
+	// API endpoint with the number of containers in every file, oldest first
+	mux.HandleFunc("/api/container-count", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedFiles(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		if containerID == "" {
-			http.Error(w, "Container ID required", http.StatusBadRequest)
+		counts := getContainerCounts(files, timeLayout)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(counts); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// API endpoint resolving a time, e.g. from an external log, to the
+	// nearest stats file
+	mux.HandleFunc("/api/nearest", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// ts is the time to look up here, so timestamps are always RFC3339
+		t, err := parseTimeParam(r.URL.Query().Get("ts"))
+		if err != nil {
+			http.Error(w, "Invalid ts parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(files) == 0 {
+			http.Error(w, "No stats files loaded", http.StatusNotFound)
 			return
 		}
 
-		// Get comparison data
-		comparison := getContainerComparison(serverData.Files, containerID)
+		index, clamped := nearestFile(files, t)
+		diff := files[index].Timestamp.Sub(t)
+		if diff < 0 {
+			diff = -diff
+		}
+		nearest := NearestFile{
+			Index:       index,
+			File:        files[index].Name,
+			Timestamp:   files[index].Timestamp.Format(time.RFC3339),
+			DiffSeconds: diff.Seconds(),
+			Clamped:     clamped,
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(comparison); err != nil {
+		if err := newJSONEncoder(w, r).Encode(nearest); err != nil {
 			http.Error(w, "Error encoding response", http.StatusInternalServerError)
 			log.Printf("JSON encoding error: %v", err)
 		}
 	})
 
-	// Container details page route
-	http.HandleFunc("/container/", func(w http.ResponseWriter, r *http.Request) {
-		// Extract container ID from URL path
-		path := r.URL.Path
-		containerID := strings.TrimPrefix(path, "/container/")
+	// API endpoint running one of the predefined query templates, if enabled
+	mux.HandleFunc("/api/query", func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.QueryAPI {
+			http.NotFound(w, r)
+			return
+		}
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q, err := parseQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		if containerID == "" {
-			http.Error(w, "Container ID required", http.StatusBadRequest)
+		// The read lock is held while the query runs, so a refresh cannot
+		// close the index under it
+		serverData.mu.RLock()
+		index := serverData.Query
+		var rows []QueryRow
+		if index != nil {
+			rows, err = index.Run(files, q, timeLayout)
+		}
+		serverData.mu.RUnlock()
+		if index == nil {
+			http.Error(w, "Query index is not available", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error running query", http.StatusInternalServerError)
+			log.Printf("Query error: %v", err)
 			return
 		}
 
-		// Get comparison data with statistics
-		comparison := getContainerComparisonWithStats(serverData.Files, containerID)
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(rows); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
 
-		if len(comparison.Data) == 0 {
-			http.Error(w, "No historical data found for container", http.StatusNotFound)
+	// API endpoint with the containers whose CPU changed most between the two newest files
+	mux.HandleFunc("/api/recent", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedFiles(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		n := 10
+		if nParam := r.URL.Query().Get("n"); nParam != "" {
+			parsed, err := strconv.Atoi(nParam)
+			if err != nil || parsed < 1 {
+				http.Error(w, "Invalid n parameter", http.StatusBadRequest)
+				return
+			}
+			n = parsed
+		}
 
-		// Render container details page
-		containerTmpl := template.Must(template.New("container").Funcs(template.FuncMap{
-			"sub": func(a, b int) int {
-				return a - b
-			},
-		}).Parse(containerPageTemplate))
-		w.Header().Set("Content-Type", "text/html")
-		if err := containerTmpl.Execute(w, comparison); err != nil {
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			log.Printf("Template error: %v", err)
+		changes := getRecentChanges(files, n)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(changes); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
 		}
 	})
 
-	// Summary page route
-	http.HandleFunc("/summary", func(w http.ResponseWriter, r *http.Request) {
-		summaries := getAllContainerSummaries(serverData.Files)
-
-		// Calculate additional stats for summary
-		var firstTimestamp, lastTimestamp string
-		var highestPeakCPU, mostDataPoints *ContainerSummary
-
-		if len(serverData.Files) > 0 {
-			// Sort files by timestamp to get first and last
-			sortedFiles := make([]StatsFile, len(serverData.Files))
-			copy(sortedFiles, serverData.Files)
-			sort.Slice(sortedFiles, func(i, j int) bool {
-				return sortedFiles[i].Timestamp.Before(sortedFiles[j].Timestamp)
-			})
-			firstTimestamp = sortedFiles[0].Timestamp.Format("2006-01-02 15:04:05")
-			lastTimestamp = sortedFiles[len(sortedFiles)-1].Timestamp.Format("2006-01-02 15:04:05")
+	// API endpoint listing container names used by more than one container ID
+	mux.HandleFunc("/api/duplicates", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedFiles(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		// Find highest peak CPU and most data points
-		for i := range summaries {
-			if highestPeakCPU == nil || summaries[i].MaxCPU > highestPeakCPU.MaxCPU {
-				highestPeakCPU = &summaries[i]
+		duplicates := getDuplicateNames(files, timeLayout)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(duplicates); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// API endpoints operating on a single stats file, addressed by its index
+	// in the newest-first file list: /api/file/{index}/range
+	mux.HandleFunc("/api/file/", func(w http.ResponseWriter, r *http.Request) {
+		// The raw contents are looked up by file name rather than index
+		if name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/file/"), "/raw"); ok {
+			if !requireAPIKey(w, r, cfg.APIKey) {
+				return
+			}
+			if !validFileName(name) {
+				http.Error(w, "Invalid file name", http.StatusBadRequest)
+				return
 			}
-			if mostDataPoints == nil || summaries[i].DataPoints > mostDataPoints.DataPoints {
-				mostDataPoints = &summaries[i]
+			var path string
+			found := false
+			for _, statsFile := range serverData.Snapshot() {
+				if statsFile.Name == name {
+					path, found = statsFile.Path, true
+					break
+				}
+			}
+			if !found {
+				http.Error(w, "File not found", http.StatusNotFound)
+				return
+			}
+			if path == "" {
+				http.Error(w, "Raw contents are only available for files loaded from the stats directory", http.StatusNotFound)
+				return
+			}
+			// The bytes are served as stored, so gzipped files stay compressed
+			file, err := os.Open(path)
+			if err != nil {
+				http.Error(w, "Error opening file", http.StatusInternalServerError)
+				log.Printf("Error opening %s: %v", path, err)
+				return
+			}
+			defer file.Close()
+			if strings.HasSuffix(path, ".gz") {
+				w.Header().Set("Content-Type", "application/gzip")
+			} else {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 			}
+			if _, err := io.Copy(w, file); err != nil {
+				log.Printf("Error streaming %s: %v", path, err)
+			}
+			return
 		}
 
-		pageData := SummaryPageData{
-			Summaries:      summaries,
-			TotalFiles:     len(serverData.Files),
-			FirstTimestamp: firstTimestamp,
-			LastTimestamp:  lastTimestamp,
-			HighestPeakCPU: highestPeakCPU,
-			MostDataPoints: mostDataPoints,
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/file/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
 		}
 
-		// Render summary page
-		summaryTmpl := template.Must(template.New("summary").Parse(summaryPageTemplate))
-		w.Header().Set("Content-Type", "text/html")
-		if err := summaryTmpl.Execute(w, pageData); err != nil {
-			http.Error(w, "Error rendering template", http.StatusInternalServerError)
-			log.Printf("Template error: %v", err)
+		index, err := strconv.Atoi(parts[0])
+		if err != nil || index < 0 || index >= len(files) {
+			http.Error(w, "Invalid file index", http.StatusNotFound)
+			return
+		}
+		statsFile, ok := fileWithStats(files[index], cfg.Load)
+		if !ok {
+			http.Error(w, "Error reading stats file", http.StatusInternalServerError)
+			return
+		}
+
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var response interface{}
+		switch parts[1] {
+		case "range":
+			query := r.URL.Query()
+			metric := query.Get("metric")
+			if metric == "" {
+				metric = "cpu"
+			}
+			minValue, err := strconv.ParseFloat(query.Get("min"), 64)
+			if err != nil {
+				http.Error(w, "Invalid or missing min value", http.StatusBadRequest)
+				return
+			}
+			maxValue, err := strconv.ParseFloat(query.Get("max"), 64)
+			if err != nil {
+				http.Error(w, "Invalid or missing max value", http.StatusBadRequest)
+				return
+			}
+			if minValue > maxValue {
+				http.Error(w, "min must not be greater than max", http.StatusBadRequest)
+				return
+			}
+
+			containers, err := filterStatsByRange(statsFile.Stats, metric, minValue, maxValue)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			response = FileRangeResult{
+				File:       statsFile.Name,
+				Timestamp:  statsFile.Timestamp.Format(timeLayout),
+				Metric:     metric,
+				Min:        minValue,
+				Max:        maxValue,
+				Containers: containers,
+			}
+		case "outliers":
+			response = getFileOutliers(statsFile, timeLayout)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := newJSONEncoder(w, r).Encode(response); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+			log.Printf("JSON encoding error: %v", err)
+		}
+	})
+
+	// API endpoint streaming all stats as NDJSON, optionally filtered
+	mux.HandleFunc("/api/export", func(w http.ResponseWriter, r *http.Request) {
+		files, err := scopedMeta(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		timeLayout, err := apiTimeLayout(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseExportFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		if cfg.MaxExportBytes > 0 {
+			// The outcome is only known once streaming is done, so it is sent as a trailer
+			w.Header().Set("X-Export-Max-Bytes", strconv.FormatInt(cfg.MaxExportBytes, 10))
+			w.Header().Set("Trailer", "X-Export-Truncated")
+		}
+		truncated, err := writeExport(w, files, cfg.Load, filter, timeLayout, cfg.MaxExportBytes)
+		if err != nil {
+			log.Printf("Export error: %v", err)
+		}
+		if cfg.MaxExportBytes > 0 {
+			w.Header().Set("X-Export-Truncated", strconv.FormatBool(truncated))
 		}
 	})
 
-	http.HandleFunc("/api/run-script", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/run-script", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		cmd := exec.Command("bash", "run.sh")
-		output, err := cmd.CombinedOutput()
+		if !requireAdmin(w, r, cfg.APIKey, cfg.ReadOnly) {
+			return
+		}
+		if cfg.Refresh == 0 {
+			http.Error(w, "run.sh is disabled with -refresh 0", http.StatusForbidden)
+			return
+		}
+		refreshMu.Lock()
+		defer refreshMu.Unlock()
+		output, err := runScript()
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "{\"success\":false,\"error\":%q,\"output\":%q}", err.Error(), string(output))
@@ -1351,20 +7619,103 @@ func main() {
 		}
 		fmt.Fprintf(w, "{\"success\":true,\"output\":%q}", string(output))
 		log.Println("Refreshing stats files...")
-		newStatsFiles, err := loadAllStatsFiles("stats/")
+		newStatsFiles, loadErrors, err := loadAllStatsFiles(cfg.Dir, cfg.Load)
+		recordLoad(loadErrors, err)
 		if err != nil {
 			log.Printf("Error refreshing stats files: %v", err)
+			return
+		}
+		if setFiles(newStatsFiles) {
+			fmt.Printf("Refreshed %d stats files\n", len(statsFiles))
 		}
-		if len(newStatsFiles) == 0 {
-			log.Println("No JSON stats files found in stats/ directory")
+	})
+
+	// Admin endpoint running the stats script and reloading immediately;
+	// ?script=false only reloads the stats files
+	mux.HandleFunc("/api/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
-		statsFiles = newStatsFiles
-		fmt.Printf("Refreshed %d stats files\n", len(statsFiles))
-		// Update server data
-		serverData.Files = statsFiles
+		if !requireAdmin(w, r, cfg.APIKey, cfg.ReadOnly) {
+			return
+		}
+
+		script := true
+		if scriptParam := r.URL.Query().Get("script"); scriptParam != "" {
+			var err error
+			if script, err = strconv.ParseBool(scriptParam); err != nil {
+				http.Error(w, "Invalid script parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		fileCount, err := refresh(script)
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			log.Printf("Refresh failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			newJSONEncoder(w, r).Encode(map[string]interface{}{"success": false, "error": err.Error()})
+			return
+		}
+		newJSONEncoder(w, r).Encode(map[string]interface{}{"success": true, "files_loaded": fileCount})
+	})
+
+	// Prometheus endpoint with the newest file's container metrics. It
+	// ignores the default range, as scrapers only want the current values.
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		files := serverData.Snapshot()
+		var latest StatsFile
+		if len(files) > 0 {
+			// Under -low-memory a file that can no longer be read is dropped,
+			// leaving only its timestamp
+			latest = files[0]
+			if loaded := withStats(files[:1], cfg.Load); len(loaded) > 0 {
+				latest = loaded[0]
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := writePrometheusMetrics(w, latest, len(files)); err != nil {
+			log.Printf("Error writing metrics: %v", err)
+		}
+	})
+
+	// Health endpoint reporting whether data is loaded and how an empty
+	// refresh was handled
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		serverData.mu.RLock()
+		status := "ok"
+		code := http.StatusOK
+		switch {
+		case len(serverData.Files) == 0:
+			status = "empty"
+			code = http.StatusServiceUnavailable
+		case serverData.LoadFailed != "":
+			// The last refresh was rejected under -strict-files
+			status = "failed"
+			code = http.StatusServiceUnavailable
+		case serverData.RefreshTimeouts >= maxRefreshTimeouts:
+			// run.sh keeps hanging, so no new data is coming in
+			status = "refresh_timeout"
+			code = http.StatusServiceUnavailable
+		case serverData.RefreshEmpty:
+			// The last refresh found nothing and the previous data was kept
+			status = "stale"
+		}
+		health := map[string]interface{}{
+			"status":           status,
+			"files_loaded":     len(serverData.Files),
+			"on_empty":         cfg.OnEmpty,
+			"load_error":       serverData.LoadFailed,
+			"refresh_timeouts": serverData.RefreshTimeouts,
+			"last_refresh":     serverData.LastRefresh.Format(time.RFC3339),
+		}
+		serverData.mu.RUnlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		newJSONEncoder(w, r).Encode(health)
 	})
 
-	port := "8080"
-	fmt.Printf("Starting server on http://localhost:%s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	return &Server{mux: mux, data: serverData, refresh: refresh, setFiles: setFiles}, nil
 }
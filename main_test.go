@@ -0,0 +1,2965 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStart is the timestamp of the first stats file written by the tests
+var testStart = time.Date(2025, 8, 5, 10, 0, 0, 0, time.UTC)
+
+// stat builds a container line with the given CPU and memory percentages
+func stat(id, name, cpu, mem string) DockerStat {
+	return DockerStat{
+		BlockIO:   "1MB / 2MB",
+		CPUPerc:   cpu + "%",
+		Container: id,
+		ID:        id,
+		MemPerc:   mem + "%",
+		MemUsage:  "100MiB / 1GiB",
+		Name:      name,
+		NetIO:     "1kB / 2kB",
+		PIDs:      "5",
+	}
+}
+
+// writeStatsFile writes stats as a JSON lines file named after ts into dir,
+// last modified at ts like a file written by the collector
+func writeStatsFile(t *testing.T, dir string, ts time.Time, stats ...DockerStat) string {
+	t.Helper()
+	name := ts.UTC().Format("2006-01-02_15-04-05") + "_docker_stats.json"
+	writeNamedStatsFile(t, dir, name, stats...)
+	if err := os.Chtimes(filepath.Join(dir, name), ts, ts); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// writeNamedStatsFile writes stats as a JSON lines file called name into dir
+func writeNamedStatsFile(t *testing.T, dir, name string, stats ...DockerStat) {
+	t.Helper()
+	var b strings.Builder
+	for _, s := range stats {
+		line, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestServer loads the stats files in dir with args on top of the
+// defaults, without sparkline precomputing
+func newTestServer(t *testing.T, dir string, args ...string) *Server {
+	t.Helper()
+	var cfg Config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.registerFlags(fs)
+	defaults := []string{"-dir", dir, "-precompute-workers", "0", "-tz", "UTC", "-file-tz", "UTC"}
+	if err := fs.Parse(append(defaults, args...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	files, loadErrors, err := loadAllStatsFiles(cfg.Dir, cfg.Load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := newServer(cfg, fs, files, loadErrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// get serves a GET request for target and fails the test on an unexpected status
+func get(t *testing.T, s *Server, target string, wantStatus int) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != wantStatus {
+		t.Fatalf("GET %s: status %d, want %d: %s", target, rec.Code, wantStatus, rec.Body.String())
+	}
+	return rec
+}
+
+// decode unmarshals a JSON response body into v
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("error decoding %q: %v", rec.Body.String(), err)
+	}
+}
+
+func TestContainerAPI(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "30", "40"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "12", "22"))
+
+	s := newTestServer(t, dir)
+	// The dashboard shows the newest file unless another one is selected
+	if body := get(t, s, "/", http.StatusOK).Body.String(); !strings.Contains(body, "web") || strings.Contains(body, "bbb222") {
+		t.Errorf("newest file not shown: %s", body)
+	}
+	if body := get(t, s, "/?file=1", http.StatusOK).Body.String(); !strings.Contains(body, "bbb222") {
+		t.Errorf("older file does not list db: %s", body)
+	}
+
+	var comparison ContainerComparison
+	decode(t, get(t, s, "/api/container/aaa111", http.StatusOK), &comparison)
+	if comparison.ContainerName != "web" || len(comparison.Data) != 2 {
+		t.Errorf("got %s with %d data points, want web with 2", comparison.ContainerName, len(comparison.Data))
+	}
+	get(t, s, "/api/container/", http.StatusBadRequest)
+}
+
+func TestCustomTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+
+	templatesDir := t.TempDir()
+	custom := `<p>custom dashboard: {{len .SelectedFile.Stats}} containers</p>`
+	if err := os.WriteFile(filepath.Join(templatesDir, "index.html"), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, dir, "-templates-dir", templatesDir)
+	body := get(t, s, "/", http.StatusOK).Body.String()
+	if !strings.Contains(body, "custom dashboard: 1 containers") {
+		t.Errorf("custom template not rendered, got %q", body)
+	}
+
+	if err := os.WriteFile(filepath.Join(templatesDir, "index.html"), []byte(`{{.SelectedFile.Stats`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTemplateStore(templatesDir); err == nil {
+		t.Error("expected an error for a broken template")
+	}
+}
+
+func TestSummaryLastSeenStale(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"), stat("bbb222", "gone", "5", "10"))
+	writeStatsFile(t, dir, testStart.Add(20*time.Minute), stat("aaa111", "web", "12", "20"))
+
+	s := newTestServer(t, dir)
+	body := get(t, s, "/summary", http.StatusOK).Body.String()
+	if !strings.Contains(body, `<td class="seen-stale">`) {
+		t.Error("expected the container last seen 20m before the newest file to get the stale class")
+	}
+	if !strings.Contains(body, `<td class="seen-current">`) {
+		t.Error("expected the container in the newest file to get the current class")
+	}
+
+	if got := recencyClass(testStart, testStart.Add(2*time.Hour), 15*time.Minute, time.Hour); got != "seen-old" {
+		t.Errorf("recencyClass for a 2h old last seen = %q, want seen-old", got)
+	}
+}
+
+func TestOverviewAPI(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "90", "10"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute),
+		stat("aaa111", "web", "95", "10"),
+		stat("bbb222", "db", "60", "20"),
+		stat("ccc333", "cache", "5", "30"))
+
+	s := newTestServer(t, dir)
+	var overview Overview
+	decode(t, get(t, s, "/api/overview", http.StatusOK), &overview)
+
+	if overview.TotalContainers != 3 {
+		t.Errorf("total_containers = %d, want 3", overview.TotalContainers)
+	}
+	if overview.TotalCPU != 160 || overview.TotalMem != 60 {
+		t.Errorf("totals = %v CPU, %v mem, want 160 and 60", overview.TotalCPU, overview.TotalMem)
+	}
+	if overview.WarnCount != 1 || overview.CritCount != 1 {
+		t.Errorf("warn/crit counts = %d/%d, want 1/1", overview.WarnCount, overview.CritCount)
+	}
+	if want := testStart.Add(time.Minute).Format(time.RFC3339); overview.NewestTimestamp != want {
+		t.Errorf("newest_timestamp = %q, want %q", overview.NewestTimestamp, want)
+	}
+	if overview.Hottest == nil || overview.Hottest.ContainerID != "aaa111" || overview.Hottest.CPUPerc != 95 {
+		t.Errorf("hottest_container = %+v, want aaa111 at 95%%", overview.Hottest)
+	}
+}
+
+func TestAPITimestampsRFC3339(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "12", "20"))
+	s := newTestServer(t, dir)
+
+	var comparison ContainerComparison
+	decode(t, get(t, s, "/api/container/aaa111", http.StatusOK), &comparison)
+	if len(comparison.Data) != 2 {
+		t.Fatalf("got %d data points, want 2", len(comparison.Data))
+	}
+	for _, point := range comparison.Data {
+		if _, err := time.Parse(time.RFC3339, point.Timestamp); err != nil {
+			t.Errorf("data point timestamp: %v", err)
+		}
+	}
+
+	decode(t, get(t, s, "/api/container/aaa111?ts=human", http.StatusOK), &comparison)
+	if want := "2025-08-05 10:00:00 UTC"; comparison.Data[0].Timestamp != want {
+		t.Errorf("human timestamp = %q, want %q", comparison.Data[0].Timestamp, want)
+	}
+	get(t, s, "/api/container/aaa111?ts=unix", http.StatusBadRequest)
+}
+
+// summaryByID returns the summary of the container with the given ID
+func summaryByID(t *testing.T, summaries []ContainerSummary, id string) ContainerSummary {
+	t.Helper()
+	for _, summary := range summaries {
+		if summary.ContainerID == id {
+			return summary
+		}
+	}
+	t.Fatalf("no summary for container %s", id)
+	return ContainerSummary{}
+}
+
+func TestAlwaysBusy(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "worker", "20", "10"), stat("bbb222", "web", "2", "10"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "worker", "30", "10"), stat("bbb222", "web", "50", "10"))
+	s := newTestServer(t, dir, "-busy-floor", "5")
+
+	body := get(t, s, "/summary", http.StatusOK).Body.String()
+	if !regexp.MustCompile(`data-always-busy="true"[^>]*>\s*<td>worker`).MatchString(body) {
+		t.Error("container with min CPU 20% above a 5% floor should be always busy")
+	}
+	if !regexp.MustCompile(`data-always-busy="false"[^>]*>\s*<td>web`).MatchString(body) {
+		t.Error("container that dropped to 2% should not be always busy")
+	}
+}
+
+// exportRecords decodes an NDJSON export body
+func exportRecords(t *testing.T, body string) []ExportRecord {
+	t.Helper()
+	var records []ExportRecord
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if line == "" {
+			continue
+		}
+		var record ExportRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("error decoding export line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestExportFilters(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 3; i++ {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "5", "10"))
+	}
+	s := newTestServer(t, dir)
+
+	from := testStart.Add(time.Minute).Format(time.RFC3339)
+	rec := get(t, s, "/api/export?name=WEB&from="+from, http.StatusOK)
+	records := exportRecords(t, rec.Body.String())
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %s", len(records), rec.Body.String())
+	}
+	for i, record := range records {
+		if record.Name != "web" {
+			t.Errorf("record %d is for %q, want only web", i, record.Name)
+		}
+		if want := testStart.Add(time.Duration(i+1) * time.Minute).Format(time.RFC3339); record.Timestamp != want {
+			t.Errorf("record %d timestamp = %s, want %s", i, record.Timestamp, want)
+		}
+	}
+
+	if all := exportRecords(t, get(t, s, "/api/export", http.StatusOK).Body.String()); len(all) != 6 {
+		t.Errorf("unfiltered export has %d records, want 6", len(all))
+	}
+	get(t, s, "/api/export?from=yesterday", http.StatusBadRequest)
+}
+
+// post serves a POST request for target with an optional API key
+func post(t *testing.T, s *Server, target, apiKey string, wantStatus int) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, nil)
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != wantStatus {
+		t.Fatalf("POST %s: status %d, want %d: %s", target, rec.Code, wantStatus, rec.Body.String())
+	}
+	return rec
+}
+
+// stubRunScript runs the test in a directory whose run.sh does nothing, so
+// refreshes do not call docker
+func stubRunScript(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "run.sh"), []byte("exit 0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+}
+
+func TestRefreshEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir, "-api-key", "secret")
+
+	stubRunScript(t)
+
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "12", "20"))
+	post(t, s, "/api/refresh", "", http.StatusUnauthorized)
+	var result struct {
+		Success     bool `json:"success"`
+		FilesLoaded int  `json:"files_loaded"`
+	}
+	decode(t, post(t, s, "/api/refresh", "secret", http.StatusOK), &result)
+	if !result.Success || result.FilesLoaded != 2 {
+		t.Errorf("refresh = %+v, want success with 2 files loaded", result)
+	}
+	var comparison ContainerComparison
+	decode(t, get(t, s, "/api/container/aaa111", http.StatusOK), &comparison)
+	if len(comparison.Data) != 2 {
+		t.Errorf("got %d data points after refresh, want 2", len(comparison.Data))
+	}
+
+	post(t, s, "/api/run-script", "", http.StatusUnauthorized)
+	readOnly := newTestServer(t, dir, "-read-only")
+	post(t, readOnly, "/api/refresh", "", http.StatusForbidden)
+	post(t, readOnly, "/api/run-script", "", http.StatusForbidden)
+}
+
+func TestThresholdsInPage(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir, "-cpu-warn", "42", "-mem-crit", "95")
+
+	body := get(t, s, "/", http.StatusOK).Body.String()
+	want := `const thresholds = {"cpu":{"warn":42,"crit":80},"mem":{"warn":50,"crit":95}};`
+	if !strings.Contains(body, want) {
+		t.Errorf("page does not embed the configured thresholds as %s", want)
+	}
+
+	// Peak cells in the summary follow the same thresholds
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "50", "20"))
+	s = newTestServer(t, dir, "-cpu-warn", "42", "-cpu-crit", "45")
+	if body := get(t, s, "/summary", http.StatusOK).Body.String(); !strings.Contains(body, `<td class="metric-high" data-value="50">50.00%</td>`) {
+		t.Error("peak CPU of 50% above a 45% -cpu-crit is not highlighted as high")
+	}
+}
+
+func TestAverageStatsFile(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "30"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "20", "50"))
+	files, _, err := loadAllStatsFiles(dir, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	averaged := averageStatsFile(files, 0, 2)
+	if got := averaged.Stats[0]; got.CPUPerc != "15.00%" || got.MemPerc != "40.00%" {
+		t.Errorf("averaged over two snapshots = %s CPU, %s mem, want 15.00%% and 40.00%%", got.CPUPerc, got.MemPerc)
+	}
+	if files[0].Stats[0].CPUPerc != "20%" {
+		t.Errorf("averaging modified the loaded file: %s", files[0].Stats[0].CPUPerc)
+	}
+
+	s := newTestServer(t, dir)
+	body := get(t, s, "/?avg=2", http.StatusOK).Body.String()
+	if !strings.Contains(body, "15.00%") || !strings.Contains(body, "averaged over the last 2 snapshots") {
+		t.Error("dashboard with avg=2 does not show the averaged values")
+	}
+}
+
+func TestDuplicateNames(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"), stat("ddd444", "db", "5", "10"), stat("eee555", "db", "5", "10"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("bbb222", "web", "10", "20"), stat("fff666", "cache", "1", "1"))
+	writeStatsFile(t, dir, testStart.Add(2*time.Minute), stat("ccc333", "web", "10", "20"), stat("bbb222", "web", "10", "20"))
+	s := newTestServer(t, dir)
+
+	var duplicates []DuplicateName
+	decode(t, get(t, s, "/api/duplicates", http.StatusOK), &duplicates)
+	if len(duplicates) != 2 {
+		t.Fatalf("got %d duplicate names, want web and db: %+v", len(duplicates), duplicates)
+	}
+	web := duplicates[0]
+	if web.Name != "web" || len(web.Containers) != 3 {
+		t.Fatalf("first duplicate = %+v, want web with three IDs", web)
+	}
+	for i, id := range []string{"aaa111", "bbb222", "ccc333"} {
+		if web.Containers[i].ContainerID != id {
+			t.Errorf("web container %d = %s, want %s", i, web.Containers[i].ContainerID, id)
+		}
+	}
+	bbb := web.Containers[1]
+	if bbb.FirstSeen != testStart.Add(time.Minute).Format(time.RFC3339) || bbb.LastSeen != testStart.Add(2*time.Minute).Format(time.RFC3339) {
+		t.Errorf("bbb222 seen %s to %s, want the second to the third file", bbb.FirstSeen, bbb.LastSeen)
+	}
+	// Both db IDs first appeared in the same file, so they are ordered by ID
+	db := duplicates[1]
+	if db.Name != "db" || len(db.Containers) != 2 || db.Containers[0].ContainerID != "ddd444" || db.Containers[1].ContainerID != "eee555" {
+		t.Errorf("second duplicate = %+v, want db with ddd444 then eee555", db)
+	}
+}
+
+func TestFileMetricRange(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "45", "70"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute),
+		stat("aaa111", "web", "10", "70"),
+		stat("bbb222", "db", "40", "10"),
+		stat("ccc333", "cache", "55.5", "10"),
+		stat("ddd444", "worker", "60.1", "50"))
+	s := newTestServer(t, dir)
+
+	var result FileRangeResult
+	decode(t, get(t, s, "/api/file/0/range?metric=cpu&min=40&max=60", http.StatusOK), &result)
+	var ids []string
+	for _, stat := range result.Containers {
+		ids = append(ids, stat.ID)
+	}
+	if got := strings.Join(ids, ","); got != "bbb222,ccc333" {
+		t.Errorf("containers between 40%% and 60%% CPU = %s, want bbb222,ccc333", got)
+	}
+
+	decode(t, get(t, s, "/api/file/1/range?metric=mem&min=60&max=80", http.StatusOK), &result)
+	if len(result.Containers) != 1 || result.Containers[0].ID != "aaa111" {
+		t.Errorf("older file memory range = %+v, want only aaa111", result.Containers)
+	}
+
+	get(t, s, "/api/file/0/range?metric=disk&min=0&max=1", http.StatusBadRequest)
+	get(t, s, "/api/file/0/range?min=60&max=40", http.StatusBadRequest)
+	get(t, s, "/api/file/0/range?min=40", http.StatusBadRequest)
+}
+
+func TestSamplingGaps(t *testing.T) {
+	dir := t.TempDir()
+	for _, minute := range []int{0, 1, 2, 10, 11} {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(minute)*time.Minute), stat("aaa111", "web", "10", "20"))
+	}
+	s := newTestServer(t, dir)
+
+	var comparison ContainerComparison
+	decode(t, get(t, s, "/api/container/aaa111", http.StatusOK), &comparison)
+	if len(comparison.Gaps) != 1 {
+		t.Fatalf("got gaps %+v, want one", comparison.Gaps)
+	}
+	gap := comparison.Gaps[0]
+	if gap.Index != 3 || gap.Seconds != 480 || gap.Expected != 60 {
+		t.Errorf("gap = %+v, want index 3, 480s against an expected 60s", gap)
+	}
+	for i, point := range comparison.Data {
+		if point.GapBefore != (i == 3) {
+			t.Errorf("data point %d gap_before = %v", i, point.GapBefore)
+		}
+	}
+
+	var disabled ContainerComparison
+	decode(t, get(t, newTestServer(t, dir, "-gap-factor", "0"), "/api/container/aaa111", http.StatusOK), &disabled)
+	if len(disabled.Gaps) != 0 {
+		t.Errorf("gaps with -gap-factor 0 = %+v, want none", disabled.Gaps)
+	}
+}
+
+func TestStatsOverview(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "30", "40"))
+	writeStatsFile(t, dir, testStart.Add(90*time.Second), stat("aaa111", "web", "20", "30"), stat("ccc333", "cache", "40", "10"))
+	s := newTestServer(t, dir)
+
+	var stats DatasetStats
+	decode(t, get(t, s, "/api/stats-overview", http.StatusOK), &stats)
+	want := DatasetStats{
+		TotalFiles:      2,
+		TotalContainers: 3,
+		TotalDataPoints: 4,
+		AvgCPU:          25,
+		AvgMem:          25,
+		FirstTimestamp:  testStart.Format(time.RFC3339),
+		LastTimestamp:   testStart.Add(90 * time.Second).Format(time.RFC3339),
+		SpanSeconds:     90,
+	}
+	if stats != want {
+		t.Errorf("stats overview = %+v, want %+v", stats, want)
+	}
+}
+
+func TestContainerColor(t *testing.T) {
+	// The dashboard script mirrors containerColor, so the values are pinned
+	for id, want := range map[string]string{"aaa111": "#d442d7", "bbb222": "#42add7"} {
+		for i := 0; i < 2; i++ {
+			if got := containerColor(id); got != want {
+				t.Errorf("containerColor(%q) = %s, want %s", id, got, want)
+			}
+		}
+	}
+
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir)
+	if body := get(t, s, "/?accent=1", http.StatusOK).Body.String(); !strings.Contains(body, "border-left: 6px solid #d442d7") {
+		t.Error("dashboard with accent=1 does not use the container color")
+	}
+}
+
+func TestOnEmpty(t *testing.T) {
+	for _, tc := range []struct {
+		onEmpty       string
+		refreshStatus int
+		healthStatus  int
+		status        string
+		filesLoaded   int
+	}{
+		{"keep", http.StatusInternalServerError, http.StatusOK, "stale", 1},
+		{"clear", http.StatusOK, http.StatusServiceUnavailable, "empty", 0},
+	} {
+		t.Run(tc.onEmpty, func(t *testing.T) {
+			dir := t.TempDir()
+			name := writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+			s := newTestServer(t, dir, "-on-empty", tc.onEmpty)
+			stubRunScript(t)
+
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				t.Fatal(err)
+			}
+			post(t, s, "/api/refresh", "", tc.refreshStatus)
+
+			var health struct {
+				Status      string `json:"status"`
+				FilesLoaded int    `json:"files_loaded"`
+				OnEmpty     string `json:"on_empty"`
+			}
+			decode(t, get(t, s, "/healthz", tc.healthStatus), &health)
+			if health.Status != tc.status || health.FilesLoaded != tc.filesLoaded || health.OnEmpty != tc.onEmpty {
+				t.Errorf("healthz = %+v, want status %s with %d files", health, tc.status, tc.filesLoaded)
+			}
+			// The dashboard keeps rendering either way
+			get(t, s, "/", http.StatusOK)
+		})
+	}
+}
+
+// writeCPUSeries writes one stats file per minute from testStart with the
+// given CPU percentages of a single container
+func writeCPUSeries(t *testing.T, dir, id string, cpus ...string) {
+	t.Helper()
+	for i, cpu := range cpus {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), stat(id, "web", cpu, "20"))
+	}
+}
+
+// loadFiles loads the stats files in dir, newest first
+func loadFiles(t *testing.T, dir string) []StatsFile {
+	t.Helper()
+	files, _, err := loadAllStatsFiles(dir, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// loadSummaries loads the stats files in dir and summarizes their containers
+func loadSummaries(t *testing.T, dir string, options StatsOptions) []ContainerSummary {
+	t.Helper()
+	return getAllContainerSummaries(loadFiles(t, dir), options)
+}
+
+func TestSummaryTrend(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "12", "11", "40", "45", "42")
+
+	summary := summaryByID(t, loadSummaries(t, dir, StatsOptions{}), "aaa111")
+	if summary.CPUTrend != TrendUp {
+		t.Errorf("CPU trend = %s, want up", summary.CPUTrend)
+	}
+	if summary.MemTrend != TrendFlat {
+		t.Errorf("memory trend = %s, want flat", summary.MemTrend)
+	}
+
+	if got := computeTrend([]float64{10, 50, 90}); got != TrendFlat {
+		t.Errorf("trend of a three point series = %s, want flat", got)
+	}
+}
+
+func TestHeatmapAPI(t *testing.T) {
+	dir := t.TempDir()
+	// testStart is a Tuesday at 10:00
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "30", "40"))
+	writeStatsFile(t, dir, testStart.Add(30*time.Minute), stat("aaa111", "web", "20", "30"))
+	writeStatsFile(t, dir, testStart.Add(4*time.Hour), stat("aaa111", "web", "50", "50"))
+	writeStatsFile(t, dir, testStart.Add(24*time.Hour), stat("aaa111", "web", "40", "10"))
+	s := newTestServer(t, dir)
+
+	var cells []HeatmapCell
+	decode(t, get(t, s, "/api/heatmap", http.StatusOK), &cells)
+	if len(cells) != 2 {
+		t.Fatalf("got %d hourly cells, want 2: %+v", len(cells), cells)
+	}
+	if c := cells[0]; c.Day != nil || c.Hour != 10 || c.Samples != 4 || c.AvgCPU != 25 || c.AvgMem != 25 {
+		t.Errorf("10:00 cell = %+v, want 4 samples averaging 25%% CPU and memory", c)
+	}
+	if c := cells[1]; c.Hour != 14 || c.Samples != 1 || c.AvgCPU != 50 {
+		t.Errorf("14:00 cell = %+v, want 1 sample at 50%% CPU", c)
+	}
+
+	decode(t, get(t, s, "/api/heatmap?by=day", http.StatusOK), &cells)
+	want := []struct{ day, hour, samples int }{{2, 10, 3}, {2, 14, 1}, {3, 10, 1}}
+	if len(cells) != len(want) {
+		t.Fatalf("got %d daily cells, want %d: %+v", len(cells), len(want), cells)
+	}
+	for i, w := range want {
+		c := cells[i]
+		if c.Day == nil || *c.Day != w.day || c.Hour != w.hour || c.Samples != w.samples {
+			t.Errorf("cell %d = %+v, want day %d hour %d with %d samples", i, c, w.day, w.hour, w.samples)
+		}
+	}
+	get(t, s, "/api/heatmap?by=week", http.StatusBadRequest)
+}
+
+func TestExportMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 3; i++ {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), stat("aaa111", "web", "10", "20"))
+	}
+	full := get(t, newTestServer(t, dir), "/api/export", http.StatusOK).Body.String()
+	lineLength := strings.Index(full, "\n") + 1
+
+	// Room for two and a half records
+	limit := lineLength*5/2 + 1
+	s := newTestServer(t, dir, "-max-export-bytes", strconv.Itoa(limit))
+	rec := get(t, s, "/api/export", http.StatusOK)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want two records and the marker:\n%s", len(lines), rec.Body.String())
+	}
+	var marker ExportTruncation
+	if err := json.Unmarshal([]byte(lines[2]), &marker); err != nil || !marker.Truncated || marker.MaxBytes != int64(limit) {
+		t.Errorf("last line = %s, want a truncation marker", lines[2])
+	}
+
+	result := rec.Result()
+	if got := result.Header.Get("X-Export-Max-Bytes"); got != strconv.Itoa(limit) {
+		t.Errorf("X-Export-Max-Bytes = %q, want %d", got, limit)
+	}
+	if got := result.Trailer.Get("X-Export-Truncated"); got != "true" {
+		t.Errorf("X-Export-Truncated trailer = %q, want true", got)
+	}
+
+	if rec := get(t, newTestServer(t, dir, "-max-export-bytes", strconv.Itoa(len(full))), "/api/export", http.StatusOK); rec.Result().Trailer.Get("X-Export-Truncated") != "false" || rec.Body.String() != full {
+		t.Error("export within the limit should be complete and not marked truncated")
+	}
+}
+
+func TestRecentChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "50", "20"), stat("ccc333", "cache", "30", "20"))
+	s := newTestServer(t, dir)
+
+	var changes []ContainerChange
+	decode(t, get(t, s, "/api/recent", http.StatusOK), &changes)
+	if len(changes) != 0 {
+		t.Errorf("changes with a single file = %+v, want none", changes)
+	}
+
+	writeStatsFile(t, dir, testStart.Add(time.Minute),
+		stat("aaa111", "web", "15", "20"), stat("bbb222", "db", "20", "20"), stat("ccc333", "cache", "40", "20"), stat("ddd444", "new", "90", "20"))
+	s = newTestServer(t, dir)
+	decode(t, get(t, s, "/api/recent?n=2", http.StatusOK), &changes)
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2", len(changes))
+	}
+	if c := changes[0]; c.ContainerID != "bbb222" || c.OldCPU != 50 || c.NewCPU != 20 || c.DeltaCPU != -30 {
+		t.Errorf("largest change = %+v, want bbb222 from 50%% to 20%%", c)
+	}
+	if c := changes[1]; c.ContainerID != "ccc333" || c.DeltaCPU != 10 {
+		t.Errorf("second change = %+v, want ccc333 up 10", c)
+	}
+	get(t, s, "/api/recent?n=0", http.StatusBadRequest)
+}
+
+func TestColumnsFlag(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	blockIOHeader := `<th onclick="sortTable(this.cellIndex)">Block I/O</th>`
+
+	body := get(t, newTestServer(t, dir), "/", http.StatusOK).Body.String()
+	if !strings.Contains(body, blockIOHeader) || !strings.Contains(body, "<td>1MB / 2MB</td>") {
+		t.Fatal("dashboard should show the Block I/O column by default")
+	}
+	if body := get(t, newTestServer(t, dir), "/container/aaa111", http.StatusOK).Body.String(); !strings.Contains(body, "<th>PIDs</th>") {
+		t.Fatal("container page should show the PIDs column by default")
+	}
+
+	s := newTestServer(t, dir, "-columns", "cpu,mem,bogus")
+	body = get(t, s, "/", http.StatusOK).Body.String()
+	if strings.Contains(body, blockIOHeader) || strings.Contains(body, "<td>1MB / 2MB</td>") {
+		t.Error("dashboard shows the Block I/O column although -columns omits it")
+	}
+	if !strings.Contains(body, "<td>10%</td>") {
+		t.Error("dashboard lost the CPU column listed in -columns")
+	}
+	if body := get(t, s, "/container/aaa111", http.StatusOK).Body.String(); strings.Contains(body, "<th>PIDs</th>") {
+		t.Error("container page shows the PIDs column although -columns omits it")
+	}
+}
+
+func TestSkipFirst(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "90", "10", "20")
+	writeStatsFile(t, dir, testStart.Add(time.Hour), stat("bbb222", "once", "70", "20"))
+
+	if summary := summaryByID(t, loadSummaries(t, dir, StatsOptions{}), "aaa111"); summary.AvgCPU != 40 || summary.MaxCPU != 90 || summary.DataPoints != 3 {
+		t.Errorf("with the first point: %+v, want 3 points averaging 40%% with a 90%% peak", summary)
+	}
+
+	summaries := loadSummaries(t, dir, StatsOptions{SkipFirst: true})
+	if summary := summaryByID(t, summaries, "aaa111"); summary.AvgCPU != 15 || summary.MaxCPU != 20 || summary.MinCPU != 10 {
+		t.Errorf("without the first point: %+v, want an average of 15%% with a 20%% peak", summary)
+	}
+	if summary := summaryByID(t, summaries, "bbb222"); summary.AvgCPU != 70 || summary.DataPoints != 1 {
+		t.Errorf("single point series: %+v, want its only point kept", summary)
+	}
+
+	// The raw history still has every point
+	s := newTestServer(t, dir, "-skip-first")
+	var comparison ContainerComparison
+	decode(t, get(t, s, "/api/container/aaa111", http.StatusOK), &comparison)
+	if len(comparison.Data) != 3 {
+		t.Errorf("history has %d points with -skip-first, want 3", len(comparison.Data))
+	}
+}
+
+func TestConfigAPI(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir, "-cpu-crit", "91.5", "-api-key", "hunter2")
+
+	var config map[string]string
+	rec := get(t, s, "/api/config", http.StatusOK)
+	decode(t, rec, &config)
+	if config["cpu-crit"] != "91.5" {
+		t.Errorf("cpu-crit = %q, want 91.5", config["cpu-crit"])
+	}
+	if config["mem-crit"] != "80" {
+		t.Errorf("default mem-crit = %q, want 80", config["mem-crit"])
+	}
+	if config["api-key"] != "********" || strings.Contains(rec.Body.String(), "hunter2") {
+		t.Errorf("api-key is not masked: %q", config["api-key"])
+	}
+}
+
+func TestAboveBaseline(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		// Fleet average CPU is 17.5%, so 50% is well above twice that
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute),
+			stat("aaa111", "hot", "50", "20"), stat("bbb222", "db", "5", "20"), stat("ccc333", "cache", "5", "20"), stat("ddd444", "web", "10", "20"))
+	}
+	s := newTestServer(t, dir, "-baseline-factor", "2")
+
+	body := get(t, s, "/summary", http.StatusOK).Body.String()
+	if n := strings.Count(body, `data-above-baseline="true"`); n != 1 {
+		t.Errorf("%d containers above baseline, want only hot", n)
+	}
+	if !regexp.MustCompile(`data-above-baseline="true"[^>]*>\s*<td>hot`).MatchString(body) {
+		t.Error("hot container at 50% CPU is not above baseline")
+	}
+
+	// A higher factor moves the bar above the hot container
+	body = get(t, newTestServer(t, dir, "-baseline-factor", "3"), "/summary", http.StatusOK).Body.String()
+	if strings.Contains(body, `data-above-baseline="true"`) {
+		t.Error("50% CPU should not be above 3x a 17.5% fleet average")
+	}
+}
+
+func TestRollingP95(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "20", "30", "40", "50", "60")
+	s := newTestServer(t, dir)
+
+	var series RollingSeries
+	decode(t, get(t, s, "/api/container/aaa111/rolling-p95?window=3", http.StatusOK), &series)
+	// The first points use the shorter history available
+	want := []float64{10, 19.5, 29, 39, 49, 59}
+	if len(series.Points) != len(want) || series.Window != 3 || series.Metric != "cpu" {
+		t.Fatalf("rolling series = %+v, want %d cpu points over a window of 3", series, len(want))
+	}
+	for i, point := range series.Points {
+		if math.Abs(point.Value-want[i]) > 1e-9 {
+			t.Errorf("point %d = %v, want %v", i, point.Value, want[i])
+		}
+		if i > 0 && point.Value <= series.Points[i-1].Value {
+			t.Errorf("rolling p95 did not rise at point %d", i)
+		}
+	}
+	if series.Points[5].Timestamp != testStart.Add(5*time.Minute).Format(time.RFC3339) {
+		t.Errorf("last point timestamp = %s", series.Points[5].Timestamp)
+	}
+
+	get(t, s, "/api/container/aaa111/rolling-p95?window=0", http.StatusBadRequest)
+	get(t, s, "/api/container/zzz999/rolling-p95", http.StatusNotFound)
+}
+
+func TestMergeSameTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	writeNamedStatsFile(t, dir, "2025-08-05_10-00-00_host-a_docker_stats.json", stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "20", "20"))
+	writeNamedStatsFile(t, dir, "2025-08-05_10-00-00_host-b_docker_stats.json", stat("ccc333", "web", "30", "20"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "10", "20"))
+
+	if files, _, err := loadAllStatsFiles(dir, LoadOptions{}); err != nil || len(files) != 3 {
+		t.Fatalf("got %d files without merging, want 3 (%v)", len(files), err)
+	}
+
+	files, _, err := loadAllStatsFiles(dir, LoadOptions{MergeSameTimestamp: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files after merging, want 2", len(files))
+	}
+	merged := files[1]
+	if len(merged.Stats) != 3 {
+		t.Errorf("merged snapshot has %d containers, want 3", len(merged.Stats))
+	}
+	sources := map[string]string{}
+	for _, stat := range merged.Stats {
+		sources[stat.ID] = stat.Source
+	}
+	if sources["bbb222"] != "2025-08-05_10-00-00_host-a_docker_stats.json" || sources["ccc333"] != "2025-08-05_10-00-00_host-b_docker_stats.json" {
+		t.Errorf("container sources = %v, want the file each came from", sources)
+	}
+
+	s := newTestServer(t, dir, "-merge-same-timestamp")
+	var stats DatasetStats
+	decode(t, get(t, s, "/api/stats-overview", http.StatusOK), &stats)
+	if stats.TotalFiles != 2 || stats.TotalDataPoints != 4 {
+		t.Errorf("stats overview = %+v, want 2 files with 4 data points", stats)
+	}
+}
+
+func TestShortIDModes(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("abc111", "old", "10", "20"), stat("abc222", "new", "30", "20"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("abc222", "new", "40", "20"))
+
+	var conflict struct {
+		Error      string        `json:"error"`
+		Candidates []IDCandidate `json:"candidates"`
+	}
+	decode(t, get(t, newTestServer(t, dir), "/api/container/abc", http.StatusConflict), &conflict)
+	if len(conflict.Candidates) != 2 || conflict.Candidates[0].ContainerID != "abc222" || conflict.Candidates[1].ContainerID != "abc111" {
+		t.Errorf("strict mode candidates = %+v, want abc222 and abc111, latest first", conflict.Candidates)
+	}
+
+	s := newTestServer(t, dir, "-short-id", "latest")
+	var comparison ContainerComparison
+	decode(t, get(t, s, "/api/container/abc", http.StatusOK), &comparison)
+	if comparison.ContainerID != "abc222" || len(comparison.Data) != 2 {
+		t.Errorf("latest mode resolved to %s with %d points, want abc222 with 2", comparison.ContainerID, len(comparison.Data))
+	}
+
+	// An unambiguous prefix resolves in either mode
+	decode(t, get(t, newTestServer(t, dir), "/api/container/abc1", http.StatusOK), &comparison)
+	if comparison.ContainerID != "abc111" {
+		t.Errorf("unique prefix resolved to %s, want abc111", comparison.ContainerID)
+	}
+}
+
+func TestSummaryIOAcrossReset(t *testing.T) {
+	dir := t.TempDir()
+	// The network counter resets between the second and third sample
+	for i, netIO := range []string{"1kB / 0B", "5kB / 0B", "2kB / 0B", "4kB / 0B"} {
+		s := stat("aaa111", "web", "10", "20")
+		s.NetIO = netIO
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), s)
+	}
+	summary := summaryByID(t, loadSummaries(t, dir, StatsOptions{}), "aaa111")
+	// 4kB up to the reset, then 2kB since it and 2kB more
+	if summary.NetInTotal != 8000 {
+		t.Errorf("net in total = %d, want 8000", summary.NetInTotal)
+	}
+	if want := 8000.0 / 180; math.Abs(summary.NetInRate-want) > 1e-9 {
+		t.Errorf("net in rate = %v, want %v", summary.NetInRate, want)
+	}
+
+	s := newTestServer(t, dir)
+	body := get(t, s, "/summary?io=total", http.StatusOK).Body.String()
+	if !strings.Contains(body, `<td data-value="8000">`) {
+		t.Error("summary page with io=total does not show the total moved")
+	}
+	body = get(t, s, "/summary?io=rate", http.StatusOK).Body.String()
+	if !strings.Contains(body, "Net In/s") || !strings.Contains(body, `<td data-value="44.44`) {
+		t.Error("summary page with io=rate does not show the average rate")
+	}
+}
+
+func TestContainerSummaryAPI(t *testing.T) {
+	dir := t.TempDir()
+	for i, cpu := range []string{"10", "50", "30", "70"} {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute),
+			stat("aaa111", "web", cpu, "20"), stat("bbb222", "db", "2", "40"), stat("ccc333", "cache", "3", "5"))
+	}
+	s := newTestServer(t, dir)
+
+	var summary ContainerSummary
+	decode(t, get(t, s, "/api/container/aaa111/summary", http.StatusOK), &summary)
+	want := summaryByID(t, loadSummaries(t, dir, StatsOptions{}), "aaa111")
+	if summary.DataPoints != want.DataPoints || summary.AvgCPU != want.AvgCPU || summary.MaxCPU != want.MaxCPU ||
+		summary.MinCPU != want.MinCPU || summary.CPUTrend != want.CPUTrend {
+		t.Errorf("single summary row:\n%+v\nwant the summary list entry:\n%+v", summary, want)
+	}
+	// The badges of the summary page are computed too
+	if !summary.AboveBaseline {
+		t.Errorf("single summary row lacks the computed fields: %+v", summary)
+	}
+
+	get(t, s, "/api/container/zzz999/summary", http.StatusNotFound)
+}
+
+func TestMemoryBar(t *testing.T) {
+	dir := t.TempDir()
+	quarter := stat("aaa111", "web", "10", "25")
+	quarter.MemUsage = "512MiB / 2GiB"
+	full := stat("bbb222", "db", "10", "90")
+	full.MemUsage = "1.8GiB / 2GiB"
+	unlimited := stat("ccc333", "cache", "10", "7.5")
+	unlimited.MemUsage = "N/A"
+	writeStatsFile(t, dir, testStart, quarter, full, unlimited)
+	s := newTestServer(t, dir)
+
+	body := get(t, s, "/", http.StatusOK).Body.String()
+	if !strings.Contains(body, `<span class="mem-bar-fill " style="width: 25.0%"></span></span>512MiB / 2GiB`) {
+		t.Error("dashboard bar for 512MiB of 2GiB is not a quarter wide")
+	}
+	if !strings.Contains(body, `<span class="mem-bar-fill bar-high" style="width: 90.0%"></span></span>1.8GiB / 2GiB`) {
+		t.Error("dashboard bar for 1.8GiB of 2GiB is not 90% wide and colored high")
+	}
+	if !strings.Contains(body, "<td>7.5%</td>") {
+		t.Error("dashboard does not fall back to the percentage without a memory limit")
+	}
+
+	body = get(t, s, "/container/aaa111", http.StatusOK).Body.String()
+	if !strings.Contains(body, `style="width: 25.0%"`) {
+		t.Error("container page bar for 512MiB of 2GiB is not a quarter wide")
+	}
+}
+
+func TestSummaryTieOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart,
+		stat("fff666", "zeta", "20", "20"),
+		stat("ccc333", "beta", "20", "20"),
+		stat("eee555", "alpha", "20", "20"),
+		stat("aaa111", "beta", "20", "20"),
+		stat("ddd444", "hot", "50", "20"))
+
+	for run := 0; run < 5; run++ {
+		var order []string
+		for _, summary := range loadSummaries(t, dir, StatsOptions{}) {
+			order = append(order, summary.ContainerName+"/"+summary.ContainerID)
+		}
+		if got, want := strings.Join(order, " "), "hot/ddd444 alpha/eee555 beta/aaa111 beta/ccc333 zeta/fff666"; got != want {
+			t.Fatalf("summary order = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir)
+
+	line, _ := json.Marshal(stat("bbb222", "db", "5", "10"))
+	body := string(line) + "\n\n" + string(line) + "\n{\"ID\": \"broken\"\n" + string(line) + "\n"
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/validate", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result ValidationResult
+	decode(t, rec, &result)
+	if result.Parsed != 3 {
+		t.Errorf("parsed = %d, want 3", result.Parsed)
+	}
+	// The blank line still counts towards the line numbers
+	if len(result.Failed) != 1 || result.Failed[0].Line != 4 || result.Failed[0].Error == "" {
+		t.Errorf("failed = %+v, want line 4 with a reason", result.Failed)
+	}
+	if result.Sample == nil || result.Sample.ID != "bbb222" {
+		t.Errorf("sample = %+v, want the first parsed record", result.Sample)
+	}
+
+	// Nothing was persisted
+	var overview Overview
+	decode(t, get(t, s, "/api/overview", http.StatusOK), &overview)
+	if overview.TotalContainers != 1 {
+		t.Errorf("validating changed the loaded stats to %d containers", overview.TotalContainers)
+	}
+	get(t, s, "/api/validate", http.StatusMethodNotAllowed)
+}
+
+func TestSLOCompliance(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "20", "80", "30", "95", "40", "50", "60", "70", "79")
+	s := newTestServer(t, dir)
+
+	var slo SLOCompliance
+	decode(t, get(t, s, "/api/container/aaa111/slo?metric=cpu&threshold=80", http.StatusOK), &slo)
+	if slo.DataPoints != 10 || slo.Compliant != 9 || slo.Compliance != 90 || slo.Objective != "below" {
+		t.Errorf("slo = %+v, want 9 of 10 points below 80%% for 90%%", slo)
+	}
+
+	decode(t, get(t, s, "/api/container/aaa111/slo?threshold=80&objective=above", http.StatusOK), &slo)
+	if slo.Compliant != 2 || slo.Compliance != 20 {
+		t.Errorf("above slo = %+v, want 2 of 10 points at or above 80%%", slo)
+	}
+
+	get(t, s, "/api/container/aaa111/slo", http.StatusBadRequest)
+	get(t, s, "/api/container/aaa111/slo?threshold=80&objective=near", http.StatusBadRequest)
+}
+
+func TestFocusHottest(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "85", "20"), stat("ccc333", "cache", "30", "20"))
+	hottestRow := regexp.MustCompile(`<tr class="([^"]*)" id="hottest"`)
+
+	if body := get(t, newTestServer(t, dir), "/", http.StatusOK).Body.String(); hottestRow.MatchString(body) {
+		t.Error("hottest row is highlighted although focusing is off by default")
+	}
+
+	s := newTestServer(t, dir, "-focus-hottest")
+	body := get(t, s, "/", http.StatusOK).Body.String()
+	matches := hottestRow.FindAllStringSubmatch(body, -1)
+	if len(matches) != 1 || !strings.Contains(matches[0][1], "hottest") {
+		t.Fatalf("want exactly one row with the hottest class, got %v", matches)
+	}
+	if i := strings.Index(body, `id="hottest"`); !strings.Contains(body[i:i+300], "bbb222") {
+		t.Error("the highlighted row is not the highest-CPU container")
+	}
+
+	if body := get(t, s, "/?focus=0", http.StatusOK).Body.String(); hottestRow.MatchString(body) {
+		t.Error("focus=0 should turn the highlight off")
+	}
+}
+
+func TestExcludeFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	writeNamedStatsFile(t, dir, "2025-08-05_10-01-00_test_docker_stats.json", stat("bbb222", "fake", "99", "99"))
+	writeStatsFile(t, dir, testStart.Add(2*time.Minute), stat("aaa111", "web", "12", "20"))
+
+	files, _, err := loadAllStatsFiles(dir, LoadOptions{ExcludeFiles: "*_test_*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("loaded %d files, want 2", len(files))
+	}
+	for _, statsFile := range files {
+		if strings.Contains(statsFile.Name, "_test_") {
+			t.Errorf("excluded file %s was loaded", statsFile.Name)
+		}
+	}
+
+	s := newTestServer(t, dir, "-exclude-files", "*_test_*")
+	var stats DatasetStats
+	decode(t, get(t, s, "/api/stats-overview", http.StatusOK), &stats)
+	if stats.TotalFiles != 2 || stats.TotalContainers != 1 {
+		t.Errorf("stats overview = %+v, want 2 files of one container", stats)
+	}
+
+	var cfg Config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.registerFlags(fs)
+	fs.Parse([]string{"-exclude-files", "[bad"})
+	if err := cfg.resolve(); err == nil {
+		t.Error("expected an error for a malformed -exclude-files pattern")
+	}
+}
+
+func TestRawValues(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "12.50", "33.3"))
+	s := newTestServer(t, dir)
+
+	var raw struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	decode(t, get(t, s, "/api/container/aaa111?raw=true", http.StatusOK), &raw)
+	point := raw.Data[0]
+	if point["cpu_perc"] != 12.5 || point["cpu_perc_raw"] != "12.50%" {
+		t.Errorf("cpu = %v and %v, want 12.5 and \"12.50%%\"", point["cpu_perc"], point["cpu_perc_raw"])
+	}
+	if point["mem_perc"] != 33.3 || point["mem_perc_raw"] != "33.3%" {
+		t.Errorf("mem = %v and %v, want 33.3 and \"33.3%%\"", point["mem_perc"], point["mem_perc_raw"])
+	}
+
+	var parsed struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	decode(t, get(t, s, "/api/container/aaa111", http.StatusOK), &parsed)
+	if _, ok := parsed.Data[0]["cpu_perc_raw"]; ok {
+		t.Error("raw strings are included without raw=true")
+	}
+	get(t, s, "/api/container/aaa111?raw=maybe", http.StatusBadRequest)
+}
+
+func TestFileOutliers(t *testing.T) {
+	dir := t.TempDir()
+	fleet := func(last string) []DockerStat {
+		return []DockerStat{
+			stat("aaa111", "a", "10", "20"), stat("bbb222", "b", "11", "20"), stat("ccc333", "c", "12", "20"),
+			stat("ddd444", "d", "13", "20"), stat("eee555", "e", "14", "20"), stat("fff666", "f", last, "20"),
+		}
+	}
+	writeStatsFile(t, dir, testStart, stat("aaa111", "a", "10", "20"), stat("bbb222", "b", "90", "20"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), fleet("15")...)
+	writeStatsFile(t, dir, testStart.Add(2*time.Minute), fleet("95")...)
+	s := newTestServer(t, dir)
+
+	var outliers FileOutliers
+	decode(t, get(t, s, "/api/file/0/outliers", http.StatusOK), &outliers)
+	if !outliers.Sufficient || outliers.Count != 1 || len(outliers.Outliers) != 1 || outliers.Outliers[0] != "fff666" {
+		t.Errorf("newest file outliers = %+v, want only fff666", outliers)
+	}
+
+	decode(t, get(t, s, "/api/file/1/outliers", http.StatusOK), &outliers)
+	if !outliers.Sufficient || outliers.Count != 0 {
+		t.Errorf("file without the injected outlier = %+v, want none", outliers)
+	}
+
+	decode(t, get(t, s, "/api/file/2/outliers", http.StatusOK), &outliers)
+	if outliers.Sufficient || outliers.Count != 0 {
+		t.Errorf("two container file = %+v, want it marked too small", outliers)
+	}
+}
+
+func TestContainerOrder(t *testing.T) {
+	dir := t.TempDir()
+	for i, minute := range []int{0, 1, 2, 10} {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(minute)*time.Minute), stat("aaa111", "web", []string{"10", "30", "20", "40"}[i], "20"))
+	}
+	s := newTestServer(t, dir)
+
+	var asc, desc ContainerComparison
+	decode(t, get(t, s, "/api/container/aaa111?order=asc", http.StatusOK), &asc)
+	decode(t, get(t, s, "/api/container/aaa111?order=desc", http.StatusOK), &desc)
+	if len(asc.Data) != 4 || len(desc.Data) != 4 {
+		t.Fatalf("got %d and %d data points, want 4", len(asc.Data), len(desc.Data))
+	}
+	last := len(asc.Data) - 1
+	for i := range asc.Data {
+		if desc.Data[i] != asc.Data[last-i] {
+			t.Errorf("desc point %d = %+v, want asc point %d", i, desc.Data[i], last-i)
+		}
+	}
+	if len(asc.Gaps) != 1 || len(desc.Gaps) != 1 || desc.Gaps[0].Seconds != asc.Gaps[0].Seconds || !desc.Data[desc.Gaps[0].Index].GapBefore {
+		t.Errorf("gaps = %+v asc, %+v desc, want the same gap at the reversed index", asc.Gaps, desc.Gaps)
+	}
+
+	var ascSummary, descSummary ContainerSummary
+	decode(t, get(t, s, "/api/container/aaa111/summary?order=asc", http.StatusOK), &ascSummary)
+	decode(t, get(t, s, "/api/container/aaa111/summary?order=desc", http.StatusOK), &descSummary)
+	if !reflect.DeepEqual(ascSummary, descSummary) || descSummary.AvgCPU != 25 {
+		t.Errorf("summary depends on the order: %+v vs %+v", ascSummary, descSummary)
+	}
+	get(t, s, "/api/container/aaa111?order=newest", http.StatusBadRequest)
+}
+
+// labeled returns a container line carrying the given docker ps labels
+func labeled(s DockerStat, labels string) DockerStat {
+	s.Labels = labels
+	return s
+}
+
+func TestLabelGroups(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart,
+		labeled(stat("aaa111", "api-1", "10", "20"), "com.docker.compose.service=api,tier=web"),
+		labeled(stat("bbb222", "api-2", "30", "10"), "tier=web,com.docker.compose.service=api"),
+		labeled(stat("ccc333", "db", "5", "50"), "com.docker.compose.service=db"),
+		stat("ddd444", "loose", "1", "1"))
+	s := newTestServer(t, dir)
+
+	var groups []ContainerGroup
+	decode(t, get(t, s, "/api/groups?by=label:com.docker.compose.service", http.StatusOK), &groups)
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups, want api, db and unlabeled: %+v", len(groups), groups)
+	}
+	api := groups[0]
+	sort.Strings(api.Containers)
+	if api.Group != "api" || strings.Join(api.Containers, ",") != "aaa111,bbb222" || api.AvgCPU != 40 || api.MaxCPU != 30 {
+		t.Errorf("api group = %+v, want aaa111 and bbb222 summing to 40%% CPU", api)
+	}
+	if groups[1].Group != "db" || groups[2].Group != "unlabeled" || groups[2].Containers[0] != "ddd444" {
+		t.Errorf("remaining groups = %+v, want db and the unlabeled ddd444", groups[1:])
+	}
+
+	get(t, s, "/api/groups?by=label:", http.StatusBadRequest)
+}
+
+func TestSparklinePNG(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "40", "20", "60")
+	s := newTestServer(t, dir)
+
+	rec := get(t, s, "/api/container/aaa111/sparkline.png?width=80&height=24&metric=mem", http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("content type = %q, want image/png", ct)
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("response is not a valid PNG: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 80 || bounds.Dy() != 24 {
+		t.Errorf("PNG is %dx%d, want 80x24", bounds.Dx(), bounds.Dy())
+	}
+
+	img, err = png.Decode(get(t, s, "/api/container/aaa111/sparkline.png", http.StatusOK).Body)
+	if err != nil {
+		t.Fatalf("default sparkline is not a valid PNG: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 100 || bounds.Dy() != 20 {
+		t.Errorf("default PNG is %dx%d, want 100x20", bounds.Dx(), bounds.Dy())
+	}
+
+	get(t, s, "/api/container/zzz999/sparkline.png", http.StatusNotFound)
+	get(t, s, "/api/container/aaa111/sparkline.png?width=0", http.StatusBadRequest)
+}
+
+func TestRateGaps(t *testing.T) {
+	dir := t.TempDir()
+	for i, minute := range []int{0, 1, 31} {
+		s := stat("aaa111", "web", "10", "20")
+		s.NetIO = []string{"0B / 0B", "6kB / 0B", "18kB / 0B"}[i]
+		writeStatsFile(t, dir, testStart.Add(time.Duration(minute)*time.Minute), s)
+	}
+	s := newTestServer(t, dir, "-rate-gap-after", "10m")
+
+	var rates []IntervalRate
+	decode(t, get(t, s, "/api/container/aaa111/rates", http.StatusOK), &rates)
+	if len(rates) != 2 {
+		t.Fatalf("got %d rates, want 2", len(rates))
+	}
+	if rates[0].Gap || rates[0].NetInRate != 100 {
+		t.Errorf("first interval = %+v, want 100 B/s without a gap", rates[0])
+	}
+	if !rates[1].Gap || rates[1].Seconds != 1800 || rates[1].NetInRate != 12000.0/1800 {
+		t.Errorf("second interval = %+v, want a flagged 30 minute gap", rates[1])
+	}
+
+	decode(t, get(t, newTestServer(t, dir, "-rate-gap-after", "0"), "/api/container/aaa111/rates", http.StatusOK), &rates)
+	if rates[1].Gap {
+		t.Error("-rate-gap-after 0 should not flag gaps")
+	}
+}
+
+func TestLoadErrorsAPI(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	if err := os.WriteFile(filepath.Join(dir, "2025-08-05_10-01-00_docker_stats.json"), []byte("{\"ID\": \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, dir)
+
+	var loadErrors []LoadError
+	decode(t, get(t, s, "/api/load-errors", http.StatusOK), &loadErrors)
+	if len(loadErrors) != 1 {
+		t.Fatalf("got %d load errors, want 1: %+v", len(loadErrors), loadErrors)
+	}
+	if e := loadErrors[0]; e.File != "2025-08-05_10-01-00_docker_stats.json" || e.Error == "" || e.AttemptedAt.IsZero() {
+		t.Errorf("load error = %+v, want the malformed file with a reason and time", e)
+	}
+
+	// A later load with every file parsing clears the list
+	if err := os.Remove(filepath.Join(dir, "2025-08-05_10-01-00_docker_stats.json")); err != nil {
+		t.Fatal(err)
+	}
+	post(t, s, "/api/refresh?script=false", "", http.StatusOK)
+	rec := get(t, s, "/api/load-errors", http.StatusOK)
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Errorf("load errors after a clean load = %s, want []", body)
+	}
+}
+
+func TestMovingMax(t *testing.T) {
+	increasing := []float64{1, 2, 3, 5, 8, 13, 21}
+	result := movingMax(increasing, 3)
+	for i := 1; i < len(result); i++ {
+		if result[i] < result[i-1] {
+			t.Errorf("moving max decreased from %v to %v at %d", result[i-1], result[i], i)
+		}
+		if result[i] != increasing[i] {
+			t.Errorf("moving max at %d = %v, want the latest value %v", i, result[i], increasing[i])
+		}
+	}
+
+	// The peak drops out of the window after window points
+	if got := movingMax([]float64{50, 10, 20, 30}, 2); !reflect.DeepEqual(got, []float64{50, 50, 20, 30}) {
+		t.Errorf("movingMax = %v, want [50 50 20 30]", got)
+	}
+
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "50", "10", "20", "30")
+	var comparison ContainerComparison
+	decode(t, get(t, newTestServer(t, dir), "/api/container/aaa111?window=2", http.StatusOK), &comparison)
+	if !reflect.DeepEqual(comparison.CPUMovingMax, []float64{50, 50, 20, 30}) {
+		t.Errorf("cpu_moving_max = %v, want [50 50 20 30]", comparison.CPUMovingMax)
+	}
+}
+
+func TestStrictFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir, "-strict-files")
+
+	if err := os.WriteFile(filepath.Join(dir, "2025-08-05_10-01-00_docker_stats.json"), []byte("not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, loadErrors, err := loadAllStatsFiles(dir, LoadOptions{StrictFiles: true}); err == nil || len(loadErrors) != 1 {
+		t.Errorf("strict load returned %v with %d load errors, want an error for the malformed file", err, len(loadErrors))
+	}
+	if files, _, err := loadAllStatsFiles(dir, LoadOptions{}); err != nil || len(files) != 1 {
+		t.Errorf("lenient load returned %d files and %v, want the good file", len(files), err)
+	}
+
+	// At runtime the refresh fails and healthz reports it
+	stubRunScript(t)
+	post(t, s, "/api/refresh", "", http.StatusInternalServerError)
+	var health struct {
+		Status    string `json:"status"`
+		LoadError string `json:"load_error"`
+	}
+	decode(t, get(t, s, "/healthz", http.StatusServiceUnavailable), &health)
+	if health.Status != "failed" || health.LoadError == "" {
+		t.Errorf("healthz = %+v, want a failed status with the load error", health)
+	}
+	var stats DatasetStats
+	decode(t, get(t, s, "/api/stats-overview", http.StatusOK), &stats)
+	if stats.TotalFiles != 1 {
+		t.Errorf("server holds %d files after the failed refresh, want the previous 1", stats.TotalFiles)
+	}
+}
+
+func TestCompareAligned(t *testing.T) {
+	dir := t.TempDir()
+	// aaa111 is sampled every minute, bbb222 only every other minute
+	for i := 0; i < 4; i++ {
+		stats := []DockerStat{stat("aaa111", "web", strconv.Itoa(10*(i+1)), "20")}
+		if i%2 == 0 {
+			stats = append(stats, stat("bbb222", "db", "5", "10"))
+		}
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), stats...)
+	}
+	s := newTestServer(t, dir)
+
+	var aligned AlignedComparison
+	decode(t, get(t, s, "/api/compare?a=aaa111&b=bbb222", http.StatusOK), &aligned)
+	if len(aligned.Timestamps) != 4 || len(aligned.Series) != 2 {
+		t.Fatalf("got %d timestamps and %d series, want 4 and 2", len(aligned.Timestamps), len(aligned.Series))
+	}
+	for _, series := range aligned.Series {
+		if len(series.CPU) != len(aligned.Timestamps) {
+			t.Errorf("%s series has %d CPU values, want %d", series.ContainerID, len(series.CPU), len(aligned.Timestamps))
+		}
+	}
+	if db := aligned.Series[1]; db.CPU[0] == nil || *db.CPU[0] != 5 || db.CPU[1] != nil {
+		t.Errorf("bbb222 CPU = %v, want a value at the first timestamp and a gap at the second", db.CPU)
+	}
+
+	get(t, s, "/api/compare?a=aaa111", http.StatusBadRequest)
+	get(t, s, "/api/compare?a=aaa111&b=zzz999", http.StatusNotFound)
+}
+
+func TestEfficiencyScore(t *testing.T) {
+	dir := t.TempDir()
+	idle := stat("aaa111", "idle", "2", "1")
+	idle.MemUsage = "160MiB / 16GiB"
+	busy := stat("bbb222", "busy", "60", "80")
+	busy.MemUsage = "800MiB / 1000MiB"
+	writeStatsFile(t, dir, testStart, idle, busy)
+	s := newTestServer(t, dir)
+
+	var lazy, efficient ContainerSummary
+	decode(t, get(t, s, "/api/container/aaa111/summary", http.StatusOK), &lazy)
+	decode(t, get(t, s, "/api/container/bbb222/summary", http.StatusOK), &efficient)
+	// 2% CPU and about 1% of a 16GiB limit
+	if math.Abs(lazy.EfficiencyScore-(2+160.0/16384*100)/2) > 1e-9 || lazy.EfficiencyScore > 5 {
+		t.Errorf("score using little of a large limit = %v, want about 1.5", lazy.EfficiencyScore)
+	}
+	if efficient.EfficiencyScore != 70 {
+		t.Errorf("score of a well used container = %v, want 70", efficient.EfficiencyScore)
+	}
+
+	// Weighting memory only leaves the limit utilization
+	decode(t, get(t, newTestServer(t, dir, "-efficiency-cpu-weight", "0"), "/api/container/bbb222/summary", http.StatusOK), &efficient)
+	if got := efficient.EfficiencyScore; got != 80 {
+		t.Errorf("memory-only score = %v, want 80", got)
+	}
+}
+
+func TestPrettyJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir)
+
+	for _, target := range []string{"/api/stats-overview", "/api/container/aaa111", "/api/container/aaa111/summary"} {
+		compact := get(t, s, target, http.StatusOK).Body.String()
+		if strings.Count(compact, "\n") != 1 {
+			t.Errorf("%s is not compact by default", target)
+		}
+		pretty := get(t, s, target+"?pretty=true", http.StatusOK).Body.String()
+		if strings.Count(pretty, "\n") < 3 || !strings.Contains(pretty, "\n  \"") {
+			t.Errorf("%s?pretty=true is not indented:\n%s", target, pretty)
+		}
+	}
+}
+
+func TestDiffBack(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "40"), stat("bbb222", "gone", "5", "10"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "90", "90"))
+	writeStatsFile(t, dir, testStart.Add(2*time.Minute), stat("aaa111", "web", "25", "30"), stat("ccc333", "new", "7", "10"))
+	files := loadFiles(t, dir)
+	changes := getChanges(files[2], files[0])
+	byID := map[string]ContainerChange{}
+	for _, change := range changes {
+		byID[change.ContainerID] = change
+	}
+	if c := byID["aaa111"]; c.Status != "present" || c.OldCPU != 10 || c.NewCPU != 25 || c.DeltaCPU != 15 || c.DeltaMem != -10 {
+		t.Errorf("web change = %+v, want CPU 10 to 25 (+15) and memory -10", c)
+	}
+	if byID["bbb222"].Status != "gone" || byID["ccc333"].Status != "new" || len(changes) != 3 {
+		t.Errorf("changes = %+v, want gone bbb222 and new ccc333", changes)
+	}
+
+	// diff_back is clamped to the two older files
+	s := newTestServer(t, dir)
+	body := get(t, s, "/?diff_back=5", http.StatusOK).Body.String()
+	if !strings.Contains(body, "Changes since 2 snapshots ago") {
+		t.Error("dashboard does not clamp diff_back to the available history")
+	}
+	if !strings.Contains(body, "10.00% &rarr; 25.00%") || !strings.Contains(body, "<em>gone</em>") || !strings.Contains(body, "<em>new</em>") {
+		t.Error("dashboard does not render the changes against the oldest file")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	line := func(s DockerStat) []byte {
+		b, _ := json.Marshal(s)
+		return append(b, '\n')
+	}
+	entries := []struct {
+		name string
+		body []byte
+	}{
+		{"stats/2025-08-05_10-00-00_docker_stats.json", line(stat("aaa111", "web", "10", "20"))},
+		{"stats/notes.txt", []byte("not stats")},
+		{"stats/2025-08-05_10-01-00_docker_stats.json", append(line(stat("aaa111", "web", "30", "20")), line(stat("bbb222", "db", "5", "10"))...)},
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(entry.body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(entry.body)
+	}
+	tw.Close()
+	gz.Close()
+	archive := filepath.Join(t.TempDir(), "stats.tar.gz")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _, err := loadAllStatsFiles(t.TempDir(), LoadOptions{Archive: archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("loaded %d files from the archive, want 2", len(files))
+	}
+	if files[0].Name != "2025-08-05_10-01-00_docker_stats.json" || !files[0].Timestamp.Equal(testStart.Add(time.Minute)) || len(files[0].Stats) != 2 {
+		t.Errorf("newest file = %s at %s with %d containers, want the 10:01 entry with 2", files[0].Name, files[0].Timestamp, len(files[0].Stats))
+	}
+
+	s := newTestServer(t, t.TempDir(), "-archive", archive)
+	var comparison ContainerComparison
+	decode(t, get(t, s, "/api/container/aaa111", http.StatusOK), &comparison)
+	if len(comparison.Data) != 2 {
+		t.Errorf("aaa111 has %d data points from the archive, want 2", len(comparison.Data))
+	}
+}
+
+func TestDashboardCPUSparkline(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "20", "50", "100", "200")
+	s := newTestServer(t, dir, "-sparkline-points", "3")
+
+	files := loadFiles(t, dir)
+	series := trailingCPUSeries(files, 0, 3)
+	if !reflect.DeepEqual(series["aaa111"], []float64{50, 100, 200}) {
+		t.Errorf("trailing series = %v, want the last 3 values oldest first", series["aaa111"])
+	}
+	if series := trailingCPUSeries(files, 3, 3); len(series["aaa111"]) != 2 {
+		t.Errorf("trailing series of the second oldest file = %v, want the 2 values available", series["aaa111"])
+	}
+
+	// Values above 100% scale the line to their peak rather than being clipped
+	body := get(t, s, "/", http.StatusOK).Body.String()
+	if !strings.Contains(body, `d="M0.0,15.0 L40.0,10.0 L80.0,0.0"`) {
+		t.Error("dashboard sparkline is not the 3 point series scaled to its 200% peak")
+	}
+	if got := buildSparklinePath([]float64{0, 50, 100}, 80, 20, chartTop([]float64{0, 50, 100})); got != "M0.0,20.0 L40.0,10.0 L80.0,0.0" {
+		t.Errorf("sparkline within 0-100 = %q", got)
+	}
+}
+
+func TestDefaultRange(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("old111", "old", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(50*time.Minute), stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(90*time.Minute), stat("aaa111", "web", "20", "20"))
+	s := newTestServer(t, dir, "-default-range", "1h")
+
+	totalFiles := func(target string) int {
+		var stats DatasetStats
+		decode(t, get(t, s, target, http.StatusOK), &stats)
+		return stats.TotalFiles
+	}
+	if n := totalFiles("/api/stats-overview"); n != 2 {
+		t.Errorf("default range covers %d files, want the 2 within an hour of the newest", n)
+	}
+	// Request parameters win over the default range
+	if n := totalFiles("/api/stats-overview?range=all"); n != 3 {
+		t.Errorf("range=all covers %d files, want 3", n)
+	}
+	if n := totalFiles("/api/stats-overview?range=30m"); n != 1 {
+		t.Errorf("range=30m covers %d files, want 1", n)
+	}
+	if n := totalFiles("/api/stats-overview?from=" + testStart.Format(time.RFC3339)); n != 3 {
+		t.Errorf("from covers %d files, want 3", n)
+	}
+
+	if body := get(t, s, "/summary", http.StatusOK).Body.String(); strings.Contains(body, "old111") || !strings.Contains(body, "aaa111") {
+		t.Error("summary under the default range does not list only aaa111")
+	}
+	get(t, s, "/api/stats-overview?range=soon", http.StatusBadRequest)
+}
+
+func TestPeaks(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "70", "10"), stat("bbb222", "db", "20", "60"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute))
+	writeStatsFile(t, dir, testStart.Add(2*time.Minute), stat("aaa111", "web", "5", "90"), stat("bbb222", "db", "40", "30"), stat("ccc333", "cache", "35", "95"))
+	s := newTestServer(t, dir)
+
+	var peaks []PeakEntry
+	decode(t, get(t, s, "/api/peaks", http.StatusOK), &peaks)
+	if len(peaks) != 3 {
+		t.Fatalf("got %d peak entries, want one per file", len(peaks))
+	}
+	want := []struct{ cpuName, memName string }{{"web", "db"}, {"", ""}, {"db", "cache"}}
+	for i, w := range want {
+		peak := peaks[i]
+		if want := testStart.Add(time.Duration(i) * time.Minute).Format(time.RFC3339); peak.Timestamp != want {
+			t.Errorf("entry %d timestamp = %s, want %s", i, peak.Timestamp, want)
+		}
+		if w.cpuName == "" {
+			if peak.TopCPUContainer != nil || peak.TopMemValue != nil {
+				t.Errorf("empty file entry = %+v, want null peaks", peak)
+			}
+			continue
+		}
+		if peak.TopCPUContainer == nil || *peak.TopCPUContainer != w.cpuName || peak.TopMemContainer == nil || *peak.TopMemContainer != w.memName {
+			t.Errorf("entry %d tops = %v/%v, want %s for CPU and %s for memory", i, peak.TopCPUContainer, peak.TopMemContainer, w.cpuName, w.memName)
+		}
+	}
+	if *peaks[2].TopCPUValue != 40 || *peaks[2].TopMemValue != 95 {
+		t.Errorf("newest peak values = %v CPU, %v memory, want 40 and 95", *peaks[2].TopCPUValue, *peaks[2].TopMemValue)
+	}
+}
+
+func TestHideSystem(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart,
+		stat("aaa111", "web", "10", "20"),
+		stat("bbb222", "k8s_POD_web-7d9f_default_1234_0", "0", "1"),
+		stat("ccc333", "web-sidecar", "1", "1"))
+
+	// ids lists the containers the dashboard shows
+	ids := func(s *Server) string {
+		body := get(t, s, "/", http.StatusOK).Body.String()
+		var ids []string
+		for _, id := range []string{"aaa111", "bbb222", "ccc333"} {
+			if strings.Contains(body, id) {
+				ids = append(ids, id)
+			}
+		}
+		return strings.Join(ids, ",")
+	}
+	if got := ids(newTestServer(t, dir)); got != "aaa111,bbb222,ccc333" {
+		t.Errorf("containers by default = %s, want all three", got)
+	}
+	if got := ids(newTestServer(t, dir, "-hide-system")); got != "aaa111,ccc333" {
+		t.Errorf("containers with -hide-system = %s, want the k8s_POD_ container dropped", got)
+	}
+	if got := ids(newTestServer(t, dir, "-hide-system", "-exclude-containers", "*-sidecar")); got != "aaa111" {
+		t.Errorf("containers with -hide-system and -exclude-containers = %s, want only aaa111", got)
+	}
+}
+
+// readCSV parses a CSV or TSV response body
+func readCSV(t *testing.T, rec *httptest.ResponseRecorder, delimiter rune) [][]string {
+	t.Helper()
+	reader := csv.NewReader(rec.Body)
+	reader.Comma = delimiter
+	rows, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("error parsing CSV: %v", err)
+	}
+	return rows
+}
+
+func TestIOCSV(t *testing.T) {
+	dir := t.TempDir()
+	for i, io := range [][2]string{{"1MB / 2MB", "0B / 0B"}, {"7MB / 2.6MB", "3MB / 1.2MB"}, {"1MB / 3MB", "3MB / 1.2MB"}} {
+		s := stat("aaa111", "web", "10", "20")
+		s.NetIO, s.BlockIO = io[0], io[1]
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), s)
+	}
+	s := newTestServer(t, dir)
+
+	rec := get(t, s, "/api/container/aaa111/io.csv", http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("content type = %q, want text/csv", ct)
+	}
+	want := [][]string{
+		{"timestamp", "net_rx_rate", "net_tx_rate", "block_read_rate", "block_write_rate"},
+		{testStart.Format(time.RFC3339), "", "", "", ""},
+		// 6MB in, 0.6MB out, 3MB read and 1.2MB written over 60s
+		{testStart.Add(time.Minute).Format(time.RFC3339), "100000.00", "10000.00", "50000.00", "20000.00"},
+		// The received counter was reset
+		{testStart.Add(2 * time.Minute).Format(time.RFC3339), "0.00", "6666.67", "0.00", "0.00"},
+	}
+	if rows := readCSV(t, rec, ','); !reflect.DeepEqual(rows, want) {
+		t.Errorf("io.csv rows = %v, want %v", rows, want)
+	}
+}
+
+func TestDropdownAge(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(12*time.Minute), stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(3*time.Hour), stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir)
+
+	body := get(t, s, "/", http.StatusOK).Body.String()
+	for _, want := range []string{
+		"(2025-08-05 13:00:00 UTC) (latest)",
+		"(2025-08-05 10:12:00 UTC) (2h ago)",
+		"(2025-08-05 10:00:00 UTC) (3h ago)",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dropdown has no option with %q", want)
+		}
+	}
+
+	if got := fileAge(testStart, testStart.Add(12*time.Minute)); got != "12m ago" {
+		t.Errorf("fileAge for 12 minutes = %q, want 12m ago", got)
+	}
+	if got := fileAge(testStart, testStart.Add(50*time.Hour)); got != "2d ago" {
+		t.Errorf("fileAge for 50 hours = %q, want 2d ago", got)
+	}
+}
+
+func TestClockWarnings(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(5*time.Minute), stat("aaa111", "web", "10", "20"))
+	// The host clock jumped back before the third file was written
+	regressed := writeStatsFile(t, dir, testStart.Add(-2*time.Minute), stat("aaa111", "web", "10", "20"))
+	writtenAt := testStart.Add(7 * time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, regressed), writtenAt, writtenAt); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, dir)
+
+	var warnings []ClockWarning
+	decode(t, get(t, s, "/api/clock-warnings", http.StatusOK), &warnings)
+	if len(warnings) != 1 {
+		t.Fatalf("got %d clock warnings, want 1: %+v", len(warnings), warnings)
+	}
+	if w := warnings[0]; w.File != regressed || w.PreviousFile != "2025-08-05_10-05-00_docker_stats.json" || !w.WrittenAt.Equal(writtenAt) {
+		t.Errorf("warning = %+v, want %s regressing behind the 10:05 file", w, regressed)
+	}
+
+	// The files are still ordered by their timestamps
+	files := loadFiles(t, dir)
+	for i := 1; i < len(files); i++ {
+		if !files[i].Timestamp.Before(files[i-1].Timestamp) {
+			t.Errorf("file %d (%s) is not older than file %d", i, files[i].Name, i-1)
+		}
+	}
+}
+
+func TestContainerCount(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "5", "10"), stat("ccc333", "k8s_POD_x", "0", "0"))
+	writeStatsFile(t, dir, testStart.Add(2*time.Minute), stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "5", "10"))
+	s := newTestServer(t, dir, "-hide-system")
+
+	var counts []ContainerCount
+	decode(t, get(t, s, "/api/container-count", http.StatusOK), &counts)
+	want := []ContainerCount{
+		{testStart.Format(time.RFC3339), 1},
+		{testStart.Add(time.Minute).Format(time.RFC3339), 2},
+		{testStart.Add(2 * time.Minute).Format(time.RFC3339), 2},
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("container counts = %v, want %v", counts, want)
+	}
+}
+
+// sparklineFiles builds stats files in memory with the given number of
+// containers and snapshots
+func sparklineFiles(containers, snapshots int) []StatsFile {
+	files := make([]StatsFile, snapshots)
+	for i := range files {
+		stats := make([]DockerStat, containers)
+		for c := range stats {
+			stats[c] = stat(fmt.Sprintf("c%05d", c), fmt.Sprintf("app%d", c), strconv.Itoa((c+i)%100), "20")
+		}
+		files[i] = StatsFile{
+			Name:      fmt.Sprintf("snapshot%d", i),
+			Timestamp: testStart.Add(time.Duration(snapshots-i) * time.Minute),
+			Stats:     stats,
+		}
+	}
+	return files
+}
+
+func TestPrecomputeSparklinesFill(t *testing.T) {
+	files := sparklineFiles(20, 10)
+	cache := newSparklineCache()
+	cache.Fill(1, map[string][]byte{"stale": []byte("old")})
+
+	precomputeSparklines(cache, files, 2, 4)
+
+	if cache.version != 2 {
+		t.Fatalf("cache version = %d, want 2", cache.version)
+	}
+	if _, ok := cache.images["stale"]; ok {
+		t.Error("image of the old version is still cached")
+	}
+	if len(cache.images) != 20 {
+		t.Errorf("got %d cached images, want 20", len(cache.images))
+	}
+	for c := 0; c < 20; c++ {
+		key := sparklineKey(fmt.Sprintf("c%05d", c), "cpu", sparklineWidth, sparklineHeight, "")
+		img, ok := cache.images[key]
+		if !ok {
+			t.Fatalf("no precomputed image for %s", key)
+		}
+		if _, err := png.Decode(bytes.NewReader(img)); err != nil {
+			t.Errorf("image for %s is not a PNG: %v", key, err)
+		}
+	}
+
+	// A late precompute of an older version leaves the cache untouched
+	precomputeSparklines(cache, sparklineFiles(30, 10), 1, 4)
+	if cache.version != 2 || len(cache.images) != 20 {
+		t.Errorf("older version changed the cache to version %d with %d images", cache.version, len(cache.images))
+	}
+}
+
+func BenchmarkPrecomputeSparklines(b *testing.B) {
+	files := sparklineFiles(200, 50)
+	for _, bm := range []struct {
+		name    string
+		workers int
+	}{
+		{"serial", 1},
+		{"parallel", runtime.NumCPU()},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				precomputeSparklines(newSparklineCache(), files, 1, bm.workers)
+			}
+		})
+	}
+}
+
+func TestObservedInterval(t *testing.T) {
+	dir := t.TempDir()
+	// aaa111 is sampled every 30s; bbb222 only in a few of the snapshots
+	// at uneven gaps
+	offsets := []int{0, 30, 60, 90, 120, 150, 180}
+	for i, offset := range offsets {
+		stats := []DockerStat{stat("aaa111", "web", "10", "20")}
+		if i <= 2 || i == 6 {
+			stats = append(stats, stat("bbb222", "db", "5", "10"))
+		}
+		writeStatsFile(t, dir, testStart.Add(time.Duration(offset)*time.Second), stats...)
+	}
+	s := newTestServer(t, dir)
+
+	var web, db ContainerSummary
+	decode(t, get(t, s, "/api/container/aaa111/summary", http.StatusOK), &web)
+	if web.ObservedInterval != 30 || web.IrregularInterval {
+		t.Errorf("web interval = %vs irregular %v, want 30s regular", web.ObservedInterval, web.IrregularInterval)
+	}
+	// Gaps of 30s, 30s and 120s have a 30s median with one of the three
+	// off by more than half
+	decode(t, get(t, s, "/api/container/bbb222/summary", http.StatusOK), &db)
+	if db.ObservedInterval != 30 || !db.IrregularInterval {
+		t.Errorf("db interval = %vs irregular %v, want 30s irregular", db.ObservedInterval, db.IrregularInterval)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"busy-floor": 20, "stale-after": "30m", "hide-system": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg Config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.registerFlags(fs)
+	if err := fs.Parse([]string{"-busy-floor", "10"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.BusyFloor != 10 {
+		t.Errorf("busy-floor = %v, want the flag's 10 over the file's 20", cfg.BusyFloor)
+	}
+	if cfg.StaleAfter != 30*time.Minute || !cfg.HideSystem {
+		t.Errorf("stale-after = %v, hide-system = %v, want the file's 30m and true", cfg.StaleAfter, cfg.HideSystem)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"no-such-flag": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(fs, path); err == nil {
+		t.Error("unknown setting was accepted")
+	}
+}
+
+func TestOverThreshold(t *testing.T) {
+	dir := t.TempDir()
+	for i, cpu := range []string{"10", "90", "90", "90", "10"} {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*30*time.Second), stat("aaa111", "web", cpu, "20"))
+	}
+	s := newTestServer(t, dir)
+
+	var over OverThreshold
+	decode(t, get(t, s, "/api/container/aaa111/over?metric=cpu&threshold=80", http.StatusOK), &over)
+	if over.OverSeconds != 60 || over.ObservedSeconds != 120 || over.OverPercent != 50 {
+		t.Errorf("over = %+v, want 60s of 120s observed (50%%)", over)
+	}
+}
+
+func TestIOTSV(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "20", "30")
+	s := newTestServer(t, dir)
+
+	rec := get(t, s, "/api/container/aaa111/io.csv?format=tsv", http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/tab-separated-values" {
+		t.Errorf("content type = %q, want text/tab-separated-values", ct)
+	}
+	tsv := readCSV(t, rec, '\t')
+	if len(tsv) != 4 {
+		t.Fatalf("got %d TSV rows, want a header and 3 rows", len(tsv))
+	}
+	for i, row := range tsv {
+		if len(row) != len(tsv[0]) {
+			t.Errorf("row %d has %d columns, want %d: %q", i, len(row), len(tsv[0]), row)
+		}
+	}
+	if csv := readCSV(t, get(t, s, "/api/container/aaa111/io.csv", http.StatusOK), ','); !reflect.DeepEqual(tsv, csv) {
+		t.Errorf("TSV rows = %v, want the CSV rows %v", tsv, csv)
+	}
+
+	get(t, s, "/api/container/aaa111/io.csv?format=xlsx", http.StatusBadRequest)
+}
+
+func TestStatusLine(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "90", "20"), stat("bbb222", "db", "30", "10"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "20", "20"), stat("bbb222", "db", "50", "10"))
+	writeStatsFile(t, dir, testStart.Add(2*time.Minute), stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir)
+
+	body := get(t, s, "/container/aaa111", http.StatusOK).Body.String()
+	if want := `<p class="status-line metric-low">Currently 10.00% CPU (below its 40.00% average, peak 90.00%)</p>`; !strings.Contains(body, want) {
+		t.Errorf("container page has no %q", want)
+	}
+	body = get(t, s, "/container/bbb222", http.StatusOK).Body.String()
+	if want := "Not currently running (last seen 2025-08-05 10:01:00 UTC, 40.00% average CPU, peak 50.00%)"; !strings.Contains(body, want) {
+		t.Errorf("container page has no %q", want)
+	}
+}
+
+func TestQueryAPI(t *testing.T) {
+	dir := t.TempDir()
+	// 23:30, 00:30 and 01:00, across midnight
+	day := time.Date(2025, 8, 5, 23, 30, 0, 0, time.UTC)
+	cpu := map[string][]float64{"aaa111": {10, 20, 60}, "bbb222": {40, 50}}
+	writeStatsFile(t, dir, day, stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "40", "10"))
+	writeStatsFile(t, dir, day.Add(time.Hour), stat("aaa111", "web", "20", "20"), stat("bbb222", "db", "50", "10"))
+	writeStatsFile(t, dir, day.Add(90*time.Minute), stat("aaa111", "web", "60", "20"))
+
+	get(t, newTestServer(t, dir), "/api/query?agg=avg", http.StatusNotFound)
+	s := newTestServer(t, dir, "-query-api")
+
+	var rows []QueryRow
+	decode(t, get(t, s, "/api/query?agg=avg&metric=cpu&by=container", http.StatusOK), &rows)
+	var want []QueryRow
+	for _, c := range []struct{ id, name string }{{"aaa111", "web"}, {"bbb222", "db"}} {
+		var sum float64
+		for _, v := range cpu[c.id] {
+			sum += v
+		}
+		want = append(want, QueryRow{Key: c.id, Name: c.name, Samples: len(cpu[c.id]), Value: sum / float64(len(cpu[c.id]))})
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("by container = %+v, want %+v", rows, want)
+	}
+
+	rows = nil
+	decode(t, get(t, s, "/api/query?agg=p95&container=aaa111", http.StatusOK), &rows)
+	want = []QueryRow{{Key: "aaa111", Name: "web", Samples: 3, Value: percentile(cpu["aaa111"], 95)}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("p95 = %+v, want %+v", rows, want)
+	}
+
+	rows = nil
+	decode(t, get(t, s, "/api/query?agg=max&metric=cpu&by=bucket&bucket=24h", http.StatusOK), &rows)
+	want = []QueryRow{
+		{Key: "2025-08-05T00:00:00Z", Samples: 2, Value: 40},
+		{Key: "2025-08-06T00:00:00Z", Samples: 3, Value: 60},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("by bucket = %+v, want %+v", rows, want)
+	}
+
+	// All three files fall on the morning of August 6th in Tokyo
+	rows = nil
+	tokyo := newTestServer(t, dir, "-query-api", "-tz", "Asia/Tokyo")
+	decode(t, get(t, tokyo, "/api/query?agg=max&metric=cpu&by=bucket&bucket=24h", http.StatusOK), &rows)
+	want = []QueryRow{{Key: "2025-08-06T00:00:00+09:00", Samples: 5, Value: 60}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("by bucket in Tokyo = %+v, want %+v", rows, want)
+	}
+
+	get(t, s, "/api/query?agg=median", http.StatusBadRequest)
+	get(t, s, "/api/query?agg=avg&metric=cpu)%3BDROP+TABLE+points%3B--", http.StatusBadRequest)
+}
+
+func TestRestarts(t *testing.T) {
+	dir := t.TempDir()
+	for i, netIO := range []string{"1MB / 1MB", "2MB / 1MB", "3MB / 2MB", "100kB / 2MB", "200kB / 3MB"} {
+		s := stat("aaa111", "web", "10", "20")
+		s.NetIO = netIO
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), s)
+	}
+	s := newTestServer(t, dir)
+
+	var restarts []Restart
+	decode(t, get(t, s, "/api/container/aaa111/restarts", http.StatusOK), &restarts)
+	want := []Restart{{Timestamp: testStart.Add(3 * time.Minute).Format(time.RFC3339), Counters: []string{"net_in"}}}
+	if !reflect.DeepEqual(restarts, want) {
+		t.Errorf("restarts = %+v, want %+v", restarts, want)
+	}
+
+	var summary ContainerSummary
+	decode(t, get(t, s, "/api/container/aaa111/summary", http.StatusOK), &summary)
+	if got := summary.Restarts; got != 1 {
+		t.Errorf("summary restarts = %d, want 1", got)
+	}
+}
+
+func TestNetworkTop(t *testing.T) {
+	dir := t.TempDir()
+	for i, netIO := range [][3]string{{"1MB / 0B", "0B / 0B", "0B / 0B"}, {"4MB / 1MB", "1MB / 5MB", "100kB / 0B"}} {
+		a, b, c := stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "10", "20"), stat("ccc333", "cache", "10", "20")
+		a.NetIO, b.NetIO, c.NetIO = netIO[0], netIO[1], netIO[2]
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), a, b, c)
+	}
+	s := newTestServer(t, dir)
+
+	var talkers []NetworkTalker
+	decode(t, get(t, s, "/api/network-top?n=2", http.StatusOK), &talkers)
+	want := []NetworkTalker{
+		{ContainerID: "bbb222", ContainerName: "db", RxBytes: 1000000, TxBytes: 5000000, TotalBytes: 6000000},
+		{ContainerID: "aaa111", ContainerName: "web", RxBytes: 3000000, TxBytes: 1000000, TotalBytes: 4000000},
+	}
+	if !reflect.DeepEqual(talkers, want) {
+		t.Errorf("network top = %+v, want %+v", talkers, want)
+	}
+}
+
+func TestMemUsageBytes(t *testing.T) {
+	dir := t.TempDir()
+	for i, usage := range []string{"100MiB / 1GiB", "300MiB / 1GiB"} {
+		s := stat("aaa111", "web", "10", "20")
+		s.MemUsage = usage
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), s)
+	}
+	s := newTestServer(t, dir)
+
+	var comparison ContainerComparison
+	decode(t, get(t, s, "/api/container/aaa111", http.StatusOK), &comparison)
+	if len(comparison.Data) != 2 {
+		t.Fatalf("got %d data points, want 2", len(comparison.Data))
+	}
+	for _, point := range comparison.Data {
+		if point.MemLimitBytes != 1<<30 {
+			t.Errorf("mem_limit_bytes = %d, want %d", point.MemLimitBytes, 1<<30)
+		}
+	}
+	var summary ContainerSummary
+	decode(t, get(t, s, "/api/container/aaa111/summary", http.StatusOK), &summary)
+	if want := int64(200 << 20); summary.AvgMemUsedBytes != want {
+		t.Errorf("avg_mem_used_bytes = %d, want %d", summary.AvgMemUsedBytes, want)
+	}
+}
+
+func TestLowMemory(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 4; i++ {
+		cpu := strconv.Itoa(10 * (i + 1))
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Hour), stat("aaa111", "web", cpu, "20"), stat("bbb222", "db", "5", cpu))
+	}
+	normal, lowMemory := newTestServer(t, dir, "-query-api"), newTestServer(t, dir, "-query-api", "-low-memory")
+
+	files, _, err := loadAllStatsFiles(dir, LoadOptions{LowMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 || len(files[0].Stats) != 0 {
+		t.Fatalf("low-memory load holds the stats of its files")
+	}
+	for _, target := range []string{
+		"/summary",
+		"/api/container/aaa111/summary",
+		"/api/overview",
+		"/api/stats-overview",
+		"/api/heatmap?by=day",
+		"/api/peaks",
+		"/api/export",
+		"/api/network-top",
+		"/api/query?agg=avg&by=bucket",
+		"/api/file/1/range?min=0&max=100",
+		"/?file=1&avg=2&diff_back=2",
+	} {
+		want := get(t, normal, target, http.StatusOK).Body.String()
+		if got := get(t, lowMemory, target, http.StatusOK).Body.String(); got != want {
+			t.Errorf("%s differs under -low-memory:\n%s\nwant:\n%s", target, got, want)
+		}
+	}
+}
+
+func TestIOCounters(t *testing.T) {
+	dir := t.TempDir()
+	for i, netIO := range []string{"1.5 kB / 900B", "n/a", "3kB / 1kB"} {
+		s := stat("aaa111", "web", "10", "20")
+		s.NetIO = netIO
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), s)
+	}
+	s := newTestServer(t, dir)
+
+	var comparison ContainerComparison
+	decode(t, get(t, s, "/api/container/aaa111", http.StatusOK), &comparison)
+	if len(comparison.Data) != 3 {
+		t.Fatalf("got %d data points, want 3", len(comparison.Data))
+	}
+	if p := comparison.Data[0]; p.NetInBytes != 1500 || p.NetOutBytes != 900 || !p.NetIOValid || !p.BlockIOValid {
+		t.Errorf("first point = %d / %d valid %v, want 1500 / 900 valid", p.NetInBytes, p.NetOutBytes, p.NetIOValid)
+	}
+	if p := comparison.Data[1]; p.NetIOValid || !p.BlockIOValid {
+		t.Errorf("malformed NetIO valid = %v, block I/O valid = %v, want false and true", p.NetIOValid, p.BlockIOValid)
+	}
+
+	// The malformed sample is skipped rather than read as a reset to 0
+	var summary ContainerSummary
+	decode(t, get(t, s, "/api/container/aaa111/summary", http.StatusOK), &summary)
+	if summary.NetInTotal != 1500 || summary.NetOutTotal != 100 {
+		t.Errorf("net totals = %d / %d, want 1500 / 100", summary.NetInTotal, summary.NetOutTotal)
+	}
+	var restarts []Restart
+	decode(t, get(t, s, "/api/container/aaa111/restarts", http.StatusOK), &restarts)
+	if len(restarts) != 0 {
+		t.Errorf("restarts = %+v, want none", restarts)
+	}
+}
+
+func TestRegression(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "12", "8", "10", "40", "42", "38", "40")
+	s := newTestServer(t, dir)
+
+	var regression Regression
+	decode(t, get(t, s, "/api/container/aaa111/regression", http.StatusOK), &regression)
+	if !regression.Sufficient || regression.BaselineSamples != 4 || regression.RecentSamples != 4 {
+		t.Fatalf("regression = %+v, want two sufficient windows of 4", regression)
+	}
+	cpu := regression.CPU
+	if cpu.BaselineAvg != 10 || cpu.RecentAvg != 40 || cpu.ChangePercent == nil || *cpu.ChangePercent != 300 || !cpu.Notable {
+		t.Errorf("cpu shift = %+v, want a notable rise from 10%% to 40%% (+300%%)", *cpu)
+	}
+	if mem := regression.Mem; mem.Notable || *mem.ChangePercent != 0 {
+		t.Errorf("mem shift = %+v, want an unchanged flat memory", *mem)
+	}
+
+	regression = Regression{}
+	decode(t, get(t, s, "/api/container/aaa111/regression?recent=6", http.StatusOK), &regression)
+	if regression.Sufficient || regression.CPU != nil {
+		t.Errorf("regression with a 2 point baseline = %+v, want insufficient", regression)
+	}
+}
+
+func TestSummaryAPI(t *testing.T) {
+	dir := t.TempDir()
+	for i, cpu := range []string{"10", "90", "30"} {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), stat("aaa111", "web", cpu, "20"), stat("bbb222", "db", "5", "40"))
+	}
+	s := newTestServer(t, dir)
+
+	var report SummaryReport
+	decode(t, get(t, s, "/api/summary", http.StatusOK), &report)
+	if report.TotalFiles != 3 || len(report.Summaries) != 2 {
+		t.Fatalf("got %d files and %d summaries, want 3 and 2", report.TotalFiles, len(report.Summaries))
+	}
+	if report.HighestPeakCPU == nil || report.HighestPeakCPU.ContainerID != "aaa111" || report.HighestPeakCPU.MaxCPU != 90 {
+		t.Errorf("highest peak CPU = %+v, want aaa111 at 90", report.HighestPeakCPU)
+	}
+	want := summaryByID(t, loadSummaries(t, dir, StatsOptions{}), "bbb222")
+	if got := summaryByID(t, report.Summaries, "bbb222"); got.AvgMem != want.AvgMem || got.DataPoints != want.DataPoints {
+		t.Errorf("db summary = %+v, want %+v", got, want)
+	}
+}
+
+func TestNumberFormat(t *testing.T) {
+	for _, tt := range []struct {
+		locale   string
+		value    float64
+		decimals int
+		want     string
+	}{
+		{"en", 1234.56, 2, "1,234.56"},
+		{"de", 1234.56, 2, "1.234,56"},
+		{"en", -1234567.891, 1, "-1,234,567.9"},
+		{"de", -1234567.891, 1, "-1.234.567,9"},
+		{"de", 999, 0, "999"},
+	} {
+		if got := numberFormats[tt.locale].Format(tt.value, tt.decimals); got != tt.want {
+			t.Errorf("%s Format(%v, %d) = %q, want %q", tt.locale, tt.value, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestStatsDirPassedToRunScript(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir)
+
+	// The script copies the existing snapshot under a newer name into the
+	// directory it is given
+	script := fmt.Sprintf("cp \"$STATS_DIR\"/*.json \"$STATS_DIR\"/%s_docker_stats.json\n", testStart.Add(time.Minute).Format("2006-01-02_15-04-05"))
+	scriptDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(scriptDir, "run.sh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(scriptDir)
+
+	var result struct {
+		FilesLoaded int `json:"files_loaded"`
+	}
+	decode(t, post(t, s, "/api/refresh", "", http.StatusOK), &result)
+	if result.FilesLoaded != 2 {
+		t.Errorf("loaded %d files after run.sh, want 2", result.FilesLoaded)
+	}
+}
+
+func TestSummaryCSV(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "5", "10"), stat("ccc333", "webapp", "30", "10"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "20", "20"), stat("bbb222", "db", "5", "10"), stat("ccc333", "webapp", "40", "10"))
+	s := newTestServer(t, dir)
+
+	rows := readCSV(t, get(t, s, "/api/summary.csv", http.StatusOK), ',')
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want a header and 3 containers", len(rows))
+	}
+	header := rows[0]
+	if header[0] != "container_id" || header[1] != "container_name" || len(header) != len(summaryColumns) {
+		t.Errorf("header = %v, want container_id, container_name and %d columns", header, len(summaryColumns))
+	}
+	for _, want := range []string{"avg_cpu", "max_cpu", "min_cpu", "p50_cpu", "p95_cpu", "cpu_trend", "efficiency_score", "restarts"} {
+		if !slices.Contains(header, want) {
+			t.Errorf("header has no %s column", want)
+		}
+	}
+
+	rows = readCSV(t, get(t, s, "/api/summary.csv?name=web&sort=avg_cpu&order=desc", http.StatusOK), ',')
+	if len(rows) != 3 || rows[1][0] != "ccc333" || rows[2][0] != "aaa111" {
+		t.Errorf("filtered rows = %v, want webapp then web", rows)
+	}
+	get(t, s, "/api/summary.csv?sort=nope", http.StatusBadRequest)
+}
+
+func TestInvertedRange(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "20", "20"))
+	s := newTestServer(t, dir)
+
+	from, to := testStart.Add(time.Minute).Format(time.RFC3339), testStart.Format(time.RFC3339)
+	rec := get(t, s, "/api/stats-overview?from="+from+"&to="+to, http.StatusBadRequest)
+	if !strings.Contains(rec.Body.String(), "is after to") {
+		t.Errorf("body = %q, want the inverted range named", rec.Body.String())
+	}
+	get(t, s, "/api/stats-overview?from="+to+"&to="+from, http.StatusOK)
+}
+
+func TestRawFile(t *testing.T) {
+	dir := t.TempDir()
+	plain := writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	line, _ := json.Marshal(stat("aaa111", "web", "20", "20"))
+	gz.Write(append(line, '\n'))
+	gz.Close()
+	gzName := "2025-08-05_10-01-00_docker_stats.json.gz"
+	if err := os.WriteFile(filepath.Join(dir, gzName), gzipped.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, dir)
+
+	want, err := os.ReadFile(filepath.Join(dir, plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := get(t, s, "/api/file/"+plain+"/raw", http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("content type = %q, want text/plain", ct)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), want) {
+		t.Errorf("raw body = %q, want %q", rec.Body.Bytes(), want)
+	}
+
+	rec = get(t, s, "/api/file/"+gzName+"/raw", http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/gzip" {
+		t.Errorf("content type = %q, want application/gzip", ct)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), gzipped.Bytes()) {
+		t.Error("gzipped file was not served byte for byte")
+	}
+
+	for _, name := range []string{"..%2F..%2Fetc%2Fpasswd", "..%5Csecret.json", "stats..json"} {
+		get(t, s, "/api/file/"+name+"/raw", http.StatusBadRequest)
+	}
+	get(t, s, "/api/file/missing.json/raw", http.StatusNotFound)
+}
+
+func TestSummaryPercentiles(t *testing.T) {
+	dir := t.TempDir()
+	for i, cpu := range []string{"30", "10", "50", "20", "40"} {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), stat("aaa111", "web", cpu, "20"))
+	}
+	s := newTestServer(t, dir)
+
+	var summary ContainerSummary
+	decode(t, get(t, s, "/api/container/aaa111/summary", http.StatusOK), &summary)
+	if summary.P50CPU != 30 || summary.P90CPU != 46 || summary.P99CPU != 49.6 {
+		t.Errorf("CPU percentiles = %v/%v/%v, want 30/46/49.6", summary.P50CPU, summary.P90CPU, summary.P99CPU)
+	}
+	if summary.P50Mem != 20 || summary.P99Mem != 20 {
+		t.Errorf("memory percentiles = %v/%v, want 20 for a constant series", summary.P50Mem, summary.P99Mem)
+	}
+
+	if body := get(t, s, "/summary", http.StatusOK).Body.String(); !strings.Contains(body, `<td data-value="46">46.00%</td>`) {
+		t.Error("summary page does not show the P90 CPU cell")
+	}
+	if body := get(t, newTestServer(t, dir, "-columns", "cpu,mem"), "/summary", http.StatusOK).Body.String(); strings.Contains(body, "P90 CPU %") {
+		t.Error("summary page shows percentiles although -columns omits them")
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	dir := t.TempDir()
+	night := time.Date(2025, 8, 5, 23, 0, 0, 0, time.UTC)
+	writeStatsFile(t, dir, night, stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, night.Add(30*time.Minute), stat("aaa111", "web", "30", "40"))
+	writeStatsFile(t, dir, night.Add(90*time.Minute), stat("aaa111", "web", "50", "10"))
+	s := newTestServer(t, dir)
+
+	var days []CalendarDay
+	decode(t, get(t, s, "/api/container/aaa111/calendar", http.StatusOK), &days)
+	want := []CalendarDay{
+		{Date: "2025-08-05", DataPoints: 2, AvgCPU: 20, MaxCPU: 30, AvgMem: 30, MaxMem: 40},
+		{Date: "2025-08-06", DataPoints: 1, AvgCPU: 50, MaxCPU: 50, AvgMem: 10, MaxMem: 10},
+	}
+	if !reflect.DeepEqual(days, want) {
+		t.Errorf("calendar = %+v, want %+v", days, want)
+	}
+}
+
+func TestSpikes(t *testing.T) {
+	dir := t.TempDir()
+	for i, cpu := range []string{"10", "95", "20", "85"} {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Minute), stat("aaa111", "web", cpu, "20"))
+	}
+
+	var summary ContainerSummary
+	decode(t, get(t, newTestServer(t, dir), "/api/container/aaa111/summary", http.StatusOK), &summary)
+	if summary.CPUSpikeCount != 2 || summary.MemSpikeCount != 0 {
+		t.Errorf("spikes = %d CPU, %d memory, want 2 and 0", summary.CPUSpikeCount, summary.MemSpikeCount)
+	}
+
+	s := newTestServer(t, dir, "-cpu-spike", "90", "-mem-spike", "15")
+	decode(t, get(t, s, "/api/container/aaa111/summary", http.StatusOK), &summary)
+	if summary.CPUSpikeCount != 1 || summary.MemSpikeCount != 4 {
+		t.Errorf("spikes = %d CPU, %d memory, want 1 and 4 with the thresholds lowered", summary.CPUSpikeCount, summary.MemSpikeCount)
+	}
+	if body := get(t, s, "/summary", http.StatusOK).Body.String(); !strings.Contains(body, `title="Data points above 90% CPU">CPU Spikes</th>`) {
+		t.Error("summary page does not name the CPU spike threshold")
+	}
+}
+
+func TestSummaryPageCSV(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "15", "20"))
+	s := newTestServer(t, dir)
+
+	rec := get(t, s, "/summary.csv", http.StatusOK)
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "summary.csv") {
+		t.Errorf("Content-Disposition = %q, want a summary.csv download", cd)
+	}
+	rows := readCSV(t, rec, ',')
+	want := [][]string{
+		{"container_name", "container_id", "data_points", "avg_cpu", "max_cpu", "min_cpu", "avg_mem", "max_mem", "min_mem", "first_seen", "last_seen"},
+		{"web", "aaa111", "2", "12.50", "15.00", "10.00", "20.00", "20.00", "20.00", "2025-08-05 10:00:00 UTC", "2025-08-05 10:01:00 UTC"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+	if body := get(t, s, "/summary", http.StatusOK).Body.String(); !strings.Contains(body, `href="/summary.csv"`) {
+		t.Error("summary page does not link the CSV download")
+	}
+}
+
+func TestRecencyRanking(t *testing.T) {
+	dir := t.TempDir()
+	// steady stays at 30% for a day, spiky idles at 10% and jumps to 90%
+	// for the last three hours
+	for i := 0; i < 24; i++ {
+		spiky := "10"
+		if i >= 21 {
+			spiky = "90"
+		}
+		writeStatsFile(t, dir, testStart.Add(time.Duration(i)*time.Hour), stat("aaa111", "steady", "30", "20"), stat("bbb222", "spiky", spiky, "20"))
+	}
+	s := newTestServer(t, dir)
+
+	ranking := func(rank string) []string {
+		var report SummaryReport
+		decode(t, get(t, s, "/api/summary?rank="+rank, http.StatusOK), &report)
+		var names []string
+		for _, summary := range report.Summaries {
+			names = append(names, summary.ContainerName)
+		}
+		return names
+	}
+	if got, want := ranking("avg"), []string{"steady", "spiky"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("average ranking = %v, want %v", got, want)
+	}
+	if got, want := ranking("recent"), []string{"spiky", "steady"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("recency-weighted ranking = %v, want %v", got, want)
+	}
+	get(t, s, "/api/summary?rank=latest", http.StatusBadRequest)
+}
+
+func TestContainerHistoryCSV(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "12.5", "20"))
+	s := newTestServer(t, dir)
+
+	rows := readCSV(t, get(t, s, "/container/aaa111.csv", http.StatusOK), ',')
+	if len(rows) != 3 || rows[0][0] != "timestamp" {
+		t.Fatalf("rows = %v, want a header and 2 data points", rows)
+	}
+	if got := rows[1][:3]; !reflect.DeepEqual(got, []string{"2025-08-05 10:00:00 UTC", "10.00", "20.00"}) {
+		t.Errorf("first row starts with %v, want the oldest data point", got)
+	}
+	if got := rows[2][1]; got != "12.50" {
+		t.Errorf("second row CPU = %s, want 12.50", got)
+	}
+	if got := readCSV(t, get(t, s, "/container/aaa111?format=csv", http.StatusOK), ','); !reflect.DeepEqual(got, rows) {
+		t.Error("?format=csv differs from the .csv download")
+	}
+	get(t, s, "/container/zzz999.csv", http.StatusNotFound)
+}
+
+func TestNearestFile(t *testing.T) {
+	dir := t.TempDir()
+	var names []string
+	for i := 0; i < 3; i++ {
+		names = append(names, writeStatsFile(t, dir, testStart.Add(time.Duration(i)*10*time.Minute), stat("aaa111", "web", "10", "20")))
+	}
+	s := newTestServer(t, dir)
+
+	for _, tt := range []struct {
+		ts   time.Time
+		want NearestFile
+	}{
+		// 7 minutes after the first file is 3 minutes before the second
+		{testStart.Add(7 * time.Minute), NearestFile{Index: 1, File: names[1], DiffSeconds: 180}},
+		{testStart.Add(-time.Hour), NearestFile{Index: 2, File: names[0], DiffSeconds: 3600, Clamped: "before_first"}},
+		{testStart.Add(time.Hour), NearestFile{Index: 0, File: names[2], DiffSeconds: 2400, Clamped: "after_last"}},
+	} {
+		var nearest NearestFile
+		decode(t, get(t, s, "/api/nearest?ts="+tt.ts.Format(time.RFC3339), http.StatusOK), &nearest)
+		nearest.Timestamp = ""
+		if nearest != tt.want {
+			t.Errorf("nearest to %s = %+v, want %+v", tt.ts.Format(time.RFC3339), nearest, tt.want)
+		}
+	}
+	get(t, s, "/api/nearest?ts=yesterday", http.StatusBadRequest)
+}
+
+func TestGroupAggregation(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart,
+		labeled(stat("aaa111", "api-1", "10", "20"), "com.docker.compose.service=api"),
+		labeled(stat("bbb222", "api-2", "30", "10"), "com.docker.compose.service=api"))
+	s := newTestServer(t, dir)
+
+	for _, tt := range []struct {
+		agg              string
+		wantCPU, wantMem float64
+	}{
+		{"", 40, 30},
+		{"sum", 40, 30},
+		{"avg", 20, 15},
+		{"max", 30, 20},
+	} {
+		var groups []ContainerGroup
+		decode(t, get(t, s, "/api/groups?by=label:com.docker.compose.service&agg="+tt.agg, http.StatusOK), &groups)
+		if len(groups) != 1 {
+			t.Fatalf("agg=%s: got %d groups, want 1", tt.agg, len(groups))
+		}
+		if g := groups[0]; g.AvgCPU != tt.wantCPU || g.AvgMem != tt.wantMem || g.MaxCPU != 30 || g.MaxMem != 20 {
+			t.Errorf("agg=%s: group = %+v, want %v%% CPU and %v%% memory", tt.agg, g, tt.wantCPU, tt.wantMem)
+		}
+	}
+	get(t, s, "/api/groups?by=project&agg=median", http.StatusBadRequest)
+}
+
+func TestContainerChart(t *testing.T) {
+	dir := t.TempDir()
+	// Samples every minute with a gap of 8 minutes before the fourth one
+	for i, minute := range []int{0, 1, 2, 10, 11} {
+		writeStatsFile(t, dir, testStart.Add(time.Duration(minute)*time.Minute), stat("aaa111", "web", strconv.Itoa(10*(i+1)), "50"))
+	}
+	s := newTestServer(t, dir)
+
+	body := get(t, s, "/container/aaa111", http.StatusOK).Body.String()
+	// x follows the timestamps across the 11 minutes and the line breaks
+	// at the gap: two subpaths, the second starting at minute 10
+	wantCPU := `d="M0.0,180.0 L72.7,160.0 L145.5,140.0 M727.3,120.0 L800.0,100.0"`
+	if !strings.Contains(body, wantCPU) {
+		t.Errorf("container chart has no gapped CPU path %s", wantCPU)
+	}
+	for _, want := range []string{">2025-08-05 10:00:00 UTC</text>", ">2025-08-05 10:11:00 UTC</text>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("container chart has no %q label", want)
+		}
+	}
+
+	data := getContainerComparison(loadFiles(t, dir), "aaa111").Data
+	path := buildChartPath(data, []float64{10, 20, 30, 40, 50}, 800, 200, 100)
+	if n := strings.Count(path, "M"); n != 1 {
+		t.Errorf("path without marked gaps = %q, want a single subpath", path)
+	}
+	markGaps(data, 2)
+	path = buildChartPath(data, []float64{10, 20, 30, 40, 50}, 800, 200, 100)
+	if subpaths := strings.Split(path, " M"); len(subpaths) != 2 {
+		t.Errorf("gapped path = %q, want two subpaths", path)
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	start := time.Now()
+	output, err := runCommand(200*time.Millisecond, nil, "sh", "-c", "echo started; sleep 10; echo finished")
+	if err != errCommandTimeout {
+		t.Fatalf("err = %v, want errCommandTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command was killed after %v, want soon after the 200ms timeout", elapsed)
+	}
+	if got := string(output); got != "started\n" {
+		t.Errorf("output = %q, want only the output before the timeout", got)
+	}
+
+	if output, err := runCommand(5*time.Second, []string{"GREETING=hi"}, "sh", "-c", "echo $GREETING"); err != nil || string(output) != "hi\n" {
+		t.Errorf("quick command = %q, %v, want hi and no error", output, err)
+	}
+}
+
+func TestSummarySparkline(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "0", "50", "100")
+	s := newTestServer(t, dir)
+
+	body := get(t, s, "/summary", http.StatusOK).Body.String()
+	if !strings.Contains(body, `<th>CPU History</th>`) || !strings.Contains(body, `d="M0.0,20.0 L40.0,10.0 L80.0,0.0"`) {
+		t.Error("summary page has no CPU sparkline of aaa111's history")
+	}
+	if body := get(t, newTestServer(t, dir, "-columns", "cpu"), "/summary", http.StatusOK).Body.String(); strings.Contains(body, "CPU History") {
+		t.Error("summary page shows CPU sparklines although -columns omits cpu_history")
+	}
+
+	if got := downsample([]float64{1, 3, 5, 7, 9, 11}, 3); !reflect.DeepEqual(got, []float64{2, 6, 10}) {
+		t.Errorf("downsample = %v, want pairwise averages", got)
+	}
+	if got := downsample([]float64{1, 2}, 3); !reflect.DeepEqual(got, []float64{1, 2}) {
+		t.Errorf("downsample of a short series = %v, want it unchanged", got)
+	}
+}
+
+func TestComposeProjects(t *testing.T) {
+	for name, want := range map[string]string{
+		"shop_web_1":       "shop",
+		"shop-web-1":       "shop",
+		"my-shop-api-2":    "my-shop",
+		"my_shop_db_12":    "my_shop",
+		"web":              "",
+		"web_1":            "",
+		"shop_web_primary": "",
+	} {
+		if got := composeProject(name); got != want {
+			t.Errorf("composeProject(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "shop_web_1", "10", "20"), stat("bbb222", "shop-db-1", "30", "10"), stat("ccc333", "loose", "5", "5"))
+	s := newTestServer(t, dir)
+
+	var groups []ContainerGroup
+	decode(t, get(t, s, "/api/groups?by=project", http.StatusOK), &groups)
+	if len(groups) != 2 || groups[0].Group != noProjectGroup || groups[1].Group != "shop" || groups[1].AvgCPU != 40 || len(groups[1].Containers) != 2 {
+		t.Errorf("project groups = %+v, want (no project) and shop totalling 40%% CPU", groups)
+	}
+
+	body := get(t, s, "/summary?group=project", http.StatusOK).Body.String()
+	if !strings.Contains(body, "<h2>Compose Projects</h2>") || !strings.Contains(body, "<td>shop</td>") {
+		t.Error("summary page grouped by project has no project table")
+	}
+	if body := get(t, s, "/summary", http.StatusOK).Body.String(); strings.Contains(body, "<h2>Compose Projects</h2>") {
+		t.Error("summary page shows the project table without ?group=project")
+	}
+	get(t, s, "/summary?group=label", http.StatusBadRequest)
+}
+
+func TestHealthLastRefresh(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	before := time.Now().Truncate(time.Second)
+	s := newTestServer(t, dir)
+
+	lastRefresh := func() time.Time {
+		var health struct {
+			LastRefresh string `json:"last_refresh"`
+		}
+		decode(t, get(t, s, "/healthz", http.StatusOK), &health)
+		ts, err := time.Parse(time.RFC3339, health.LastRefresh)
+		if err != nil {
+			t.Fatalf("last_refresh %q is not RFC 3339: %v", health.LastRefresh, err)
+		}
+		return ts
+	}
+	startup := lastRefresh()
+	if startup.Before(before) {
+		t.Errorf("last_refresh = %v, want the startup load after %v", startup, before)
+	}
+
+	stubRunScript(t)
+	time.Sleep(time.Second)
+	post(t, s, "/api/refresh", "", http.StatusOK)
+	if refreshed := lastRefresh(); !refreshed.After(startup) {
+		t.Errorf("last_refresh = %v after a refresh, want later than %v", refreshed, startup)
+	}
+}
+
+func TestRefreshDisabled(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir, "-refresh", "0")
+
+	// A run.sh that fails shows whether it was run at all
+	scriptDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(scriptDir, "run.sh"), []byte("exit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(scriptDir)
+
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "12", "20"))
+	var result struct {
+		FilesLoaded int `json:"files_loaded"`
+	}
+	decode(t, post(t, s, "/api/refresh", "", http.StatusOK), &result)
+	if result.FilesLoaded != 2 {
+		t.Errorf("loaded %d files, want 2 reloaded without running run.sh", result.FilesLoaded)
+	}
+	post(t, s, "/api/run-script", "", http.StatusForbidden)
+
+	var cfg Config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.registerFlags(fs)
+	if err := fs.Parse([]string{"-refresh", "-1m"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.resolve(); err == nil {
+		t.Error("negative -refresh was accepted")
+	}
+}
+
+func TestRefreshWithoutScript(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	s := newTestServer(t, dir)
+
+	// A run.sh that fails shows whether it was run at all
+	scriptDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(scriptDir, "run.sh"), []byte("exit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(scriptDir)
+
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "12", "20"))
+	post(t, s, "/api/refresh", "", http.StatusInternalServerError)
+	var result struct {
+		FilesLoaded int `json:"files_loaded"`
+	}
+	decode(t, post(t, s, "/api/refresh?script=false", "", http.StatusOK), &result)
+	if result.FilesLoaded != 2 {
+		t.Errorf("loaded %d files, want 2 reloaded without running run.sh", result.FilesLoaded)
+	}
+	post(t, s, "/api/refresh?script=maybe", "", http.StatusBadRequest)
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "20", "30")
+	s := newTestServer(t, dir, "-precompute-workers", "2", "-query-api")
+	older := s.data.Snapshot()
+	newer, _, err := loadAllStatsFiles(dir, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run with -race: swapping the files while handlers read them must not
+	// race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if i%2 == 0 {
+				s.setFiles(newer)
+			} else {
+				s.setFiles(older)
+			}
+		}
+	}()
+	targets := []string{"/", "/api/summary", "/api/container/aaa111", "/api/container/aaa111/sparkline.png", "/api/overview", "/api/query?agg=avg&by=container", "/metrics", "/healthz"}
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				rec := httptest.NewRecorder()
+				s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+				if rec.Code != http.StatusOK {
+					t.Errorf("GET %s during refreshes: status %d", target, rec.Code)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGzipStatsFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	line, _ := json.Marshal(stat("aaa111", "web", "30", "20"))
+	gz.Write(append(line, '\n'))
+	gz.Close()
+	if err := os.WriteFile(filepath.Join(dir, "2025-08-05_10-01-00_docker_stats.json.gz"), gzipped.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt.gz"), gzipped.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := loadFiles(t, dir)
+	if len(files) != 2 {
+		t.Fatalf("loaded %d files, want the plain and the gzipped stats file", len(files))
+	}
+	if !files[0].Timestamp.Equal(testStart.Add(time.Minute)) || len(files[0].Stats) != 1 || files[0].Stats[0].CPUPerc != "30%" {
+		t.Errorf("gzipped file = %+v, want its timestamp from the name and its decompressed stats", files[0])
+	}
+}
+
+func TestJSONArrayFile(t *testing.T) {
+	dir := t.TempDir()
+	stats, _ := json.MarshalIndent([]DockerStat{stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "5", "10")}, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, "2025-08-05_10-00-00_docker_stats.json"), append([]byte("\n  "), stats...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "2025-08-05_10-01-00_docker_stats.json"), []byte(`[{"ID": "aaa111"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, loadErrors, err := loadAllStatsFiles(dir, LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || len(files[0].Stats) != 2 || files[0].Stats[1].ID != "bbb222" {
+		t.Errorf("files = %+v, want the array file with both containers", files)
+	}
+	if len(loadErrors) != 1 || !strings.Contains(loadErrors[0].Error, "JSON array") {
+		t.Errorf("load errors = %+v, want the truncated array reported", loadErrors)
+	}
+}
+
+func TestCompareMany(t *testing.T) {
+	dir := t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"), stat("bbb222", "db", "5", "10"), stat("ccc333", "cache", "1", "40"))
+	writeStatsFile(t, dir, testStart.Add(time.Minute), stat("aaa111", "web", "20", "25"), stat("ccc333", "cache", "2", "45"))
+	s := newTestServer(t, dir)
+
+	var aligned AlignedComparison
+	decode(t, get(t, s, "/api/compare?ids=ccc333,aaa111,bbb222,aaa111", http.StatusOK), &aligned)
+	var ids []string
+	for _, series := range aligned.Series {
+		ids = append(ids, series.ContainerID)
+	}
+	if !reflect.DeepEqual(ids, []string{"ccc333", "aaa111", "bbb222"}) {
+		t.Fatalf("series = %v, want the requested containers in order without duplicates", ids)
+	}
+	if cache := aligned.Series[0]; cache.Mem[1] == nil || *cache.Mem[1] != 45 {
+		t.Errorf("ccc333 memory = %v, want 45 at the second timestamp", cache.Mem)
+	}
+	if db := aligned.Series[2]; db.Mem[0] == nil || db.Mem[1] != nil {
+		t.Errorf("bbb222 memory = %v, want a gap at the second timestamp", db.Mem)
+	}
+
+	get(t, s, "/api/compare?ids=aaa111", http.StatusBadRequest)
+	get(t, s, "/api/compare?ids=a1,a2,a3,a4,a5,a6,a7,a8,a9", http.StatusBadRequest)
+	if body := get(t, s, "/compare?ids=aaa111,bbb222,ccc333", http.StatusOK).Body.String(); !strings.Contains(body, `value="aaa111,bbb222,ccc333"`) {
+		t.Error("comparison page does not prefill the requested IDs")
+	}
+}
+
+func TestDashboardPagination(t *testing.T) {
+	dir := t.TempDir()
+	var stats []DockerStat
+	for i := 1; i <= 5; i++ {
+		id := fmt.Sprintf("c%d", i)
+		stats = append(stats, stat(id, "web-"+id, "10", "20"))
+	}
+	writeStatsFile(t, dir, testStart, stats...)
+	s := newTestServer(t, dir)
+
+	body := get(t, s, "/?page=2&pageSize=2", http.StatusOK).Body.String()
+	for _, id := range []string{"web-c3", "web-c4"} {
+		if !strings.Contains(body, id) {
+			t.Errorf("page 2 does not list %s", id)
+		}
+	}
+	for _, id := range []string{"web-c1", "web-c5"} {
+		if strings.Contains(body, id) {
+			t.Errorf("page 2 lists %s from another page", id)
+		}
+	}
+	if !strings.Contains(body, "Page 2 of 3 (5 containers)") || !strings.Contains(body, `href="?page=1&amp;pageSize=2"`) || !strings.Contains(body, `href="?page=3&amp;pageSize=2"`) {
+		t.Error("page 2 has no position or links to its neighbours")
+	}
+
+	if body := get(t, s, "/?page=99&pageSize=2", http.StatusOK).Body.String(); !strings.Contains(body, "Page 3 of 3") || !strings.Contains(body, "web-c5") {
+		t.Error("a page past the end is not clamped to the last page")
+	}
+	if body := get(t, s, "/", http.StatusOK).Body.String(); strings.Contains(body, `class="pagination"`) || !strings.Contains(body, "web-c5") {
+		t.Error("a dashboard within one page shows pagination or misses containers")
+	}
+}
+
+func TestMetricsMergedSources(t *testing.T) {
+	dir := t.TempDir()
+	writeNamedStatsFile(t, dir, "2025-08-05_10-00-00_host-a_docker_stats.json", stat("aaa111", "web", "10", "20"))
+	writeNamedStatsFile(t, dir, "2025-08-05_10-00-00_host-b_docker_stats.json", stat("aaa111", "web", "30", "20"))
+	s := newTestServer(t, dir, "-merge-same-timestamp")
+
+	body := get(t, s, "/metrics", http.StatusOK).Body.String()
+	series := make(map[string]bool)
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "docker_stats_container_cpu_percent{") {
+			continue
+		}
+		name, _, _ := strings.Cut(line, " ")
+		if series[name] {
+			t.Errorf("duplicate series %s", name)
+		}
+		series[name] = true
+	}
+	for _, want := range []string{
+		`docker_stats_container_cpu_percent{name="web",id="aaa111",source="2025-08-05_10-00-00_host-a_docker_stats.json"} 10`,
+		`docker_stats_container_cpu_percent{name="web",id="aaa111",source="2025-08-05_10-00-00_host-b_docker_stats.json"} 30`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics have no %s", want)
+		}
+	}
+
+	dir = t.TempDir()
+	writeStatsFile(t, dir, testStart, stat("aaa111", "web", "10", "20"))
+	if body := get(t, newTestServer(t, dir), "/metrics", http.StatusOK).Body.String(); !strings.Contains(body, `docker_stats_container_cpu_percent{name="web",id="aaa111"} 10`) {
+		t.Errorf("unmerged metrics have extra labels:\n%s", body)
+	}
+}
+
+func TestContainerMemoryBytes(t *testing.T) {
+	dir := t.TempDir()
+	low, high := stat("aaa111", "web", "10", "10"), stat("aaa111", "web", "10", "30")
+	high.MemUsage = "300MiB / 1GiB"
+	writeStatsFile(t, dir, testStart, low)
+	writeStatsFile(t, dir, testStart.Add(time.Minute), high)
+
+	body := get(t, newTestServer(t, dir), "/container/aaa111", http.StatusOK).Body.String()
+	for _, want := range []string{"20.00% (200.0 MiB)", "30.00% (300.0 MiB)", "10.00% (100.0 MiB)"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("container page has no memory statistic %q", want)
+		}
+	}
+}
+
+func TestFileNameTimestamp(t *testing.T) {
+	for _, name := range []string{
+		"2025-08-05_10-00-00_docker_stats.json",
+		"prod_2025-08-05_10-00-00_docker_stats.json",
+		"stats-2025-08-05_10-00-00.json.gz",
+	} {
+		if got := fileNameTimestamp(name); !got.Equal(testStart) {
+			t.Errorf("timestamp of %s = %v, want %v", name, got, testStart)
+		}
+	}
+	before := time.Now()
+	if got := fileNameTimestamp("docker_stats.json"); got.Before(before) {
+		t.Errorf("a name without a timestamp got %v, want the current time", got)
+	}
+}
+
+func TestPageTimestamps(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "20")
+	s := newTestServer(t, dir, "-tz", "Asia/Tokyo")
+
+	body := get(t, s, "/?diff_back=1", http.StatusOK).Body.String()
+	for _, want := range []string{
+		"<p>Timestamp: 2025-08-05 19:01:00 JST</p>",
+		"(2025-08-05 19:00:00 JST) (1m ago)",
+		"ago (2025-08-05 19:00:00 JST)</h2>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dashboard has no %q", want)
+		}
+	}
+
+	body = get(t, s, "/container/aaa111", http.StatusOK).Body.String()
+	for _, want := range []string{">2025-08-05 19:00:00 JST</text>", ">2025-08-05 19:01:00 JST</text>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("container chart has no %q label", want)
+		}
+	}
+
+	// File names written on Tokyo time are nine hours ahead of UTC
+	s = newTestServer(t, dir, "-file-tz", "Asia/Tokyo")
+	if body := get(t, s, "/", http.StatusOK).Body.String(); !strings.Contains(body, "<p>Timestamp: 2025-08-05 01:01:00 UTC</p>") {
+		t.Error("file name timestamps are not read in the -file-tz zone")
+	}
+}
+
+func TestCPUAnomalies(t *testing.T) {
+	dir := t.TempDir()
+	writeCPUSeries(t, dir, "aaa111", "10", "12", "10", "12", "10", "90")
+	s := newTestServer(t, dir)
+
+	body := get(t, s, "/container/aaa111", http.StatusOK).Body.String()
+	if !strings.Contains(body, "<strong>CPU Anomalies:</strong> <span class=\"metric-high\">1</span> data point more") {
+		t.Error("container page does not count one CPU anomaly")
+	}
+	if n := strings.Count(body, `<tr class="anomaly-row"`); n != 1 {
+		t.Errorf("%d highlighted rows, want 1", n)
+	}
+
+	flat := []ContainerDataPoint{{CPUPerc: 10}, {CPUPerc: 10}, {CPUPerc: 10}, {CPUPerc: 90}}
+	if got := detectAnomalies(flat, 20, 3); len(got) != 0 {
+		t.Errorf("anomalies after a flat history = %v, want none", got)
+	}
+}
@@ -1,6 +1,7 @@
 #!/bin/bash
 DATE=$(date +%Y-%m-%d_%H-%M-%S)
-OUTPUT_FILE="stats/${DATE}_docker_stats.json"
+STATS_DIR="${STATS_DIR:-stats}"
+OUTPUT_FILE="${STATS_DIR%/}/${DATE}_docker_stats.json"
 
 docker stats --no-stream --format '{{json .}}' > "$OUTPUT_FILE"
 if [ $? -eq 0 ]; then